@@ -3,7 +3,7 @@ package anko
 import (
 	"fmt"
 	"regexp"
-	"strings"
+	"strconv"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/mattn/anko/core"
@@ -151,32 +151,14 @@ func (a *Anko) Execute(src string) (interface{}, error) {
 
 // KeybindExists checks if keybinding is defined.
 func (a *Anko) KeybindExists(panel string, eventKey *tcell.EventKey) bool {
-	var src string
-	name := eventKey.Name()
-
-	if strings.Contains(name, "Ctrl") {
-		key, ok := extractCtrlRune(name)
-		if !ok {
-			return false
-		}
-		src = fmt.Sprintf("Keybinds.%s[\"ctrl_%s\"]",
-			panel, strings.ToLower(string(key)))
-
-	} else if strings.Contains(name, "Alt") {
-		key, ok := extractAltRune(name)
-		if !ok {
-			return false
-		}
-		src = fmt.Sprintf("Keybinds.%s[\"alt_%c\"]", panel, key)
-
-	} else if strings.Contains(name, "Rune") {
-		src = fmt.Sprintf("Keybinds.%s[\"%c\"]", panel, eventKey.Rune())
-
-	} else {
-		src = fmt.Sprintf("Keybinds.%s[\"%s\"]", panel, strings.ToLower(name))
 
+	name, ok := KeyName(eventKey)
+	if !ok {
+		return false
 	}
 
+	src := fmt.Sprintf("%s[%s]", tableSrc(panel), strconv.Quote(name))
+
 	val, err := a.Execute(src)
 	if err != nil {
 		return false
@@ -188,32 +170,13 @@ func (a *Anko) KeybindExists(panel string, eventKey *tcell.EventKey) bool {
 // ExecKeybind executes function bounded by the keybinding.
 func (a *Anko) ExecKeybind(panel string, eventKey *tcell.EventKey) error {
 
-	var src string
-	name := eventKey.Name()
-
-	if strings.Contains(name, "Ctrl") {
-		key, ok := extractCtrlRune(name)
-		if !ok {
-			return nil
-		}
-		src = fmt.Sprintf("Keybinds.%s[\"ctrl_%s\"]()",
-			panel, strings.ToLower(string(key)))
-
-	} else if strings.Contains(name, "Alt") {
-		key, ok := extractAltRune(name)
-		if !ok {
-			return nil
-		}
-		src = fmt.Sprintf("Keybinds.%s[\"alt_%c\"]()", panel, key)
-
-	} else if strings.Contains(name, "Rune") {
-		src = fmt.Sprintf("Keybinds.%s[\"%c\"]()", panel, eventKey.Rune())
-
-	} else {
-		src = fmt.Sprintf("Keybinds.%s[\"%s\"]()", panel, strings.ToLower(name))
-
+	name, ok := KeyName(eventKey)
+	if !ok {
+		return nil
 	}
 
+	src := fmt.Sprintf("%s[%s]()", tableSrc(panel), strconv.Quote(name))
+
 	_, err := a.Execute(src)
 	if err != nil {
 		return err
@@ -3,6 +3,7 @@ package anko
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/stretchr/testify/assert"
@@ -280,3 +281,108 @@ module Keybinds {
 		assert.Equal(t, test.exists, got, msg)
 	}
 }
+
+func TestSplitKeys(t *testing.T) {
+	tests := []struct {
+		in  string
+		out []string
+	}{
+		{in: "b", out: []string{"b"}},
+		{in: " ", out: []string{" "}},
+		{in: "gg", out: []string{"g", "g"}},
+		{in: "ctrl_w j", out: []string{"ctrl_w", "j"}},
+		{in: "enter", out: []string{"enter"}},
+		{in: "g enter", out: []string{"g", "enter"}},
+		{in: "alt_x", out: []string{"alt_x"}},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.out, splitKeys(test.in), test.in)
+	}
+}
+
+func TestSequence(t *testing.T) {
+
+	src := `
+module Keybinds {
+	global = {}
+	playlist = {}
+	queue = {}
+	modes = {}
+
+	n = 0
+	top = 0
+	g = 0
+	last = 0
+
+	global["n"] = func() { n++ }
+	global["g"] = func() { g++ }
+	playlist["gg"] = func() { top++ }
+	playlist["1"] = func() { last = -1 }
+	queue["ctrl_w j"] = func(count) { last = count }
+	modes["seek"] = {"x": func(count) { last = count * 10 }}
+}
+`
+	a := NewAnko()
+	_, err := a.Execute(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runeKey := func(r rune) *tcell.EventKey {
+		return tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone)
+	}
+
+	s := a.NewSequence(time.Second, nil)
+
+	feed := func(tables []string, keys ...*tcell.EventKey) bool {
+		var consumed bool
+		for _, key := range keys {
+			consumed, err = s.Feed(key, tables...)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return consumed
+	}
+
+	global := []string{"global"}
+	playlist := []string{"global", "playlist"}
+	queue := []string{"global", "queue"}
+
+	// count prefix repeats the function
+	assert.True(t, feed(global, runeKey('3'), runeKey('n')))
+	assert.Equal(t, 3, a.GetInt("Keybinds.n"))
+
+	// unbound keys are not consumed
+	assert.False(t, feed(global, runeKey('x')))
+
+	// "g" waits for the second key since "gg" exists in playlist
+	assert.True(t, feed(playlist, runeKey('g')))
+	assert.Equal(t, "g", s.Pending())
+	assert.True(t, feed(playlist, runeKey('g')))
+	assert.Equal(t, 1, a.GetInt("Keybinds.top"))
+	assert.Equal(t, 0, a.GetInt("Keybinds.g"))
+
+	// "g" runs right away when there is no longer binding
+	assert.True(t, feed(global, runeKey('g')))
+	assert.Equal(t, 1, a.GetInt("Keybinds.g"))
+
+	// bound digits are not treated as count
+	assert.True(t, feed(playlist, runeKey('1')))
+	assert.Equal(t, -1, a.GetInt("Keybinds.last"))
+
+	// functions taking an argument receive the count
+	ctrlW := tcell.NewEventKey(tcell.KeyCtrlW, 'w', tcell.ModCtrl)
+	assert.True(t, feed(queue, runeKey('1'), runeKey('2'), ctrlW, runeKey('j')))
+	assert.Equal(t, 12, a.GetInt("Keybinds.last"))
+
+	// user-defined modes
+	assert.True(t, feed([]string{"seek"}, runeKey('x')))
+	assert.Equal(t, 10, a.GetInt("Keybinds.last"))
+
+	// broken sequence starts over from the last key
+	assert.True(t, feed(playlist, runeKey('g'), runeKey('n')))
+	assert.Equal(t, 4, a.GetInt("Keybinds.n"))
+	assert.Equal(t, "", s.Pending())
+}
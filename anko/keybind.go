@@ -0,0 +1,346 @@
+package anko
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// Keybind is a single entry of a Keybinds table.
+type Keybind struct {
+	Keys string
+	Fn   interface{}
+}
+
+// KeyName returns the name used for the key event in Keybinds tables, e.g.
+// "b", "ctrl_b", "alt_b" or "enter".
+func KeyName(eventKey *tcell.EventKey) (string, bool) {
+	name := eventKey.Name()
+
+	if strings.Contains(name, "Ctrl") {
+		key, ok := extractCtrlRune(name)
+		if !ok {
+			return "", false
+		}
+		return "ctrl_" + strings.ToLower(string(key)), true
+
+	} else if strings.Contains(name, "Alt") {
+		key, ok := extractAltRune(name)
+		if !ok {
+			return "", false
+		}
+		return "alt_" + string(key), true
+
+	} else if strings.Contains(name, "Rune") {
+		return string(eventKey.Rune()), true
+	}
+
+	return strings.ToLower(name), true
+}
+
+// isKeyName checks if s is the name of a non-rune key such as "enter" or
+// "pgdn".
+func isKeyName(s string) bool {
+	if strings.HasPrefix(s, "ctrl_") || strings.HasPrefix(s, "alt_") {
+		return true
+	}
+	for _, name := range tcell.KeyNames {
+		if strings.ToLower(name) == s {
+			return true
+		}
+	}
+	return false
+}
+
+// splitKeys splits a keybinding into the names of its keys. Keys can be
+// separated by spaces ("ctrl_w j") or written together when they are plain
+// runes ("gg").
+func splitKeys(kb string) []string {
+
+	if strings.TrimSpace(kb) == "" {
+		return []string{kb}
+	}
+
+	var keys []string
+	for _, field := range strings.Fields(kb) {
+		if utf8.RuneCountInString(field) == 1 || isKeyName(field) {
+			keys = append(keys, field)
+			continue
+		}
+		for _, r := range field {
+			keys = append(keys, string(r))
+		}
+	}
+
+	return keys
+}
+
+// tableSrc returns the anko expression of a Keybinds table. The panel tables
+// are module variables, user-defined modes are stored under Keybinds.modes.
+func tableSrc(table string) string {
+	switch table {
+	case "global", "playlist", "queue", "lyrics":
+		return "Keybinds." + table
+	}
+	return fmt.Sprintf("Keybinds.modes[%s]", strconv.Quote(table))
+}
+
+// KeybindList returns the keybindings of a Keybinds table sorted by keys.
+func (a *Anko) KeybindList(table string) []Keybind {
+
+	val, err := a.Execute(tableSrc(table))
+	if err != nil {
+		return nil
+	}
+
+	m, ok := val.(map[interface{}]interface{})
+	if !ok {
+		return nil
+	}
+
+	var keybinds []Keybind
+	for k, fn := range m {
+		keys, ok := k.(string)
+		if !ok || fn == nil {
+			continue
+		}
+		keybinds = append(keybinds, Keybind{Keys: keys, Fn: fn})
+	}
+
+	sort.Slice(keybinds, func(i, j int) bool {
+		return keybinds[i].Keys < keybinds[j].Keys
+	})
+
+	return keybinds
+}
+
+// binding is a keybinding resolved from a Keybinds table, src is the anko
+// expression of the bound function.
+type binding struct {
+	src string
+	fn  interface{}
+}
+
+// Sequence resolves key events against Keybinds tables. It supports bindings
+// made of several keys ("gg"), count prefixes ("2n") and user-defined modes.
+// When a binding is also the start of a longer one, it is executed after the
+// timeout unless another key follows.
+type Sequence struct {
+	anko    *Anko
+	timeout time.Duration
+	// schedule is used to run the pending binding after the timeout, it should
+	// run the function on the thread handling key events.
+	schedule func(func() error)
+
+	mu    sync.Mutex
+	keys  []string
+	count int
+	last  time.Time
+	// gen is increased on every key so that stale timers are ignored
+	gen int
+}
+
+// NewSequence returns new Sequence.
+func (a *Anko) NewSequence(
+	timeout time.Duration, schedule func(func() error),
+) *Sequence {
+	return &Sequence{
+		anko:     a,
+		timeout:  timeout,
+		schedule: schedule,
+	}
+}
+
+// Pending returns the count and keys typed so far, e.g. "2g".
+func (s *Sequence) Pending() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var prefix string
+	if s.count > 0 {
+		prefix = strconv.Itoa(s.count)
+	}
+	return prefix + strings.Join(s.keys, "")
+}
+
+// Reset clears the pending keys and count.
+func (s *Sequence) Reset() {
+	s.mu.Lock()
+	s.reset()
+	s.mu.Unlock()
+}
+
+func (s *Sequence) reset() {
+	s.keys = nil
+	s.count = 0
+	s.gen++
+}
+
+// Feed passes the key event to the sequence. Tables are the names of the
+// Keybinds tables to look up in order of precedence. It returns true if the
+// key has been consumed.
+func (s *Sequence) Feed(eventKey *tcell.EventKey, tables ...string) (bool, error) {
+
+	name, ok := KeyName(eventKey)
+	if !ok {
+		s.Reset()
+		return false, nil
+	}
+
+	s.mu.Lock()
+
+	if s.timeout > 0 && time.Since(s.last) > s.timeout {
+		s.reset()
+	}
+	s.last = time.Now()
+	s.gen++
+
+	// digits are used as count unless they start a binding
+	if d, err := strconv.Atoi(name); err == nil && len(s.keys) == 0 &&
+		(s.count > 0 || d > 0) {
+		if exact, longer := s.lookup([]string{name}, tables); s.count > 0 ||
+			(exact == nil && !longer) {
+			s.count = s.count*10 + d
+			s.mu.Unlock()
+			return true, nil
+		}
+	}
+
+	keys := append(append([]string{}, s.keys...), name)
+	exact, longer := s.lookup(keys, tables)
+
+	switch {
+	case exact != nil && !longer:
+		count := s.count
+		s.reset()
+		s.mu.Unlock()
+		return true, s.run(*exact, count)
+
+	case longer:
+		s.keys = keys
+		if exact != nil && s.schedule != nil {
+			s.wait(*exact, s.count, s.gen)
+		}
+		s.mu.Unlock()
+		return true, nil
+	}
+
+	// the key breaks the sequence, start over from this key
+	retry := len(s.keys) > 0 || s.count > 0
+	s.reset()
+	s.mu.Unlock()
+
+	if retry {
+		return s.Feed(eventKey, tables...)
+	}
+
+	return false, nil
+}
+
+// wait runs the binding after the timeout if no other key has been fed.
+func (s *Sequence) wait(b binding, count, gen int) {
+	time.AfterFunc(s.timeout, func() {
+		s.schedule(func() error {
+			s.mu.Lock()
+			if s.gen != gen {
+				s.mu.Unlock()
+				return nil
+			}
+			s.reset()
+			s.mu.Unlock()
+
+			return s.run(b, count)
+		})
+	})
+}
+
+// lookup finds the binding matching keys exactly and checks whether keys is the
+// start of a longer binding.
+func (s *Sequence) lookup(keys []string, tables []string) (*binding, bool) {
+
+	var exact *binding
+	var longer bool
+
+	for _, table := range tables {
+		for _, kb := range s.anko.KeybindList(table) {
+
+			bound := splitKeys(kb.Keys)
+			if len(bound) < len(keys) || !equalKeys(bound[:len(keys)], keys) {
+				continue
+			}
+
+			if len(bound) > len(keys) {
+				longer = true
+				continue
+			}
+
+			if exact == nil {
+				src := fmt.Sprintf("%s[%s]", tableSrc(table), strconv.Quote(kb.Keys))
+				exact = &binding{src: src, fn: kb.Fn}
+			}
+		}
+	}
+
+	return exact, longer
+}
+
+// run executes the binding. Functions taking one argument receive the count,
+// others are executed count times.
+func (s *Sequence) run(b binding, count int) error {
+
+	if count < 1 {
+		count = 1
+	}
+
+	if acceptsCount(b.fn) {
+		_, err := s.anko.Execute(fmt.Sprintf("%s(%d)", b.src, count))
+		return err
+	}
+
+	for i := 0; i < count; i++ {
+		_, err := s.anko.Execute(b.src + "()")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// acceptsCount checks if fn takes exactly one argument. Functions defined in
+// anko script take a context as their first argument.
+func acceptsCount(fn interface{}) bool {
+	t := reflect.TypeOf(fn)
+	if t == nil || t.Kind() != reflect.Func {
+		return false
+	}
+
+	n := t.NumIn()
+	if n > 0 && t.In(0) == contextType {
+		n--
+	}
+
+	return n == 1
+}
+
+func equalKeys(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"github.com/tramhao/id3v2"
+	"github.com/ztrue/tracerr"
+
+	"github.com/issadarkthing/gomu/lyric"
+	"github.com/issadarkthing/gomu/player"
+)
+
+// songTrack reads the artist, title, album and duration of the song, the file
+// name is used as title when the song has no title
+func songTrack(songPath string) (lyric.Track, error) {
+
+	tag, err := id3v2.Open(songPath, id3v2.Options{Parse: true})
+	if err != nil {
+		return lyric.Track{}, tracerr.Wrap(err)
+	}
+
+	track := lyric.Track{
+		Artist: strings.TrimSpace(tag.Artist()),
+		Title:  strings.TrimSpace(tag.Title()),
+		Album:  strings.TrimSpace(tag.Album()),
+	}
+	tag.Close()
+
+	if track.Title == "" {
+		name := filepath.Base(songPath)
+		track.Title = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+
+	track.Duration, err = getTagLength(songPath)
+	if err != nil {
+		return lyric.Track{}, tracerr.Wrap(err)
+	}
+
+	return track, nil
+}
+
+// lyricMatcher returns the provider of lang matching lyrics without asking the
+// user, the provider chosen in General.lang_lyric is preferred. It reads the
+// config so it is called before the jobs start.
+func lyricMatcher(lang string) (lyric.LyricMatcher, error) {
+
+	var names []string
+	if name, err := lyricProvider(lang); err == nil {
+		names = append(names, name)
+	}
+	for _, provider := range lyric.ProvidersFor(lang) {
+		names = append(names, provider.Name)
+	}
+
+	for _, name := range names {
+		fetcher, err := lyric.NewFetcher(name, lyricBaseURL(name))
+		if err != nil {
+			return nil, tracerr.Wrap(err)
+		}
+		if matcher, ok := fetcher.(lyric.LyricMatcher); ok {
+			return matcher, nil
+		}
+	}
+
+	return nil, tracerr.Errorf("no lyric provider for %s matches songs", lang)
+}
+
+// findLyric returns the synced lyric matching the song best, nil if there is
+// none. It is ambiguous if another lyric matches as well.
+func findLyric(
+	matcher lyric.LyricMatcher, songPath string,
+) (best *lyric.Match, ambiguous bool, err error) {
+
+	track, err := songTrack(songPath)
+	if err != nil {
+		return nil, false, tracerr.Wrap(err)
+	}
+
+	matches, err := matcher.LyricMatch(track)
+	if err != nil {
+		return nil, false, tracerr.Wrap(err)
+	}
+
+	best, ambiguous = lyric.BestMatch(matches)
+	return best, ambiguous, nil
+}
+
+// embedMatch embeds the lyric of the match in lang
+func embedMatch(songPath, lang string, match *lyric.Match) error {
+
+	var l lyric.Lyric
+	err := l.NewFromLRC(match.Lyric)
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+	l.LangExt = lang
+
+	return embedLyric(songPath, &l, false)
+}
+
+// autoLyric embeds the best synced lyric of lang in the song in a background
+// job, the lyric shown is reloaded if the song is being played
+func autoLyric(audioFile *player.AudioFile, lang string) {
+
+	matcher, err := lyricMatcher(lang)
+	if err != nil {
+		errorPopup(err)
+		return
+	}
+
+	gomu.jobs.submit("lyric", lang+" lyric of "+audioFile.Name(), func(ctx context.Context, j *Job) error {
+
+		best, ambiguous, err := findLyric(matcher, audioFile.Path())
+		if err != nil {
+			return tracerr.Wrap(err)
+		}
+		if best == nil {
+			return tracerr.Errorf("no synced %s lyric matches %s", lang, audioFile.Name())
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		err = embedMatch(audioFile.Path(), lang, best)
+		if err != nil {
+			return tracerr.Wrap(err)
+		}
+
+		gomu.app.QueueUpdateDraw(func() {
+			if current := gomu.player.GetCurrentSong(); gomu.player.IsRunning() &&
+				current.Path() == audioFile.Path() {
+				err := gomu.playingBar.reloadSubtitle(lang)
+				if err != nil {
+					errorPopup(err)
+					return
+				}
+			}
+
+			msg := lang + " lyric added from " + best.SongTag.TitleForPopup
+			if ambiguous {
+				msg += "\nother lyrics match as well, use fetch_lyric to choose one"
+			}
+			defaultTimedPopup(" Lyric ", msg)
+		})
+
+		return nil
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tramhao/id3v2"
+)
+
+// taggedSong creates a song with tags and a length of 180 seconds, it is
+// removed by the returned function
+func taggedSong(t *testing.T, artist, title, album string) (string, func()) {
+
+	dir, err := ioutil.TempDir("", "gomu-autolyric")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	songPath := filepath.Join(dir, "song.mp3")
+	err = ioutil.WriteFile(songPath, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tag, err := id3v2.Open(songPath, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag.SetArtist(artist)
+	tag.SetTitle(title)
+	tag.SetAlbum(album)
+	tag.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
+		Encoding:    id3v2.EncodingUTF8,
+		Description: "TLEN",
+		Value:       "180000",
+	})
+	err = tag.Save()
+	tag.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return songPath, func() { os.RemoveAll(dir) }
+}
+
+func TestSongTrack(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+
+	songPath, remove := taggedSong(t, "Artist", "", "Album")
+	defer remove()
+
+	// the file name is used without title
+	track, err := songTrack(songPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "Artist", track.Artist)
+	assert.Equal(t, "song", track.Title)
+	assert.Equal(t, "Album", track.Album)
+	assert.Equal(t, 180*time.Second, track.Duration)
+}
+
+func TestFindLyric(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.URL.Path != "/api/search" || query.Get("artist_name") != "Artist" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `[
+			{"id": 1, "trackName": "%[1]s", "albumName": "Album", "duration": 300,
+			 "syncedLyrics": "[00:01.00]too long"},
+			{"id": 2, "trackName": "%[1]s", "albumName": "Album", "duration": 180.4,
+			 "syncedLyrics": "[00:01.00]hello\n[00:05.00]world"}
+		]`, query.Get("track_name"))
+	}))
+	defer server.Close()
+
+	_, err := gomu.anko.Execute(fmt.Sprintf(`General.lyric_urls = {"lrclib": "%s"}`, server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	songPath, remove := taggedSong(t, "Artist", "Song", "Album")
+	defer remove()
+
+	matcher, err := lyricMatcher("en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	best, ambiguous, err := findLyric(matcher, songPath)
+	assert.NoError(t, err)
+	assert.False(t, ambiguous)
+	assert.Equal(t, "[00:01.00]hello\n[00:05.00]world", best.Lyric)
+
+	assert.NoError(t, embedMatch(songPath, "en", best))
+
+	err = gomu.playingBar.loadLyrics(songPath)
+	assert.NoError(t, err)
+	assert.Len(t, gomu.playingBar.subtitles, 1)
+	assert.Equal(t, "world", gomu.playingBar.subtitles[0].SyncedCaptions[1].Text)
+
+	// no provider of the language matches songs
+	_, err = lyricMatcher("zh-CN")
+	assert.Error(t, err)
+}
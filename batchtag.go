@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/tramhao/id3v2"
+	"github.com/ztrue/tracerr"
+
+	"github.com/issadarkthing/gomu/player"
+)
+
+// batchField is a tag field that is shared by the files edited together. key
+// is the name of the field in tagKeys, it is written with setTagField so that
+// the frame matches the version of the tag.
+type batchField struct {
+	label string
+	key   string
+}
+
+var batchFields = []batchField{
+	{"Album", "album"},
+	{"Album artist", "albumartist"},
+	{"Year", "year"},
+	{"Genre", "genre"},
+}
+
+var trackField = batchField{"Track", "track"}
+
+// tagDiff is a change to a single frame of a file
+type tagDiff struct {
+	field batchField
+	old   string
+	new   string
+}
+
+// batchChanges returns the changes for each file. current contains the frames
+// of every file keyed by field in tree order. Empty shared fields are
+// left unchanged. When numberTracks is true, track numbers are set following
+// the order of the files.
+func batchChanges(
+	current []map[string]string, shared map[string]string, numberTracks bool,
+) [][]tagDiff {
+
+	changes := make([][]tagDiff, len(current))
+
+	for i, frames := range current {
+
+		for _, field := range batchFields {
+			value := shared[field.key]
+			if value == "" || value == frames[field.key] {
+				continue
+			}
+			changes[i] = append(changes[i], tagDiff{field, frames[field.key], value})
+		}
+
+		if !numberTracks {
+			continue
+		}
+
+		track := fmt.Sprintf("%d/%d", i+1, len(current))
+		if track != frames[trackField.key] {
+			changes[i] = append(changes[i], tagDiff{trackField, frames[trackField.key], track})
+		}
+	}
+
+	return changes
+}
+
+// readBatchTags reads the frames that can be edited in batch
+func readBatchTags(audioFiles []*player.AudioFile) ([]map[string]string, error) {
+
+	current := make([]map[string]string, 0, len(audioFiles))
+
+	for _, audioFile := range audioFiles {
+
+		tag, err := id3v2.Open(audioFile.Path(), id3v2.Options{Parse: true})
+		if err != nil {
+			return nil, tracerr.Wrap(err)
+		}
+
+		frames := make(map[string]string)
+		for _, field := range append(batchFields, trackField) {
+			frames[field.key] = tag.GetTextFrame(tag.CommonID(tagKeys[field.key])).Text
+		}
+		tag.Close()
+
+		current = append(current, frames)
+	}
+
+	return current, nil
+}
+
+// saveBatchTags writes the changes to the files, it returns the number of
+// files updated.
+func saveBatchTags(audioFiles []*player.AudioFile, changes [][]tagDiff) (int, error) {
+
+	var updated int
+
+	for i, audioFile := range audioFiles {
+
+		if len(changes[i]) == 0 {
+			continue
+		}
+
+		tag, err := id3v2.Open(audioFile.Path(), id3v2.Options{Parse: true})
+		if err != nil {
+			return updated, tracerr.Wrap(err)
+		}
+
+		for _, diff := range changes[i] {
+			setTagField(tag, diff.field.key, diff.new)
+		}
+
+		err = tag.Save()
+		tag.Close()
+		if err != nil {
+			return updated, tracerr.Wrap(err)
+		}
+
+		updated++
+	}
+
+	return updated, nil
+}
+
+// batchTagPopup edits the shared tags of several files at once
+func batchTagPopup(audioFiles []*player.AudioFile) error {
+
+	popupID := "batch-tag-input-popup"
+
+	current, err := readBatchTags(audioFiles)
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+
+	form := tview.NewForm()
+
+	for _, field := range batchFields {
+		// prefill with the value if it is the same for every file
+		value := current[0][field.key]
+		for _, frames := range current[1:] {
+			if frames[field.key] != value {
+				value = ""
+				break
+			}
+		}
+		form.AddInputField(field.label+": ", value, 30, nil, nil)
+	}
+
+	form.AddCheckbox("Number tracks: ", false, nil)
+
+	closePopup := func() {
+		gomu.pages.RemovePage(popupID)
+		gomu.popups.pop()
+	}
+
+	form.AddButton("Preview", func() {
+
+		shared := make(map[string]string)
+		for i, field := range batchFields {
+			text := form.GetFormItem(i).(*tview.InputField).GetText()
+			shared[field.key] = strings.TrimSpace(text)
+		}
+
+		err := validateTagField("year", shared["year"])
+		if err != nil {
+			errorPopup(err)
+			return
+		}
+
+		numberTracks := form.GetFormItem(len(batchFields)).(*tview.Checkbox).IsChecked()
+		changes := batchChanges(current, shared, numberTracks)
+
+		batchTagPreviewPopup(audioFiles, changes, closePopup)
+	})
+
+	form.AddButton("Cancel", closePopup)
+	form.SetCancelFunc(closePopup)
+
+	form.SetFieldBackgroundColor(gomu.colors.popup).
+		SetFieldTextColor(gomu.colors.foreground).
+		SetButtonBackgroundColor(gomu.colors.popup).
+		SetButtonTextColor(gomu.colors.accent).
+		SetLabelColor(gomu.colors.accent).
+		SetBackgroundColor(gomu.colors.popup).
+		SetTitle(fmt.Sprintf(" Edit Tags (%d files) ", len(audioFiles))).
+		SetBorder(true).
+		SetBorderPadding(1, 0, 2, 2)
+
+	gomu.pages.AddPage(popupID, center(form, 60, 17), true, true)
+	gomu.popups.push(form)
+
+	return nil
+}
+
+// batchTagPreviewPopup shows the changes before saving them. done is called
+// after the tags are saved.
+func batchTagPreviewPopup(
+	audioFiles []*player.AudioFile, changes [][]tagDiff, done func(),
+) {
+
+	popupID := "batch-tag-preview-input-popup"
+
+	var preview strings.Builder
+	var count int
+
+	r, g, b := gomu.colors.accent.RGB()
+	hexColor := padHex(r, g, b)
+
+	for i, audioFile := range audioFiles {
+		if len(changes[i]) == 0 {
+			continue
+		}
+		count++
+
+		fmt.Fprintf(&preview, "[#%s]%s[-]\n", hexColor,
+			tview.Escape(audioFile.Name()))
+
+		for _, diff := range changes[i] {
+			fmt.Fprintf(&preview, "  %-13s [red]%s[-] -> [green]%s[-]\n",
+				diff.field.label+":", tview.Escape(diff.old), tview.Escape(diff.new))
+		}
+	}
+
+	if count == 0 {
+		infoPopup("No changes to save")
+		return
+	}
+
+	textView := tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(true).
+		SetText(preview.String())
+	textView.SetBackgroundColor(gomu.colors.popup)
+
+	closePopup := func() {
+		gomu.pages.RemovePage(popupID)
+		gomu.popups.pop()
+	}
+
+	buttons := tview.NewForm().
+		AddButton("Save", func() {
+			closePopup()
+			done()
+
+			updated, err := saveBatchTags(audioFiles, changes)
+			if err != nil {
+				errorPopup(err)
+				return
+			}
+			defaultTimedPopup(" Success ",
+				fmt.Sprintf("Tags of %d files updated", updated))
+		}).
+		AddButton("Back", closePopup).
+		SetButtonsAlign(tview.AlignCenter).
+		SetButtonBackgroundColor(gomu.colors.popup).
+		SetButtonTextColor(gomu.colors.accent)
+	buttons.SetBackgroundColor(gomu.colors.popup)
+	buttons.SetCancelFunc(closePopup)
+
+	flex := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(textView, 0, 1, false).
+		AddItem(buttons, 3, 0, true)
+
+	flex.SetBackgroundColor(gomu.colors.popup).
+		SetTitle(fmt.Sprintf(" Preview (%d files changed) ", count)).
+		SetBorder(true).
+		SetBorderPadding(1, 0, 2, 2)
+
+	// scroll the preview while the buttons keep focus
+	flex.SetInputCapture(func(e *tcell.EventKey) *tcell.EventKey {
+		switch e.Key() {
+		case tcell.KeyUp, tcell.KeyDown, tcell.KeyPgUp, tcell.KeyPgDn:
+			textView.InputHandler()(e, nil)
+			return nil
+		}
+		switch e.Rune() {
+		case 'j', 'k':
+			textView.InputHandler()(e, nil)
+			return nil
+		}
+		return e
+	})
+
+	gomu.pages.AddPage(popupID, center(flex, 80, 30), true, true)
+	gomu.popups.push(flex)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tramhao/id3v2"
+
+	"github.com/issadarkthing/gomu/player"
+)
+
+func TestBatchChanges(t *testing.T) {
+
+	album := batchFields[0].key
+	genre := batchFields[3].key
+
+	current := []map[string]string{
+		{album: "Discovery", genre: "House"},
+		{album: "Homework", trackField.key: "2/2"},
+	}
+
+	shared := map[string]string{album: "Discovery", genre: ""}
+
+	changes := batchChanges(current, shared, false)
+	assert.Len(t, changes[0], 0)
+	assert.Equal(t, []tagDiff{{batchFields[0], "Homework", "Discovery"}}, changes[1])
+
+	changes = batchChanges(current, shared, true)
+	assert.Equal(t, []tagDiff{{trackField, "", "1/2"}}, changes[0])
+	// track number is already correct
+	assert.Equal(t, []tagDiff{{batchFields[0], "Homework", "Discovery"}}, changes[1])
+}
+
+func TestSaveBatchTags(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "gomu-batchtag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var audioFiles []*player.AudioFile
+	for _, name := range []string{"one.mp3", "two.mp3"} {
+		path := filepath.Join(dir, name)
+		err := ioutil.WriteFile(path, nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		audioFile := new(player.AudioFile)
+		audioFile.SetName(name)
+		audioFile.SetPath(path)
+		audioFiles = append(audioFiles, audioFile)
+	}
+
+	current, err := readBatchTags(audioFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shared := map[string]string{batchFields[0].key: "Discovery"}
+	updated, err := saveBatchTags(audioFiles, batchChanges(current, shared, true))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, updated)
+
+	current, err = readBatchTags(audioFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "Discovery", current[1][batchFields[0].key])
+	assert.Equal(t, "2/2", current[1][trackField.key])
+
+	// TYER of id3v2.3 only holds the year
+	tag, err := id3v2.Open(audioFiles[0].Path(), id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag.SetVersion(3)
+	err = tag.Save()
+	tag.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shared = map[string]string{"year": "2001-03-12"}
+	_, err = saveBatchTags(audioFiles, batchChanges(current, shared, false))
+	assert.NoError(t, err)
+
+	current, err = readBatchTags(audioFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "2001", current[0]["year"])
+	assert.Equal(t, "2001-03-12", current[1]["year"])
+}
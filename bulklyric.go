@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/tramhao/id3v2"
+	"github.com/ztrue/tracerr"
+
+	"github.com/issadarkthing/gomu/lyric"
+	"github.com/issadarkthing/gomu/player"
+)
+
+// lyricBatch is the result of fetching the lyrics of many songs
+type lyricBatch struct {
+	total   int
+	skipped int
+	// names of the songs by result, ambiguous songs are not embedded as
+	// another lyric matches as well
+	matched   []string
+	ambiguous []string
+	failed    []string
+}
+
+// processed returns the number of songs done
+func (b *lyricBatch) processed() int {
+	return b.skipped + len(b.matched) + len(b.ambiguous) + len(b.failed)
+}
+
+// summary lists the counts and the songs to check
+func (b *lyricBatch) summary() string {
+
+	lines := []string{fmt.Sprintf("%d matched, %d ambiguous, %d failed, %d skipped",
+		len(b.matched), len(b.ambiguous), len(b.failed), b.skipped)}
+
+	for _, name := range b.ambiguous {
+		lines = append(lines, "ambiguous: "+name)
+	}
+	for _, name := range b.failed {
+		lines = append(lines, "failed: "+name)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// hasSyncedLyric reports whether the song has an embedded synced lyric
+func hasSyncedLyric(songPath string) (bool, error) {
+
+	tag, err := id3v2.Open(songPath, id3v2.Options{Parse: true})
+	if err != nil {
+		return false, tracerr.Wrap(err)
+	}
+	defer tag.Close()
+
+	for _, f := range tag.GetFrames(tag.CommonID("Synchronised lyrics/text")) {
+		sylf, ok := f.(id3v2.SynchronisedLyricsFrame)
+		if ok && len(sylf.SynchronizedTexts) > 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// fetchLyric matches and embeds the lyric of lang of one song of the batch
+func (b *lyricBatch) fetchLyric(
+	matcher lyric.LyricMatcher, audioFile *player.AudioFile, lang string,
+) {
+
+	name := audioFile.Name()
+
+	synced, err := hasSyncedLyric(audioFile.Path())
+	if err != nil {
+		logError(err)
+		b.failed = append(b.failed, name)
+		return
+	}
+	if synced {
+		b.skipped++
+		return
+	}
+
+	best, ambiguous, err := findLyric(matcher, audioFile.Path())
+	switch {
+	case err != nil:
+		logError(err)
+		b.failed = append(b.failed, name)
+	case best == nil:
+		b.failed = append(b.failed, name)
+	case ambiguous:
+		b.ambiguous = append(b.ambiguous, name)
+	default:
+		err = embedMatch(audioFile.Path(), lang, best)
+		if err != nil {
+			logError(err)
+			b.failed = append(b.failed, name)
+			return
+		}
+		b.matched = append(b.matched, name)
+	}
+}
+
+// fetchLyrics matches and embeds the lyrics of lang of the songs without a
+// synced lyric in a background job, the progress is shown in the title of the
+// playlist and a summary at the end
+func fetchLyrics(audioFiles []*player.AudioFile, lang string) {
+
+	matcher, err := lyricMatcher(lang)
+	if err != nil {
+		errorPopup(err)
+		return
+	}
+
+	name := fmt.Sprintf("%s lyrics of %d songs", lang, len(audioFiles))
+
+	gomu.jobs.submit("lyric", name, func(ctx context.Context, j *Job) error {
+
+		batch := &lyricBatch{total: len(audioFiles)}
+		j.setProgress(0, batch.total)
+
+		for _, audioFile := range audioFiles {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			j.setStatus("%s", audioFile.Name())
+			batch.fetchLyric(matcher, audioFile, lang)
+			j.setProgress(batch.processed(), batch.total)
+		}
+
+		summary := batch.summary()
+		gomu.app.QueueUpdateDraw(func() {
+			height := strings.Count(summary, "\n") + 6
+			if height > 20 {
+				height = 20
+			}
+			timedPopup(" Lyrics ", summary, getPopupTimeout(), 70, height)
+		})
+
+		return nil
+	})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/issadarkthing/gomu/lyric"
+	"github.com/issadarkthing/gomu/player"
+)
+
+func TestLyricBatch(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+
+	// one lyric per title, "Twice" has two different lyrics as long as the song
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("track_name") {
+		case "Found":
+			fmt.Fprint(w, `[{"id": 1, "duration": 180, "syncedLyrics": "[00:01.00]found"}]`)
+		case "Twice":
+			fmt.Fprint(w, `[{"id": 1, "duration": 180, "syncedLyrics": "[00:01.00]one"},
+				{"id": 2, "duration": 180, "syncedLyrics": "[00:01.00]two"}]`)
+		default:
+			fmt.Fprint(w, `[]`)
+		}
+	}))
+	defer server.Close()
+
+	_, err := gomu.anko.Execute(fmt.Sprintf(`General.lyric_urls = {"lrclib": "%s"}`, server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var audioFiles []*player.AudioFile
+	for _, title := range []string{"Found", "Twice", "Missing", "Synced"} {
+		songPath, remove := taggedSong(t, "Artist", title, "")
+		defer remove()
+
+		audioFile := new(player.AudioFile)
+		audioFile.SetPath(songPath)
+		audioFile.SetName(title)
+		audioFiles = append(audioFiles, audioFile)
+	}
+
+	var synced lyric.Lyric
+	err = synced.NewFromLRC("[00:01.00]already synced")
+	if err != nil {
+		t.Fatal(err)
+	}
+	synced.LangExt = "en"
+	err = embedLyric(audioFiles[3].Path(), &synced, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matcher, err := lyricMatcher("en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch := &lyricBatch{total: len(audioFiles)}
+	for _, audioFile := range audioFiles {
+		batch.fetchLyric(matcher, audioFile, "en")
+	}
+
+	assert.Equal(t, []string{"Found"}, batch.matched)
+	assert.Equal(t, []string{"Twice"}, batch.ambiguous)
+	assert.Equal(t, []string{"Missing"}, batch.failed)
+	assert.Equal(t, 1, batch.skipped)
+	assert.Equal(t, 4, batch.processed())
+	assert.Equal(t, "1 matched, 1 ambiguous, 1 failed, 1 skipped\n"+
+		"ambiguous: Twice\nfailed: Missing", batch.summary())
+
+	// only the matched song is embedded
+	found, err := hasSyncedLyric(audioFiles[0].Path())
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	found, err = hasSyncedLyric(audioFiles[1].Path())
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
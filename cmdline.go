@@ -0,0 +1,380 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ztrue/tracerr"
+)
+
+// argKind is the type of argument accepted by a command
+type argKind int
+
+const (
+	// argNumber is an integer, a leading + or - makes it relative
+	argNumber argKind = iota
+	// argSeconds is a number of seconds or mm:ss, a leading + or - makes it
+	// relative
+	argSeconds
+	// argPath is a file path, it is completed from the filesystem
+	argPath
+	// argText takes the rest of the command line
+	argText
+)
+
+// argSpec describes an argument of a command
+type argSpec struct {
+	name string
+	kind argKind
+}
+
+// cmdArg is an argument parsed from the command line
+type cmdArg struct {
+	text string
+	num  int
+	// relative is true if the number was prefixed with + or -
+	relative bool
+}
+
+// exCommand is a command that takes arguments. These can be run from the
+// command line e.g. "seek +30" or "playlist new Chill".
+type exCommand struct {
+	args []argSpec
+	fn   func(args []cmdArg) error
+}
+
+// defineEx defines a command with arguments, name can contain spaces for sub
+// commands.
+func (c *Command) defineEx(name string, args []argSpec, callBack func([]cmdArg) error) {
+	c.exCommands[name] = exCommand{args: args, fn: callBack}
+}
+
+// names returns the name of all commands sorted.
+func (c Command) names() []string {
+
+	names := make([]string, 0, len(c.commands)+len(c.exCommands))
+	for name := range c.commands {
+		names = append(names, name)
+	}
+	for name := range c.exCommands {
+		// commands such as rename can be run with or without arguments
+		if _, ok := c.commands[name]; !ok {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// execute parses the command line and runs the command.
+func (c Command) execute(line string) error {
+
+	name, ex, args, err := c.parse(line)
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+
+	if ex == nil {
+		fn, err := c.getFn(name)
+		if err != nil {
+			return tracerr.Wrap(err)
+		}
+		fn()
+		return nil
+	}
+
+	return ex.fn(args)
+}
+
+// parse splits the command line into the command and its arguments.
+func (c Command) parse(line string) (string, *exCommand, []cmdArg, error) {
+
+	tokens, err := tokenize(line)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	if len(tokens) == 0 {
+		return "", nil, nil, tracerr.New("no command given")
+	}
+
+	// longest name is matched first to support sub commands
+	for n := len(tokens); n > 0; n-- {
+		name := strings.Join(tokens[:n], " ")
+
+		ex, ok := c.exCommands[name]
+		if !ok {
+			continue
+		}
+
+		// without arguments, the command taking no arguments is preferred
+		if _, ok := c.commands[name]; ok && n == len(tokens) {
+			break
+		}
+
+		args, err := parseArgs(name, ex.args, tokens[n:])
+		if err != nil {
+			return "", nil, nil, err
+		}
+
+		return name, &ex, args, nil
+	}
+
+	name := tokens[0]
+	if _, ok := c.commands[name]; !ok {
+		return "", nil, nil, tracerr.Errorf("command not found: %s", name)
+	}
+
+	if len(tokens) > 1 {
+		return "", nil, nil, tracerr.Errorf("%s takes no arguments", name)
+	}
+
+	return name, nil, nil, nil
+}
+
+// parseArgs converts tokens into arguments according to specs.
+func parseArgs(name string, specs []argSpec, tokens []string) ([]cmdArg, error) {
+
+	args := make([]cmdArg, 0, len(specs))
+
+	for i, spec := range specs {
+
+		if i >= len(tokens) {
+			return nil, tracerr.Errorf("%s: missing argument <%s>", name, spec.name)
+		}
+
+		token := tokens[i]
+		arg := cmdArg{text: token}
+
+		switch spec.kind {
+		case argNumber, argSeconds:
+			num, relative, err := parseNumber(token, spec.kind == argSeconds)
+			if err != nil {
+				return nil, tracerr.Errorf("%s: invalid <%s>: %s", name, spec.name, token)
+			}
+			arg.num = num
+			arg.relative = relative
+
+		case argPath:
+			arg.text = expandTilde(token)
+
+		case argText:
+			arg.text = strings.Join(tokens[i:], " ")
+			return append(args, arg), nil
+		}
+
+		args = append(args, arg)
+	}
+
+	if len(tokens) > len(specs) {
+		return nil, tracerr.Errorf("%s: too many arguments", name)
+	}
+
+	return args, nil
+}
+
+// parseNumber parses integers such as 40, +30 or -10. When minutes is true,
+// mm:ss is accepted as well and converted to seconds.
+func parseNumber(s string, minutes bool) (int, bool, error) {
+
+	var relative bool
+	sign := 1
+
+	switch {
+	case strings.HasPrefix(s, "+"):
+		relative = true
+		s = s[1:]
+	case strings.HasPrefix(s, "-"):
+		relative = true
+		sign = -1
+		s = s[1:]
+	}
+
+	var num int
+
+	parts := strings.Split(s, ":")
+	if len(parts) > 2 || (len(parts) == 2 && !minutes) {
+		return 0, false, tracerr.Errorf("invalid number: %s", s)
+	}
+
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return 0, false, tracerr.Errorf("invalid number: %s", s)
+		}
+		num = num*60 + n
+	}
+
+	return sign * num, relative, nil
+}
+
+// tokenize splits the command line by spaces. Quotes and backslash can be used
+// to include spaces in an argument.
+func tokenize(line string) ([]string, error) {
+
+	var tokens []string
+	var token strings.Builder
+	var quote rune
+	var escaped, inToken bool
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			token.WriteRune(r)
+			escaped = false
+
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inToken = true
+
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				token.WriteRune(r)
+			}
+
+		case r == '"' || r == '\'':
+			quote = r
+			inToken = true
+
+		case r == ' ' || r == '\t':
+			if inToken {
+				tokens = append(tokens, token.String())
+				token.Reset()
+				inToken = false
+			}
+
+		default:
+			token.WriteRune(r)
+			inToken = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, tracerr.New("unterminated quote")
+	}
+
+	if inToken {
+		tokens = append(tokens, token.String())
+	}
+
+	return tokens, nil
+}
+
+// complete returns the possible command lines for tab completion. Command names
+// and path arguments are completed, relative paths are completed from root.
+func (c Command) complete(line string, root string) []string {
+
+	var completions []string
+
+	trimmed := strings.TrimLeft(line, " ")
+	for _, name := range c.names() {
+		if strings.HasPrefix(name, trimmed) && name != trimmed {
+			completions = append(completions, name)
+		}
+	}
+
+	if len(completions) > 0 {
+		return completions
+	}
+
+	// the last token is being completed
+	tokens, err := tokenize(line)
+	if err != nil || len(tokens) == 0 {
+		return nil
+	}
+
+	last := ""
+	if !strings.HasSuffix(line, " ") || strings.HasSuffix(line, "\\ ") {
+		last = tokens[len(tokens)-1]
+		tokens = tokens[:len(tokens)-1]
+	}
+
+	for n := len(tokens); n > 0; n-- {
+
+		ex, ok := c.exCommands[strings.Join(tokens[:n], " ")]
+		if !ok {
+			continue
+		}
+
+		index := len(tokens) - n
+		if index >= len(ex.args) || ex.args[index].kind != argPath {
+			return nil
+		}
+
+		// quoted arguments are not completed
+		if !strings.HasSuffix(line, escapeSpaces(last)) {
+			return nil
+		}
+
+		prefix := strings.TrimSuffix(line, escapeSpaces(last))
+		for _, path := range completePath(last, root) {
+			completions = append(completions, prefix+escapeSpaces(path))
+		}
+
+		return completions
+	}
+
+	return nil
+}
+
+// completePath lists the files starting with path. Directories end with a
+// slash.
+func completePath(path string, root string) []string {
+
+	dir, base := filepath.Split(path)
+
+	searchDir := expandTilde(dir)
+	if !filepath.IsAbs(searchDir) {
+		searchDir = filepath.Join(root, searchDir)
+	}
+
+	files, err := ioutil.ReadDir(searchDir)
+	if err != nil {
+		return nil
+	}
+
+	var paths []string
+	for _, file := range files {
+		name := file.Name()
+		if !strings.HasPrefix(name, base) {
+			continue
+		}
+		// hidden files are only listed when asked for
+		if strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".") {
+			continue
+		}
+		if file.IsDir() {
+			name += "/"
+		}
+		paths = append(paths, dir+name)
+	}
+
+	return paths
+}
+
+func escapeSpaces(s string) string {
+	return strings.ReplaceAll(s, " ", "\\ ")
+}
+
+// commonPrefix returns the longest prefix shared by all strings.
+func commonPrefix(strs []string) string {
+
+	if len(strs) == 0 {
+		return ""
+	}
+
+	prefix := strs[0]
+	for _, s := range strs[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	return prefix
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenize(t *testing.T) {
+
+	tests := map[string][]string{
+		"seek +30":                 {"seek", "+30"},
+		"  volume   40 ":           {"volume", "40"},
+		`add ~/Music/foo\ bar`:     {"add", "~/Music/foo bar"},
+		`add "Daft Punk/One More"`: {"add", "Daft Punk/One More"},
+		`rename 'it\'s'`:           nil,
+	}
+
+	for line, expected := range tests {
+		got, err := tokenize(line)
+		if expected == nil {
+			assert.Error(t, err, line)
+			continue
+		}
+		assert.NoError(t, err, line)
+		assert.Equal(t, expected, got, line)
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+
+	tests := []struct {
+		input    string
+		minutes  bool
+		num      int
+		relative bool
+		err      bool
+	}{
+		{"40", false, 40, false, false},
+		{"+30", false, 30, true, false},
+		{"-10", false, -10, true, false},
+		{"1:30", true, 90, false, false},
+		{"-1:05", true, -65, true, false},
+		{"1:30", false, 0, false, true},
+		{"abc", false, 0, false, true},
+		{"1:2:3", true, 0, false, true},
+	}
+
+	for _, test := range tests {
+		num, relative, err := parseNumber(test.input, test.minutes)
+		if test.err {
+			assert.Error(t, err, test.input)
+			continue
+		}
+		assert.NoError(t, err, test.input)
+		assert.Equal(t, test.num, num, test.input)
+		assert.Equal(t, test.relative, relative, test.input)
+	}
+}
+
+func TestExecute(t *testing.T) {
+
+	c := newCommand()
+
+	var got []cmdArg
+	var called string
+
+	c.define("skip", func() { called = "skip" })
+	c.define("rename", func() { called = "rename" })
+	c.defineEx("rename", []argSpec{{"name", argText}}, func(args []cmdArg) error {
+		called, got = "rename ex", args
+		return nil
+	})
+	c.defineEx("seek", []argSpec{{"seconds", argSeconds}}, func(args []cmdArg) error {
+		called, got = "seek", args
+		return nil
+	})
+	c.defineEx("playlist new", []argSpec{{"name", argText}}, func(args []cmdArg) error {
+		called, got = "playlist new", args
+		return nil
+	})
+
+	assert.NoError(t, c.execute("skip"))
+	assert.Equal(t, "skip", called)
+
+	assert.NoError(t, c.execute("seek +1:30"))
+	assert.Equal(t, "seek", called)
+	assert.Equal(t, []cmdArg{{text: "+1:30", num: 90, relative: true}}, got)
+
+	assert.NoError(t, c.execute("playlist new Chill Out"))
+	assert.Equal(t, "playlist new", called)
+	assert.Equal(t, "Chill Out", got[0].text)
+
+	assert.NoError(t, c.execute("rename"))
+	assert.Equal(t, "rename", called)
+
+	assert.NoError(t, c.execute("rename new name"))
+	assert.Equal(t, "rename ex", called)
+	assert.Equal(t, "new name", got[0].text)
+
+	assert.Error(t, c.execute("seek"))
+	assert.Error(t, c.execute("seek abc"))
+	assert.Error(t, c.execute("seek 1 2"))
+	assert.Error(t, c.execute("skip 2"))
+	assert.Error(t, c.execute("unknown"))
+	assert.Error(t, c.execute(""))
+}
+
+func TestComplete(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "gomu-complete")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, dir := range []string{"Daft Punk", "Deftones", ".hidden"} {
+		err := os.Mkdir(filepath.Join(root, dir), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = ioutil.WriteFile(filepath.Join(root, "Daft Punk", "One More Time.mp3"), nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newCommand()
+	c.define("skip", func() {})
+	c.define("shuffle_queue", func() {})
+	c.defineEx("seek", []argSpec{{"seconds", argSeconds}}, nil)
+	c.defineEx("add", []argSpec{{"path", argPath}}, nil)
+
+	assert.Equal(t, []string{"seek", "shuffle_queue", "skip"}, c.complete("s", root))
+	assert.Equal(t, []string{"shuffle_queue"}, c.complete("sh", root))
+	assert.Nil(t, c.complete("seek ", root))
+
+	assert.Equal(t, []string{`add Daft\ Punk/`, "add Deftones/"}, c.complete("add ", root))
+	assert.Equal(t, []string{`add Daft\ Punk/`}, c.complete("add Da", root))
+	assert.Equal(t,
+		[]string{`add Daft\ Punk/One\ More\ Time.mp3`},
+		c.complete(`add Daft\ Punk/`, root),
+	)
+	assert.Equal(t, []string{"add .hidden/"}, c.complete("add .", root))
+}
+
+func TestCommonPrefix(t *testing.T) {
+	assert.Equal(t, "add D", commonPrefix([]string{"add Daft", "add Deftones"}))
+	assert.Equal(t, "", commonPrefix(nil))
+}
@@ -20,60 +20,74 @@ type Colors struct {
 	playlistDir tcell.Color
 	queueHi     tcell.Color
 	subtitle    string
+	visualizer  tcell.Color
 }
 
 func init() {
 	tcell.ColorNames["none"] = tcell.ColorDefault
 }
 
-func newColor() *Colors {
+// defaultColors are used when the Color module has an invalid color
+var defaultColors = map[string]string{
+	"Color.accent":             "darkcyan",
+	"Color.background":         "none",
+	"Color.foreground":         "white",
+	"Color.popup":              "black",
+	"Color.playlist_directory": "darkcyan",
+	"Color.playlist_highlight": "darkcyan",
+	"Color.queue_highlight":    "darkcyan",
+	"Color.now_playing_title":  "darkgreen",
+	"Color.subtitle":           "darkgoldenrod",
+	"Color.visualizer":         "darkcyan",
+}
 
-	defaultColors := map[string]string{
-		"Color.accent":             "darkcyan",
-		"Color.background":         "none",
-		"Color.foreground":         "white",
-		"Color.popup":              "black",
-		"Color.playlist_directory": "darkcyan",
-		"Color.playlist_highlight": "darkcyan",
-		"Color.queue_highlight":    "darkcyan",
-		"Color.now_playing_title":  "darkgreen",
-		"Color.subtitle":           "darkgoldenrod",
+// parseColor accepts color names and hex colors e.g. #88c0d0, ok is false for
+// invalid colors
+func parseColor(value string) (color tcell.Color, ok bool) {
+	if validHexColor(value) {
+		return tcell.GetColor(value), true
 	}
+	color, ok = tcell.ColorNames[value]
+	return color, ok
+}
 
-	anko := gomu.anko
-
-	// checks for invalid color and set default fallback
-	for k, v := range defaultColors {
+func newColor() *Colors {
 
-		// color from the config file
-		cfgColor := anko.GetString(k)
+	anko := gomu.anko
 
-		if _, ok := tcell.ColorNames[cfgColor]; !ok {
-			// use default value if invalid hex color was given
-			anko.Set(k, v)
+	// checks for invalid color and use default fallback
+	get := func(key string) (tcell.Color, string) {
+		value := anko.GetString(key)
+		color, ok := parseColor(value)
+		if !ok {
+			value = defaultColors[key]
+			color, _ = parseColor(value)
 		}
+		return color, value
 	}
 
-	accent := anko.GetString("Color.accent")
-	background := anko.GetString("Color.background")
-	foreground := anko.GetString("Color.foreground")
-	popup := anko.GetString("Color.popup")
-	playlistDir := anko.GetString("Color.playlist_directory")
-	playlistHi := anko.GetString("Color.playlist_highlight")
-	queueHi := anko.GetString("Color.queue_highlight")
-	title := anko.GetString("Color.now_playing_title")
-	subtitle := anko.GetString("Color.subtitle")
+	accent, _ := get("Color.accent")
+	background, _ := get("Color.background")
+	foreground, _ := get("Color.foreground")
+	popup, _ := get("Color.popup")
+	playlistDir, _ := get("Color.playlist_directory")
+	playlistHi, _ := get("Color.playlist_highlight")
+	queueHi, _ := get("Color.queue_highlight")
+	title, _ := get("Color.now_playing_title")
+	_, subtitle := get("Color.subtitle")
+	visualizer, _ := get("Color.visualizer")
 
 	color := &Colors{
-		accent:      tcell.ColorNames[accent],
-		foreground:  tcell.ColorNames[foreground],
-		background:  tcell.ColorNames[background],
-		popup:       tcell.ColorNames[popup],
-		playlistDir: tcell.ColorNames[playlistDir],
-		playlistHi:  tcell.ColorNames[playlistHi],
-		queueHi:     tcell.ColorNames[queueHi],
-		title:       tcell.ColorNames[title],
+		accent:      accent,
+		foreground:  foreground,
+		background:  background,
+		popup:       popup,
+		playlistDir: playlistDir,
+		playlistHi:  playlistHi,
+		queueHi:     queueHi,
+		title:       title,
 		subtitle:    subtitle,
+		visualizer:  visualizer,
 	}
 	return color
 }
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"reflect"
 	"sync"
 
+	"github.com/gdamore/tcell/v2"
 	"github.com/issadarkthing/gomu/player"
 	"github.com/rivo/tview"
 	"github.com/ztrue/tracerr"
@@ -10,12 +12,14 @@ import (
 
 // Command map string to actual command function
 type Command struct {
-	commands map[string]func()
+	commands   map[string]func()
+	exCommands map[string]exCommand
 }
 
 func newCommand() Command {
 	return Command{
-		commands: make(map[string]func()),
+		commands:   make(map[string]func()),
+		exCommands: make(map[string]exCommand),
 	}
 }
 
@@ -31,6 +35,24 @@ func (c Command) getFn(name string) (func(), error) {
 	return fn, nil
 }
 
+// nameOf returns the name of the command fn refers to, or an empty string if
+// fn is not a command.
+func (c Command) nameOf(fn interface{}) string {
+
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return ""
+	}
+
+	for name, cmd := range c.commands {
+		if reflect.ValueOf(cmd).Pointer() == v.Pointer() {
+			return name
+		}
+	}
+
+	return ""
+}
+
 func (c Command) defineCommands() {
 
 	anko := gomu.anko
@@ -88,6 +110,13 @@ func (c Command) defineCommands() {
 		}
 	})
 
+	c.define("download_history", func() {
+		err := historyPopup()
+		if err != nil {
+			errorPopup(err)
+		}
+	})
+
 	c.define("add_queue", func() {
 		audioFile := gomu.playlist.getCurrentFile()
 		currNode := gomu.playlist.GetCurrentNode()
@@ -187,6 +216,17 @@ func (c Command) defineCommands() {
 			errorPopup(err)
 		}
 
+		err = gomu.layout.load()
+		if err != nil {
+			errorPopup(err)
+		}
+
+		err = loadColors()
+		if err != nil {
+			errorPopup(err)
+		}
+		applyColors()
+
 		infoPopup("successfully reload config file")
 	})
 
@@ -200,6 +240,14 @@ func (c Command) defineCommands() {
 		gomu.queue.prev()
 	})
 
+	c.define("move_top", func() {
+		gomu.queue.top()
+	})
+
+	c.define("move_bottom", func() {
+		gomu.queue.bottom()
+	})
+
 	c.define("delete_item", func() {
 		gomu.queue.deleteItem(gomu.queue.GetCurrentItem())
 	})
@@ -207,9 +255,22 @@ func (c Command) defineCommands() {
 	c.define("clear_queue", func() {
 		confirmationPopup("Are you sure to clear the queue?",
 			func(_ int, label string) {
-				if label == "yes" {
-					gomu.queue.clearQueue()
+				if label != "yes" {
+					return
 				}
+
+				items := gomu.queue.items
+				gomu.queue.clearQueue()
+
+				gomu.journal.record("clear queue",
+					func() error {
+						gomu.queue.restoreItems(items)
+						return nil
+					},
+					func() error {
+						gomu.queue.clearQueue()
+						return nil
+					})
 			})
 	})
 
@@ -235,6 +296,36 @@ func (c Command) defineCommands() {
 		gomu.queue.updateTitle()
 	})
 
+	c.define("toggle_visualizer", func() {
+		gomu.visualizer.toggle()
+	})
+
+	c.define("toggle_lyrics", func() {
+		if !gomu.lyrics.toggle() {
+			defaultTimedPopup(" Lyrics ", "The layout has no lyrics panel")
+		}
+	})
+
+	c.define("lyrics_down", func() {
+		gomu.lyrics.move(1)
+	})
+
+	c.define("lyrics_up", func() {
+		gomu.lyrics.move(-1)
+	})
+
+	c.define("lyrics_seek", func() {
+		err := gomu.lyrics.seek()
+		if err != nil {
+			errorPopup(err)
+		}
+	})
+
+	c.define("cycle_layout", func() {
+		name := gomu.layout.cycle()
+		defaultTimedPopup(" Layout ", name)
+	})
+
 	c.define("shuffle_queue", func() {
 		gomu.queue.shuffle()
 	})
@@ -275,6 +366,24 @@ func (c Command) defineCommands() {
 		exitConfirmation(gomu.args)
 	})
 
+	c.define("undo", func() {
+		desc, err := gomu.journal.undo()
+		if err != nil {
+			errorPopup(err)
+			return
+		}
+		defaultTimedPopup(" Undo ", desc)
+	})
+
+	c.define("redo", func() {
+		desc, err := gomu.journal.redo()
+		if err != nil {
+			errorPopup(err)
+			return
+		}
+		defaultTimedPopup(" Redo ", desc)
+	})
+
 	c.define("toggle_pause", func() {
 		gomu.player.TogglePause()
 	})
@@ -312,12 +421,21 @@ func (c Command) defineCommands() {
 
 	c.define("command_search", func() {
 
-		names := make([]string, 0, len(c.commands))
+		names := make([]string, 0, len(c.commands)+len(c.exCommands))
 		for commandName := range c.commands {
 			names = append(names, commandName)
 		}
+		for commandName := range c.exCommands {
+			names = append(names, commandName)
+		}
 		searchPopup("Commands", names, func(selected string) {
 
+			// commands with arguments are completed in the command line
+			if _, ok := c.exCommands[selected]; ok {
+				commandLinePopup(selected + " ")
+				return
+			}
+
 			for name, fn := range c.commands {
 				if name == selected {
 					fn()
@@ -326,68 +444,24 @@ func (c Command) defineCommands() {
 		})
 	})
 
+	c.define("command_line", func() {
+		commandLinePopup("")
+	})
+
 	c.define("forward", func() {
-		if gomu.player.IsRunning() && !gomu.player.IsPaused() {
-			position := gomu.playingBar.getProgress() + 10
-			if position < gomu.playingBar.getFull() {
-				err := gomu.player.Seek(position)
-				if err != nil {
-					errorPopup(err)
-				}
-				gomu.playingBar.setProgress(position)
-			}
-		}
+		seekRelative(10)
 	})
 
 	c.define("rewind", func() {
-		if gomu.player.IsRunning() && !gomu.player.IsPaused() {
-			position := gomu.playingBar.getProgress() - 10
-			if position-1 > 0 {
-				err := gomu.player.Seek(position)
-				if err != nil {
-					errorPopup(err)
-				}
-				gomu.playingBar.setProgress(position)
-			} else {
-				err := gomu.player.Seek(0)
-				if err != nil {
-					errorPopup(err)
-				}
-				gomu.playingBar.setProgress(0)
-			}
-		}
+		seekRelative(-10)
 	})
 
 	c.define("forward_fast", func() {
-		if gomu.player.IsRunning() && !gomu.player.IsPaused() {
-			position := gomu.playingBar.getProgress() + 60
-			if position < gomu.playingBar.getFull() {
-				err := gomu.player.Seek(position)
-				if err != nil {
-					errorPopup(err)
-				}
-				gomu.playingBar.setProgress(position)
-			}
-		}
+		seekRelative(60)
 	})
 
 	c.define("rewind_fast", func() {
-		if gomu.player.IsRunning() && !gomu.player.IsPaused() {
-			position := gomu.playingBar.getProgress() - 60
-			if position-1 > 0 {
-				err := gomu.player.Seek(position)
-				if err != nil {
-					errorPopup(err)
-				}
-				gomu.playingBar.setProgress(position)
-			} else {
-				err := gomu.player.Seek(0)
-				if err != nil {
-					errorPopup(err)
-				}
-				gomu.playingBar.setProgress(0)
-			}
-		}
+		seekRelative(-60)
 	})
 
 	c.define("yank", func() {
@@ -416,10 +490,70 @@ func (c Command) defineCommands() {
 		}
 	})
 
+	c.define("toggle_select", func() {
+		gomu.playlist.toggleSelect(gomu.playlist.GetCurrentNode())
+		gomu.playlist.InputHandler()(
+			tcell.NewEventKey(tcell.KeyDown, 0, tcell.ModNone), nil)
+	})
+
+	c.define("clear_selection", func() {
+		gomu.playlist.clearSelection()
+	})
+
+	c.define("batch_edit_tags", func() {
+		audioFiles := gomu.playlist.getSelectedFiles()
+		if len(audioFiles) == 0 {
+			errorPopup(tracerr.New("no audio file selected"))
+			return
+		}
+		err := batchTagPopup(audioFiles)
+		if err != nil {
+			errorPopup(err)
+		}
+	})
+
+	c.define("rename_by_tags", func() {
+		audioFiles := gomu.playlist.getSelectedFiles()
+		if len(audioFiles) == 0 {
+			errorPopup(tracerr.New("no audio file selected"))
+			return
+		}
+		err := renameByTagsPopup(audioFiles)
+		if err != nil {
+			errorPopup(err)
+		}
+	})
+
 	c.define("switch_lyric", func() {
 		gomu.playingBar.switchLyrics()
 	})
 
+	c.define("jobs", func() {
+		jobsPopup()
+	})
+
+	c.define("dual_lyric", func() {
+		p := gomu.playingBar
+		if p.subtitle == nil {
+			defaultTimedPopup(" Dual lyric ", "No lyric is shown")
+			return
+		}
+
+		langs := []string{"off"}
+		for _, v := range p.subtitles {
+			if v != p.subtitle {
+				langs = append(langs, v.LangExt)
+			}
+		}
+
+		searchPopup(" Second lyric ", langs, func(selected string) {
+			if selected == "off" {
+				selected = ""
+			}
+			p.setSecondary(selected)
+		})
+	})
+
 	c.define("fetch_lyric", func() {
 		audioFile := gomu.playlist.getCurrentFile()
 		lang := "en"
@@ -427,8 +561,14 @@ func (c Command) defineCommands() {
 		var wg sync.WaitGroup
 		wg.Add(1)
 		if audioFile.IsAudioFile() {
+			// the provider is chosen by language in General.lang_lyric
+			fetcher, err := lyricFetcher(lang)
+			if err != nil {
+				errorPopup(err)
+				return
+			}
 			go func() {
-				err := lyricPopup(lang, audioFile, &wg)
+				err := lyricPopup(lang, fetcher, audioFile, &wg)
 				if err != nil {
 					errorPopup(err)
 				}
@@ -443,8 +583,14 @@ func (c Command) defineCommands() {
 		var wg sync.WaitGroup
 		wg.Add(1)
 		if audioFile.IsAudioFile() {
+			// the provider is chosen by language in General.lang_lyric
+			fetcher, err := lyricFetcher(lang)
+			if err != nil {
+				errorPopup(err)
+				return
+			}
 			go func() {
-				err := lyricPopup(lang, audioFile, &wg)
+				err := lyricPopup(lang, fetcher, audioFile, &wg)
 				if err != nil {
 					errorPopup(err)
 				}
@@ -452,6 +598,22 @@ func (c Command) defineCommands() {
 		}
 	})
 
+	c.define("fetch_lyric_auto", func() {
+		audioFile := gomu.playlist.getCurrentFile()
+		if audioFile.IsAudioFile() {
+			autoLyric(audioFile, "en")
+		}
+	})
+
+	c.define("fetch_lyric_bulk", func() {
+		audioFiles := gomu.playlist.getSelectedFiles()
+		if len(audioFiles) == 0 {
+			errorPopup(tracerr.New("no audio file selected"))
+			return
+		}
+		fetchLyrics(audioFiles, "en")
+	})
+
 	c.define("lyric_delay_increase", func() {
 		err := gomu.playingBar.delayLyric(500)
 		if err != nil {
@@ -466,6 +628,45 @@ func (c Command) defineCommands() {
 		}
 	})
 
+	c.define("sync_lyric", func() {
+		lrcEditorPopup()
+	})
+
+	c.define("export_lyrics", func() {
+		audioFiles := gomu.playlist.getSelectedFiles()
+		if len(audioFiles) == 0 {
+			errorPopup(tracerr.New("no audio file selected"))
+			return
+		}
+		exportSidecars(audioFiles, false)
+	})
+
+	c.define("import_lyrics", func() {
+		audioFiles := gomu.playlist.getSelectedFiles()
+		if len(audioFiles) == 0 {
+			errorPopup(tracerr.New("no audio file selected"))
+			return
+		}
+		importSidecars(audioFiles)
+	})
+
+	c.define("theme_select", func() {
+		names, err := themeNames(expandTilde(themesDir))
+		if err != nil {
+			errorPopup(err)
+			return
+		}
+
+		searchPopup("Themes", names, func(selected string) {
+			err := setTheme(selected)
+			if err != nil {
+				errorPopup(err)
+				return
+			}
+			defaultTimedPopup(" Theme ", selected)
+		})
+	})
+
 	c.define("show_colors", func() {
 		cp := colorsPopup()
 		gomu.pages.AddPage("show-color-popup", center(cp, 95, 40), true, true)
@@ -479,4 +680,165 @@ func (c Command) defineCommands() {
 		}
 	}
 
+	c.defineExCommands()
+}
+
+// defineExCommands defines the commands that take arguments, these are run
+// from the command line.
+func (c Command) defineExCommands() {
+
+	c.defineEx("seek", []argSpec{{"[+-]seconds|mm:ss", argSeconds}},
+		func(args []cmdArg) error {
+			if args[0].relative {
+				seekRelative(args[0].num)
+				return nil
+			}
+			return seekTo(args[0].num)
+		})
+
+	c.defineEx("volume", []argSpec{{"[+-]volume", argNumber}},
+		func(args []cmdArg) error {
+			current := player.VolToHuman(gomu.player.GetVolume())
+			v := args[0].num
+			if args[0].relative {
+				v += current
+			}
+
+			if v < 0 {
+				v = 0
+			} else if v > 100 {
+				v = 100
+			}
+
+			vol := gomu.player.SetVolume(player.AbsVolume(v) - gomu.player.GetVolume())
+			volumePopup(vol)
+			return nil
+		})
+
+	c.defineEx("add", []argSpec{{"path", argPath}}, func(args []cmdArg) error {
+
+		node := gomu.playlist.findNode(args[0].text)
+		if node == nil {
+			return tracerr.Errorf("not found in playlist: %s", args[0].text)
+		}
+
+		audioFile := node.GetReference().(*player.AudioFile)
+		if audioFile.IsAudioFile() {
+			_, err := gomu.queue.enqueue(audioFile)
+			if err != nil {
+				return tracerr.Wrap(err)
+			}
+		} else {
+			gomu.playlist.addAllToQueue(node)
+		}
+
+		if len(gomu.queue.items) > 0 && !gomu.player.IsRunning() {
+			return gomu.queue.playQueue()
+		}
+
+		return nil
+	})
+
+	c.defineEx("layout", []argSpec{{"name", argText}}, func(args []cmdArg) error {
+		return gomu.layout.set(args[0].text)
+	})
+
+	c.defineEx("lyric", []argSpec{{"lang", argText}}, func(args []cmdArg) error {
+
+		audioFile := gomu.playlist.getCurrentFile()
+		if !audioFile.IsAudioFile() {
+			return tracerr.New("not an audio file")
+		}
+
+		fetcher, err := lyricFetcher(args[0].text)
+		if err != nil {
+			return tracerr.Wrap(err)
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			err := lyricPopup(args[0].text, fetcher, audioFile, &wg)
+			if err != nil {
+				errorPopup(err)
+			}
+		}()
+
+		return nil
+	})
+
+	c.defineEx("theme", []argSpec{{"name", argText}}, func(args []cmdArg) error {
+		return setTheme(args[0].text)
+	})
+
+	c.defineEx("playlist new", []argSpec{{"name", argText}},
+		func(args []cmdArg) error {
+			return gomu.playlist.createPlaylist(args[0].text)
+		})
+
+	c.defineEx("rename", []argSpec{{"name", argText}}, func(args []cmdArg) error {
+
+		audioFile := gomu.playlist.getCurrentFile()
+		err := gomu.playlist.rename(args[0].text)
+		if err != nil {
+			return tracerr.Wrap(err)
+		}
+		gomu.playlist.refresh()
+
+		return gomu.playlist.refreshAfterRename(audioFile, args[0].text)
+	})
+
+	c.defineEx("download", []argSpec{{"url", argText}}, func(args []cmdArg) error {
+
+		node := gomu.playlist.GetCurrentNode()
+		audioFile := gomu.playlist.getCurrentFile()
+		// this ensures it downloads to the correct dir
+		if audioFile.IsAudioFile() {
+			node = audioFile.ParentNode()
+		}
+
+		downloadURL(args[0].text, node)
+
+		return nil
+	})
+}
+
+// seekRelative moves the playing position by the given seconds.
+func seekRelative(seconds int) {
+	if !gomu.player.IsRunning() || gomu.player.IsPaused() {
+		return
+	}
+
+	position := gomu.playingBar.getProgress() + seconds
+	if position >= gomu.playingBar.getFull() {
+		return
+	}
+
+	if position < 0 {
+		position = 0
+	}
+
+	err := seekTo(position)
+	if err != nil {
+		errorPopup(err)
+	}
+}
+
+// seekTo moves the playing position to the given second.
+func seekTo(position int) error {
+	if !gomu.player.IsRunning() || gomu.player.IsPaused() {
+		return nil
+	}
+
+	if position < 0 || position >= gomu.playingBar.getFull() {
+		return tracerr.Errorf("position out of range: %d", position)
+	}
+
+	err := gomu.player.Seek(position)
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+	gomu.playingBar.setProgress(position)
+
+	return nil
 }
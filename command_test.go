@@ -22,3 +22,20 @@ func TestGetFn(t *testing.T) {
 	f, err = c.getFn("x")
 	assert.Error(t, err)
 }
+
+func TestNameOf(t *testing.T) {
+
+	c := newCommand()
+
+	c.define("first", func() {})
+	c.define("second", func() {})
+
+	f, err := c.getFn("second")
+	if err != nil {
+		t.Error(err)
+	}
+
+	assert.Equal(t, "second", c.nameOf(f))
+	assert.Equal(t, "", c.nameOf(func() {}))
+	assert.Equal(t, "", c.nameOf(nil))
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+
+	"github.com/disintegration/imaging"
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/tramhao/id3v2"
+	"github.com/ztrue/tracerr"
+)
+
+// coverFiles are the image files used as cover when the song has no embedded
+// cover, in order of preference
+var coverFiles = []string{
+	"cover.jpg", "cover.jpeg", "cover.png", "folder.jpg", "folder.jpeg", "folder.png",
+}
+
+// coverSize is the maximum width and height of embedded covers
+const coverSize = 500
+
+// readCover returns the embedded cover of the song, or the cover image in the
+// directory of the song when it has none or it cannot be decoded. source
+// describes where the cover comes from, it is empty if no cover is found.
+func readCover(songPath string) (img image.Image, source string, err error) {
+
+	tag, err := id3v2.Open(songPath, id3v2.Options{Parse: true})
+	if err != nil {
+		return nil, "", tracerr.Wrap(err)
+	}
+	defer tag.Close()
+
+	for _, f := range tag.GetFrames(tag.CommonID("Attached picture")) {
+		pic, ok := f.(id3v2.PictureFrame)
+		if !ok {
+			continue
+		}
+
+		img, err := imaging.Decode(bytes.NewReader(pic.Picture))
+		if err != nil {
+			logError(tracerr.Wrap(err))
+			continue
+		}
+
+		return img, "embedded", nil
+	}
+
+	return readCoverFile(filepath.Dir(songPath))
+}
+
+// readCoverFile returns the first cover image found in dir and its name
+func readCoverFile(dir string) (image.Image, string, error) {
+
+	for _, name := range coverFiles {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+
+		img, err := imaging.Open(path, imaging.AutoOrientation(true))
+		if err != nil {
+			return nil, "", tracerr.Wrap(err)
+		}
+
+		return img, name, nil
+	}
+
+	return nil, "", nil
+}
+
+// embedCover replaces the embedded cover of the song with the image, the image
+// is resized to fit coverSize.
+func embedCover(songPath, imagePath string) error {
+
+	img, err := imaging.Open(imagePath, imaging.AutoOrientation(true))
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() > coverSize || bounds.Dy() > coverSize {
+		img = imaging.Fit(img, coverSize, coverSize, imaging.Lanczos)
+	}
+
+	var buf bytes.Buffer
+	err = imaging.Encode(&buf, img, imaging.JPEG, imaging.JPEGQuality(90))
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+
+	tag, err := id3v2.Open(songPath, id3v2.Options{Parse: true})
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+	defer tag.Close()
+
+	tag.DeleteFrames(tag.CommonID("Attached picture"))
+	tag.AddAttachedPicture(id3v2.PictureFrame{
+		Encoding:    tag.DefaultEncoding(),
+		MimeType:    "image/jpeg",
+		PictureType: id3v2.PTFrontCover,
+		Description: "Front cover",
+		Picture:     buf.Bytes(),
+	})
+
+	return tracerr.Wrap(tag.Save())
+}
+
+// extractCover saves the cover of the song as cover.jpg in the directory of the
+// song and returns its path. An existing cover.jpg is moved to the trash so
+// that it can be restored with undo.
+func extractCover(songPath string) (string, error) {
+
+	img, source, err := readCover(songPath)
+	if err != nil {
+		return "", tracerr.Wrap(err)
+	}
+
+	if img == nil {
+		return "", tracerr.New("no cover found")
+	}
+
+	path := filepath.Join(filepath.Dir(songPath), "cover.jpg")
+	if source == "cover.jpg" {
+		return path, nil
+	}
+
+	var trashPath string
+	if _, err := os.Stat(path); err == nil {
+		trashPath, err = moveToTrash(path)
+		if err != nil {
+			return "", tracerr.Wrap(err)
+		}
+	}
+
+	err = imaging.Save(img, path, imaging.JPEGQuality(90))
+	if err != nil {
+		if trashPath != "" {
+			logError(movePath(trashPath, path))
+		}
+		return "", tracerr.Wrap(err)
+	}
+
+	if trashPath == "" {
+		return path, nil
+	}
+
+	gomu.journal.record("extract cover to "+path,
+		func() error {
+			err := os.Remove(path)
+			if err != nil {
+				return tracerr.Wrap(err)
+			}
+			return movePath(trashPath, path)
+		},
+		func() error {
+			err := movePath(path, trashPath)
+			if err != nil {
+				return tracerr.Wrap(err)
+			}
+			return tracerr.Wrap(imaging.Save(img, path, imaging.JPEGQuality(90)))
+		})
+
+	return path, nil
+}
+
+// coverView shows the cover of a song. The image is drawn with the renderer set
+// in General.cover_renderer, a description of the cover is shown above it.
+type coverView struct {
+	*tview.TextView
+	img      image.Image
+	source   string
+	renderer coverRenderer
+	// pageID is the page showing the view, the image is hidden when another
+	// page is in front
+	pageID string
+}
+
+func newCoverView(pageID string) *coverView {
+	c := &coverView{
+		TextView: tview.NewTextView(),
+		pageID:   pageID,
+		renderer: newCoverRenderer(gomu.anko.GetString("General.cover_renderer")),
+	}
+	c.SetTextAlign(tview.AlignCenter).
+		SetBorder(true).
+		SetTitle(" Cover ")
+	return c
+}
+
+// load reads the cover of the song
+func (c *coverView) load(songPath string) error {
+
+	img, source, err := readCover(songPath)
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+
+	c.clear()
+	c.img = img
+	c.source = source
+
+	if img == nil {
+		c.SetText("No cover")
+		return nil
+	}
+
+	bounds := img.Bounds()
+	c.SetText(fmt.Sprintf("%s %dx%d", source, bounds.Dx(), bounds.Dy()))
+
+	return nil
+}
+
+// Draw draws the description and the image centered below it
+func (c *coverView) Draw(screen tcell.Screen) {
+	c.TextView.Draw(screen)
+
+	if c.img == nil || c.renderer == nil {
+		return
+	}
+
+	if name, _ := gomu.pages.GetFrontPage(); name != c.pageID {
+		c.clear()
+		return
+	}
+
+	x, y, width, height := c.GetInnerRect()
+	// the first line is used by the description
+	y++
+	height--
+
+	cols, rows := fitCells(c.img, width, height)
+	if cols == 0 || rows == 0 {
+		return
+	}
+
+	c.renderer.draw(screen, c.img, x+(width-cols)/2, y, cols, rows)
+}
+
+// clear removes the image from the screen
+func (c *coverView) clear() {
+	if c.renderer != nil {
+		c.renderer.clear()
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/stretchr/testify/assert"
+	"github.com/tramhao/id3v2"
+)
+
+func TestCover(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+
+	dir, err := ioutil.TempDir("", "gomu-cover")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	songPath := filepath.Join(dir, "song.mp3")
+	err = ioutil.WriteFile(songPath, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, source, err := readCover(songPath)
+	assert.NoError(t, err)
+	assert.Nil(t, img)
+	assert.Equal(t, "", source)
+
+	_, err = extractCover(songPath)
+	assert.Error(t, err)
+
+	// fallback to the image of the directory
+	folder := imaging.New(800, 600, color.White)
+	err = imaging.Save(folder, filepath.Join(dir, "folder.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, source, err = readCover(songPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "folder.png", source)
+	assert.Equal(t, image.Rect(0, 0, 800, 600), img.Bounds())
+
+	// embedded cover is resized
+	err = embedCover(songPath, filepath.Join(dir, "folder.png"))
+	assert.NoError(t, err)
+
+	img, source, err = readCover(songPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "embedded", source)
+	assert.Equal(t, image.Rect(0, 0, coverSize, 375), img.Bounds())
+
+	path, err := extractCover(songPath)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "cover.jpg"), path)
+	assert.FileExists(t, path)
+
+	// the cover overwritten is restored by undo
+	_, err = gomu.anko.Execute(fmt.Sprintf("General.trash_dir = %q", filepath.Join(dir, "trash")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(path, []byte("old cover"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = extractCover(songPath)
+	assert.NoError(t, err)
+	_, err = gomu.journal.undo()
+	assert.NoError(t, err)
+	content, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "old cover", string(content))
+
+	// a cover that cannot be decoded falls back to the image of the directory
+	tag, err := id3v2.Open(songPath, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag.DeleteFrames(tag.CommonID("Attached picture"))
+	tag.AddAttachedPicture(id3v2.PictureFrame{
+		Encoding:    tag.DefaultEncoding(),
+		MimeType:    "image/jpeg",
+		PictureType: id3v2.PTFrontCover,
+		Picture:     []byte("not an image"),
+	})
+	err = tag.Save()
+	tag.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, os.Remove(path))
+
+	_, source, err = readCover(songPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "folder.png", source)
+}
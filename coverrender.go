@@ -0,0 +1,495 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+
+	"github.com/disintegration/imaging"
+	"github.com/gdamore/tcell/v2"
+	"github.com/ztrue/tracerr"
+	ugo "gitlab.com/diamondburned/ueberzug-go"
+)
+
+// cover renderers that can be set in General.cover_renderer
+const (
+	rendererAuto      = "auto"
+	rendererKitty     = "kitty"
+	rendererSixel     = "sixel"
+	rendererUeberzug  = "ueberzug"
+	rendererHalfBlock = "halfblock"
+	rendererNone      = "none"
+)
+
+// coverOutput is where the escape sequences of the terminal graphics are
+// written to
+var coverOutput io.Writer = os.Stdout
+
+// kittyImageID is the last id given to a kitty image
+var kittyImageID uint32
+
+// coverRenderer draws images in a rectangle of cells
+type coverRenderer interface {
+	// draw draws the image stretched to the rectangle, it is called on every
+	// draw of the primitive showing the image
+	draw(screen tcell.Screen, img image.Image, x, y, width, height int)
+	// clear removes the image from the terminal
+	clear()
+}
+
+// newCoverRenderer returns the renderer with the given name, it returns nil if
+// covers are disabled.
+func newCoverRenderer(name string) coverRenderer {
+
+	if name == rendererAuto || name == "" {
+		name = detectRenderer(os.Getenv, exec.LookPath)
+	}
+
+	switch name {
+	case rendererKitty:
+		return &kittyRenderer{id: atomic.AddUint32(&kittyImageID, 1)}
+	case rendererSixel:
+		return &sixelRenderer{}
+	case rendererUeberzug:
+		return &ueberzugRenderer{}
+	case rendererHalfBlock:
+		return &halfBlockRenderer{}
+	case rendererNone:
+		return nil
+	}
+
+	logError(tracerr.Errorf("unknown cover renderer %q, using %s", name, rendererHalfBlock))
+	return &halfBlockRenderer{}
+}
+
+// detectRenderer picks the best renderer supported by the terminal. The half
+// block renderer works everywhere, including over ssh.
+func detectRenderer(getenv func(string) string, lookPath func(string) (string, error)) string {
+
+	term := getenv("TERM")
+	termProgram := getenv("TERM_PROGRAM")
+
+	switch {
+	case getenv("KITTY_WINDOW_ID") != "",
+		strings.Contains(term, "kitty"),
+		strings.Contains(term, "ghostty"),
+		termProgram == "WezTerm",
+		termProgram == "ghostty":
+		return rendererKitty
+
+	case strings.Contains(term, "sixel"),
+		strings.HasPrefix(term, "foot"),
+		strings.HasPrefix(term, "mlterm"),
+		strings.HasPrefix(term, "contour"),
+		strings.HasPrefix(term, "yaft"):
+		return rendererSixel
+	}
+
+	// ueberzug draws an X11 window which is not visible over ssh
+	if getenv("DISPLAY") != "" && getenv("SSH_CONNECTION") == "" {
+		if _, err := lookPath("ueberzug"); err == nil {
+			return rendererUeberzug
+		}
+	}
+
+	return rendererHalfBlock
+}
+
+// cellSize returns the size of a cell in pixels. Terminals that do not report
+// their size in pixels are assumed to use 10x20 cells.
+func cellSize() (int, int) {
+	cols, rows, windowWidth, windowHeight := getConsoleSize()
+	if cols == 0 || rows == 0 || windowWidth == 0 || windowHeight == 0 {
+		return 10, 20
+	}
+	return windowWidth / cols, windowHeight / rows
+}
+
+// fitCells returns the number of columns and rows used by img when it is
+// scaled to fit in width x height cells
+func fitCells(img image.Image, width, height int) (int, int) {
+
+	bounds := img.Bounds()
+	if width <= 0 || height <= 0 || bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return 0, 0
+	}
+
+	colPixel, rowPixel := cellSize()
+
+	scale := float64(width*colPixel) / float64(bounds.Dx())
+	if s := float64(height*rowPixel) / float64(bounds.Dy()); s < scale {
+		scale = s
+	}
+
+	cols := int(float64(bounds.Dx())*scale/float64(colPixel) + 0.5)
+	rows := int(float64(bounds.Dy())*scale/float64(rowPixel) + 0.5)
+
+	return clamp(cols, 1, width), clamp(rows, 1, height)
+}
+
+func clamp(n, low, high int) int {
+	if n < low {
+		return low
+	}
+	if n > high {
+		return high
+	}
+	return n
+}
+
+// blankCells fills the rectangle with spaces so that the text under the image
+// does not change between draws
+func blankCells(screen tcell.Screen, x, y, width, height int) {
+	for row := y; row < y+height; row++ {
+		for col := x; col < x+width; col++ {
+			screen.SetContent(col, row, ' ', nil, tcell.StyleDefault)
+		}
+	}
+}
+
+// writeTerminal writes the escape sequence once the screen has been flushed,
+// otherwise tcell would draw over it
+func writeTerminal(seq []byte) {
+	go gomu.app.QueueUpdate(func() {
+		_, err := coverOutput.Write(seq)
+		if err != nil {
+			logError(err)
+		}
+	})
+}
+
+// placement is the image and the rectangle it was last drawn to
+type placement struct {
+	img                 image.Image
+	x, y, width, height int
+	colPixel, rowPixel  int
+}
+
+func newPlacement(img image.Image, x, y, width, height int) placement {
+	colPixel, rowPixel := cellSize()
+	return placement{img, x, y, width, height, colPixel, rowPixel}
+}
+
+// halfBlockRenderer draws two pixels per cell with the upper half block
+// character, the foreground being the upper pixel and the background the
+// lower one.
+type halfBlockRenderer struct {
+	img    image.Image
+	width  int
+	height int
+	cells  [][][2]tcell.Color
+}
+
+func (h *halfBlockRenderer) draw(screen tcell.Screen, img image.Image, x, y, width, height int) {
+
+	if img != h.img || width != h.width || height != h.height {
+		h.img, h.width, h.height = img, width, height
+		h.cells = halfBlocks(img, width, height)
+	}
+
+	for row, line := range h.cells {
+		for col, cell := range line {
+			style := tcell.StyleDefault.Foreground(cell[0]).Background(cell[1])
+			screen.SetContent(x+col, y+row, '▀', nil, style)
+		}
+	}
+}
+
+func (h *halfBlockRenderer) clear() {}
+
+// halfBlocks returns the colors of the upper and lower halves of each cell
+// when img is stretched to width x height cells
+func halfBlocks(img image.Image, width, height int) [][][2]tcell.Color {
+
+	if width <= 0 || height <= 0 {
+		return nil
+	}
+
+	resized := imaging.Resize(img, width, height*2, imaging.Box)
+
+	cells := make([][][2]tcell.Color, height)
+	for row := range cells {
+		cells[row] = make([][2]tcell.Color, width)
+		for col := range cells[row] {
+			cells[row][col] = [2]tcell.Color{
+				toTcellColor(resized.NRGBAAt(col, row*2)),
+				toTcellColor(resized.NRGBAAt(col, row*2+1)),
+			}
+		}
+	}
+
+	return cells
+}
+
+func toTcellColor(c color.NRGBA) tcell.Color {
+	return tcell.NewRGBColor(int32(c.R), int32(c.G), int32(c.B))
+}
+
+// kittyRenderer draws images with the kitty graphics protocol, supported by
+// kitty, WezTerm and ghostty
+type kittyRenderer struct {
+	id        uint32
+	last      placement
+	displayed bool
+}
+
+func (k *kittyRenderer) draw(screen tcell.Screen, img image.Image, x, y, width, height int) {
+
+	blankCells(screen, x, y, width, height)
+
+	p := newPlacement(img, x, y, width, height)
+	if k.displayed && p == k.last {
+		return
+	}
+
+	// the terminal scales the image, there is no need to send more pixels than
+	// can be shown
+	scaled := imaging.Fit(img, width*p.colPixel, height*p.rowPixel, imaging.Lanczos)
+
+	var buf bytes.Buffer
+	err := imaging.Encode(&buf, scaled, imaging.PNG)
+	if err != nil {
+		logError(err)
+		return
+	}
+
+	var seq bytes.Buffer
+	seq.WriteString(kittyDelete(k.id))
+	fmt.Fprintf(&seq, "\x1b7\x1b[%d;%dH", y+1, x+1)
+	seq.Write(kittyImage(k.id, buf.Bytes(), width, height))
+	seq.WriteString("\x1b8")
+
+	writeTerminal(seq.Bytes())
+	k.last = p
+	k.displayed = true
+}
+
+func (k *kittyRenderer) clear() {
+	if !k.displayed {
+		return
+	}
+	writeTerminal([]byte(kittyDelete(k.id)))
+	k.displayed = false
+}
+
+// kittyImage returns the escape sequences transmitting the png and displaying
+// it at the cursor in cols x rows cells
+func kittyImage(id uint32, png []byte, cols, rows int) []byte {
+
+	// the payload is sent in chunks of at most 4096 bytes
+	const chunkSize = 4096
+
+	data := base64.StdEncoding.EncodeToString(png)
+
+	var seq bytes.Buffer
+	for first := true; first || len(data) > 0; first = false {
+		chunk := data
+		if len(chunk) > chunkSize {
+			chunk = chunk[:chunkSize]
+		}
+		data = data[len(chunk):]
+
+		more := 0
+		if len(data) > 0 {
+			more = 1
+		}
+
+		if first {
+			// C=1 keeps the cursor in place, q=2 suppresses responses
+			fmt.Fprintf(&seq, "\x1b_Ga=T,f=100,i=%d,c=%d,r=%d,C=1,q=2,m=%d;%s\x1b\\",
+				id, cols, rows, more, chunk)
+		} else {
+			fmt.Fprintf(&seq, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+		}
+	}
+
+	return seq.Bytes()
+}
+
+// kittyDelete returns the escape sequence deleting the image and its data
+func kittyDelete(id uint32) string {
+	return fmt.Sprintf("\x1b_Ga=d,d=I,i=%d,q=2\x1b\\", id)
+}
+
+// sixelRenderer draws images with sixel graphics, supported by foot, mlterm,
+// xterm -ti vt340 and others
+type sixelRenderer struct {
+	last      placement
+	displayed bool
+}
+
+func (s *sixelRenderer) draw(screen tcell.Screen, img image.Image, x, y, width, height int) {
+
+	// the image stays until the cells under it are drawn again
+	blankCells(screen, x, y, width, height)
+
+	p := newPlacement(img, x, y, width, height)
+	if s.displayed && p == s.last {
+		return
+	}
+
+	scaled := imaging.Resize(img, width*p.colPixel, height*p.rowPixel, imaging.Lanczos)
+
+	var seq bytes.Buffer
+	fmt.Fprintf(&seq, "\x1b7\x1b[%d;%dH", y+1, x+1)
+	seq.Write(encodeSixel(scaled))
+	seq.WriteString("\x1b8")
+
+	writeTerminal(seq.Bytes())
+	s.last = p
+	s.displayed = true
+}
+
+func (s *sixelRenderer) clear() {
+	if !s.displayed {
+		return
+	}
+	// sixel images cannot be deleted, redraw the whole screen instead
+	go gomu.app.Sync()
+	s.displayed = false
+}
+
+// encodeSixel encodes the image as sixel data using the web safe palette
+func encodeSixel(img image.Image) []byte {
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	paletted := image.NewPaletted(image.Rect(0, 0, width, height), palette.WebSafe)
+	draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), img, bounds.Min)
+
+	var buf bytes.Buffer
+	// P2=1 leaves pixels without color unchanged, the raster attributes set
+	// the aspect ratio to 1:1 and the size of the image
+	fmt.Fprintf(&buf, "\x1bP0;1;0q\"1;1;%d;%d", width, height)
+
+	used := make([]bool, len(palette.WebSafe))
+	for _, index := range paletted.Pix {
+		used[index] = true
+	}
+
+	for index, c := range palette.WebSafe {
+		if !used[index] {
+			continue
+		}
+		r, g, b, _ := c.RGBA()
+		fmt.Fprintf(&buf, "#%d;2;%d;%d;%d", index,
+			r*100/0xffff, g*100/0xffff, b*100/0xffff)
+	}
+
+	sixels := make([]byte, width)
+
+	// each band is 6 pixels high, every color of the band is drawn on its own
+	// pass over the same band
+	for top := 0; top < height; top += 6 {
+
+		var colors []uint8
+		seen := make(map[uint8]bool)
+		for row := top; row < top+6 && row < height; row++ {
+			for _, index := range paletted.Pix[row*paletted.Stride : row*paletted.Stride+width] {
+				if !seen[index] {
+					seen[index] = true
+					colors = append(colors, index)
+				}
+			}
+		}
+
+		for i, index := range colors {
+			for col := range sixels {
+				var bits byte
+				for bit := 0; bit < 6 && top+bit < height; bit++ {
+					if paletted.ColorIndexAt(col, top+bit) == index {
+						bits |= 1 << bit
+					}
+				}
+				sixels[col] = '?' + bits
+			}
+
+			fmt.Fprintf(&buf, "#%d", index)
+			writeSixelRuns(&buf, sixels)
+
+			// go back to the start of the band for the next color
+			if i < len(colors)-1 {
+				buf.WriteByte('$')
+			}
+		}
+
+		buf.WriteByte('-')
+	}
+
+	buf.WriteString("\x1b\\")
+
+	return buf.Bytes()
+}
+
+// writeSixelRuns writes the sixels compressed with the repeat introducer
+func writeSixelRuns(buf *bytes.Buffer, sixels []byte) {
+
+	for i := 0; i < len(sixels); {
+		j := i
+		for j < len(sixels) && sixels[j] == sixels[i] {
+			j++
+		}
+
+		if n := j - i; n > 3 {
+			fmt.Fprintf(buf, "!%d%c", n, sixels[i])
+		} else {
+			buf.Write(sixels[i:j])
+		}
+
+		i = j
+	}
+}
+
+// ueberzugRenderer draws images in an X11 window placed over the terminal. It
+// falls back to half blocks when ueberzug cannot be started.
+type ueberzugRenderer struct {
+	photo    *ugo.Image
+	last     placement
+	fallback *halfBlockRenderer
+}
+
+func (u *ueberzugRenderer) draw(screen tcell.Screen, img image.Image, x, y, width, height int) {
+
+	if u.fallback != nil {
+		u.fallback.draw(screen, img, x, y, width, height)
+		return
+	}
+
+	p := newPlacement(img, x, y, width, height)
+	if u.photo != nil && p == u.last {
+		return
+	}
+	u.clear()
+
+	scaled := imaging.Resize(img, width*p.colPixel, height*p.rowPixel, imaging.Lanczos)
+
+	photo, err := ugo.NewImage(scaled, x*p.colPixel, y*p.rowPixel)
+	if err != nil {
+		logError(err)
+		u.fallback = &halfBlockRenderer{}
+		u.fallback.draw(screen, img, x, y, width, height)
+		return
+	}
+
+	u.photo = photo
+	u.photo.Show()
+	u.last = p
+}
+
+func (u *ueberzugRenderer) clear() {
+	if u.photo != nil {
+		u.photo.Clear()
+		u.photo.Destroy()
+		u.photo = nil
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/gdamore/tcell/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectRenderer(t *testing.T) {
+
+	found := func(string) (string, error) { return "/usr/bin/ueberzug", nil }
+	notFound := func(string) (string, error) { return "", errors.New("not found") }
+
+	tests := []struct {
+		env      map[string]string
+		lookPath func(string) (string, error)
+		expected string
+	}{
+		{map[string]string{"TERM": "xterm-kitty"}, found, rendererKitty},
+		{map[string]string{"TERM": "xterm-256color", "TERM_PROGRAM": "WezTerm"}, found, rendererKitty},
+		{map[string]string{"TERM": "foot"}, found, rendererSixel},
+		{map[string]string{"TERM": "xterm-256color", "DISPLAY": ":0"}, found, rendererUeberzug},
+		{map[string]string{"TERM": "xterm-256color", "DISPLAY": ":0"}, notFound, rendererHalfBlock},
+		// ueberzug windows are not visible over ssh
+		{map[string]string{"TERM": "xterm-256color", "DISPLAY": "localhost:10.0",
+			"SSH_CONNECTION": "10.0.0.1 22 10.0.0.2 22"}, found, rendererHalfBlock},
+		{map[string]string{"TERM": "linux"}, found, rendererHalfBlock},
+	}
+
+	for _, test := range tests {
+		getenv := func(key string) string { return test.env[key] }
+		assert.Equal(t, test.expected, detectRenderer(getenv, test.lookPath), test.env)
+	}
+}
+
+func TestHalfBlocks(t *testing.T) {
+
+	// red on the upper half, blue on the lower half
+	img := imaging.New(4, 4, color.NRGBA{0, 0, 255, 255})
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			img.Set(x, y, color.NRGBA{255, 0, 0, 255})
+		}
+	}
+
+	cells := halfBlocks(img, 2, 1)
+	assert.Len(t, cells, 1)
+	assert.Len(t, cells[0], 2)
+
+	for _, cell := range cells[0] {
+		assert.Equal(t, tcell.NewRGBColor(255, 0, 0), cell[0])
+		assert.Equal(t, tcell.NewRGBColor(0, 0, 255), cell[1])
+	}
+
+	assert.Nil(t, halfBlocks(img, 0, 1))
+}
+
+func TestEncodeSixel(t *testing.T) {
+
+	img := imaging.New(3, 7, color.White)
+	img.Set(0, 6, color.Black)
+
+	data := string(encodeSixel(img))
+
+	assert.True(t, strings.HasPrefix(data, "\x1bP0;1;0q\"1;1;3;7"))
+	assert.True(t, strings.HasSuffix(data, "\x1b\\"))
+
+	// black and white are the first and last colors of the web safe palette
+	assert.Contains(t, data, "#0;2;0;0;0")
+	assert.Contains(t, data, "#215;2;100;100;100")
+
+	// the first band is white, the second has a black pixel then two white
+	assert.Contains(t, data, "#215~~~-")
+	assert.Contains(t, data, "#0@??$#215?@@-")
+}
+
+func TestWriteSixelRuns(t *testing.T) {
+
+	var buf bytes.Buffer
+	writeSixelRuns(&buf, []byte("~~~~~@@@?"))
+	assert.Equal(t, "!5~@@@?", buf.String())
+}
+
+func TestKittyImage(t *testing.T) {
+
+	png := bytes.Repeat([]byte{1}, 4000)
+	seq := string(kittyImage(7, png, 20, 10))
+
+	// 4000 bytes are 5336 bytes of base64, sent in two chunks
+	chunks := strings.Split(strings.TrimSuffix(seq, "\x1b\\"), "\x1b\\")
+	assert.Len(t, chunks, 2)
+	assert.True(t, strings.HasPrefix(chunks[0], "\x1b_Ga=T,f=100,i=7,c=20,r=10,C=1,q=2,m=1;"))
+	assert.True(t, strings.HasPrefix(chunks[1], "\x1b_Gm=0;"))
+
+	assert.Equal(t, "\x1b_Ga=d,d=I,i=7,q=2\x1b\\", kittyDelete(7))
+}
+
+func TestFitCells(t *testing.T) {
+
+	img := image.NewNRGBA(image.Rect(0, 0, 100, 100))
+
+	cols, rows := fitCells(img, 30, 40)
+	assert.Equal(t, 30, cols)
+	assert.True(t, rows < 40)
+
+	cols, rows = fitCells(img, 0, 40)
+	assert.Equal(t, 0, cols)
+	assert.Equal(t, 0, rows)
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/ztrue/tracerr"
+)
+
+// downloaders are the programs tried in order when General.downloader is auto
+var downloaders = []string{"yt-dlp", "youtube-dl"}
+
+// progressRe matches the progress lines of youtube-dl and yt-dlp e.g.
+// "[download]  45.3% of ~3.45MiB at  1.23MiB/s ETA 00:02"
+var progressRe = regexp.MustCompile(
+	`^\[download\]\s+([\d.]+)% of\s+~?\s*(\S+)(?:\s+at\s+(.+?))?(?:\s+ETA\s+(\S+))?(?:\s+\(frag .*\))?$`)
+
+// downloadProgress is the state of a download parsed from the output of the
+// downloader
+type downloadProgress struct {
+	percent float64
+	size    string
+	speed   string
+	eta     string
+}
+
+func (p downloadProgress) String() string {
+	s := fmt.Sprintf("%.1f%% of %s", p.percent, p.size)
+	if p.speed != "" && !strings.HasPrefix(p.speed, "Unknown") {
+		s += " at " + p.speed
+	}
+	if p.eta != "" && p.eta != "Unknown" {
+		s += " ETA " + p.eta
+	}
+	return s
+}
+
+// parseProgress parses a progress line of the downloader
+func parseProgress(line string) (downloadProgress, bool) {
+
+	m := progressRe.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return downloadProgress{}, false
+	}
+
+	percent, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return downloadProgress{}, false
+	}
+
+	return downloadProgress{
+		percent: percent,
+		size:    m[2],
+		speed:   strings.TrimSpace(m[3]),
+		eta:     m[4],
+	}, true
+}
+
+// Downloader runs youtube-dl or a program accepting the same arguments such
+// as yt-dlp
+type Downloader struct {
+	exe string
+	// format and quality of the extracted audio
+	format  string
+	quality string
+	// output is the name template of the files, relative to the playlist
+	output string
+	// args are added to the arguments of gomu
+	args []string
+}
+
+// newDownloader returns the downloader set in General.downloader, auto picks
+// the first one of downloaders in $PATH
+func newDownloader() (*Downloader, error) {
+
+	d := &Downloader{
+		exe:     gomu.anko.GetString("General.downloader"),
+		format:  gomu.anko.GetString("General.audio_format"),
+		quality: gomu.anko.GetString("General.audio_quality"),
+		output:  gomu.anko.GetString("General.output_template"),
+	}
+
+	if d.format == "" {
+		d.format = "mp3"
+	}
+	if d.output == "" {
+		d.output = "%(title)s.%(ext)s"
+	}
+
+	value, err := gomu.anko.Execute("General.downloader_args")
+	if err == nil {
+		args, _ := value.([]interface{})
+		for _, arg := range args {
+			d.args = append(d.args, fmt.Sprint(arg))
+		}
+	}
+
+	if d.exe == "" || d.exe == "auto" {
+		for _, exe := range downloaders {
+			if _, err := exec.LookPath(exe); err == nil {
+				d.exe = exe
+				return d, nil
+			}
+		}
+		return nil, tracerr.Errorf("%s is not in your $PATH", strings.Join(downloaders, " or "))
+	}
+
+	d.exe = expandTilde(d.exe)
+	if _, err := exec.LookPath(d.exe); err != nil {
+		return nil, tracerr.Errorf("%s is not in your $PATH", d.exe)
+	}
+
+	return d, nil
+}
+
+// downloadConfig is the config of the downloads, it is read before the jobs
+// start as anko cannot be used from them
+type downloadConfig struct {
+	downloader *Downloader
+	// history is the path of the history of downloads
+	history string
+	// keepLrc keeps the .lrc files downloaded with the audio
+	keepLrc bool
+	// lang is the preferred language of the lyrics
+	lang string
+}
+
+func newDownloadConfig() (*downloadConfig, error) {
+
+	downloader, err := newDownloader()
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+
+	return &downloadConfig{
+		downloader: downloader,
+		history:    historyPath(),
+		keepLrc:    gomu.anko.GetBool("General.keep_lrc"),
+		lang:       defaultLyricLang(),
+	}, nil
+}
+
+// ytDlp reports whether the downloader is yt-dlp, some of the arguments of
+// youtube-dl are deprecated in yt-dlp
+func (d *Downloader) ytDlp() bool {
+	return strings.HasPrefix(filepath.Base(d.exe), "yt-dlp")
+}
+
+// arguments returns the arguments downloading the audio of url to dir
+func (d *Downloader) arguments(url, dir string) []string {
+
+	args := []string{
+		"--newline",
+		"--no-playlist",
+		"--extract-audio",
+		"--audio-format", d.format,
+		"--output", filepath.Join(dir, d.output),
+		"--add-metadata",
+		"--embed-thumbnail",
+	}
+
+	if d.quality != "" {
+		args = append(args, "--audio-quality", d.quality)
+	}
+
+	if d.ytDlp() {
+		args = append(args, "--parse-metadata", "title:%(artist)s - %(title)s",
+			"--write-subs")
+	} else {
+		args = append(args, "--metadata-from-title", "%(artist)s - %(title)s",
+			"--write-sub")
+	}
+
+	args = append(args, "--all-subs", "--convert-subs", "lrc")
+	args = append(args, d.args...)
+
+	return append(args, url)
+}
+
+// download downloads the audio of url to dir and returns the path of the
+// audio file. progress is called with every progress line and the downloader
+// and the programs it runs are killed when ctx is done.
+func (d *Downloader) download(
+	ctx context.Context, url, dir string, progress func(downloadProgress),
+) (string, error) {
+
+	cmd := exec.Command(d.exe, d.arguments(url, dir)...)
+	// the downloader runs ffmpeg, they are killed together
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", tracerr.Wrap(err)
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return "", tracerr.Wrap(err)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		case <-stop:
+		}
+	}()
+
+	output := readProgress(stdout, progress)
+
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return "", tracerr.Wrap(ctx.Err())
+	}
+	if err != nil {
+		return "", tracerr.Errorf("%s: %v: %s", filepath.Base(d.exe), err,
+			lastLine(stderr.String()))
+	}
+
+	audioPath := extractFilePath(output, dir)
+	if audioPath == "" {
+		return "", tracerr.Errorf("%s did not report the downloaded file", filepath.Base(d.exe))
+	}
+
+	return audioPath, nil
+}
+
+// readProgress reads the output of the downloader until it ends, the lines
+// are split on carriage returns as well for downloaders ignoring --newline
+func readProgress(r io.Reader, progress func(downloadProgress)) []byte {
+
+	var output bytes.Buffer
+
+	scanner := bufio.NewScanner(r)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if p, ok := parseProgress(line); ok {
+			if progress != nil {
+				progress(p)
+			}
+			continue
+		}
+		output.WriteString(line + "\n")
+	}
+
+	// the rest of the output is discarded so that the downloader is not
+	// blocked when a line is too long
+	io.Copy(ioutil.Discard, r)
+
+	return output.Bytes()
+}
+
+// lastLine returns the last line which is not empty, the error of youtube-dl
+// is printed last
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
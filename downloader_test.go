@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDownloader writes its arguments to args.txt and reports the progress
+// like yt-dlp. The url selects what it does: fail exits with an error, slow
+// waits to be killed and any other url creates song.mp3 in the output
+// directory.
+const fakeDownloader = `#!/bin/sh
+echo "$@" > "$(dirname "$0")/args.txt"
+while [ $# -gt 0 ]; do
+	case "$1" in
+	--output) output="$2"; shift ;;
+	esac
+	url="$1"
+	shift
+done
+dir="$(dirname "$output")"
+
+echo "[youtube] abc: Downloading webpage"
+printf '[download]   0.0%% of    3.00MiB at  Unknown B/s ETA Unknown\r'
+printf '[download]  50.0%% of    3.00MiB at    1.00MiB/s ETA 00:02\n'
+
+case "$url" in
+*fail*)
+	echo "WARNING: retrying" >&2
+	echo "ERROR: Video unavailable" >&2
+	exit 1 ;;
+*slow*)
+	sleep 10 ;;
+esac
+
+printf '[download] 100%% of    3.00MiB at    1.50MiB/s ETA 00:00\n'
+echo "[ExtractAudio] Destination: $dir/song.mp3"
+touch "$dir/song.mp3"
+`
+
+// fakeDownloaderDir creates a fake downloader running script in a temporary
+// directory and sets it in General.downloader, the directory is removed by the
+// returned function
+func fakeDownloaderDir(t *testing.T, name, script string) (string, func()) {
+
+	dir, err := ioutil.TempDir("", "gomu-downloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exe := filepath.Join(dir, name)
+	err = ioutil.WriteFile(exe, []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = gomu.anko.Execute(fmt.Sprintf(`General.downloader = "%s"`, exe))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestParseProgress(t *testing.T) {
+
+	tests := map[string]downloadProgress{
+		"[download]  45.3% of 3.45MiB at 1.23MiB/s ETA 00:02": {
+			percent: 45.3, size: "3.45MiB", speed: "1.23MiB/s", eta: "00:02",
+		},
+		"[download]   0.0% of ~   4.01MiB at  Unknown B/s ETA Unknown (frag 0/12)": {
+			percent: 0, size: "4.01MiB", speed: "Unknown B/s", eta: "Unknown",
+		},
+		"[download] 100% of 2.54MiB": {
+			percent: 100, size: "2.54MiB",
+		},
+	}
+
+	for line, expected := range tests {
+		got, ok := parseProgress(line)
+		assert.True(t, ok, line)
+		assert.Equal(t, expected, got, line)
+	}
+
+	for _, line := range []string{
+		"[download] Destination: /tmp/song.webm",
+		"[download] 100% of 2.54MiB in 00:02",
+	} {
+		_, ok := parseProgress(line)
+		assert.False(t, ok, line)
+	}
+
+	p := downloadProgress{percent: 45.3, size: "3.45MiB", speed: "1.23MiB/s", eta: "00:02"}
+	assert.Equal(t, "45.3% of 3.45MiB at 1.23MiB/s ETA 00:02", p.String())
+}
+
+func TestDownloaderArguments(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+
+	_, err := gomu.anko.Execute(`General.downloader_args = ["--cookies", "cookies.txt"]
+General.audio_format = "opus"
+General.audio_quality = "0"
+General.output_template = "%(uploader)s - %(title)s.%(ext)s"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, remove := fakeDownloaderDir(t, "yt-dlp", fakeDownloader)
+	defer remove()
+
+	d, err := newDownloader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, d.ytDlp())
+
+	args := strings.Join(d.arguments("https://youtu.be/abc", "/music"), " ")
+	assert.Contains(t, args, "--audio-format opus")
+	assert.Contains(t, args, "--audio-quality 0")
+	assert.Contains(t, args, "--output /music/%(uploader)s - %(title)s.%(ext)s")
+	assert.Contains(t, args, "--parse-metadata")
+	assert.True(t, strings.HasSuffix(args, "--cookies cookies.txt https://youtu.be/abc"))
+
+	// youtube-dl gets the arguments it knows
+	d.exe = "youtube-dl"
+	args = strings.Join(d.arguments("https://youtu.be/abc", "/music"), " ")
+	assert.Contains(t, args, "--metadata-from-title")
+	assert.NotContains(t, args, "--parse-metadata")
+
+	_, err = gomu.anko.Execute(`General.downloader = "gomu-missing-downloader"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = newDownloader()
+	assert.Error(t, err)
+}
+
+func TestDownloaderDownload(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+
+	dir, remove := fakeDownloaderDir(t, "fake-dl", fakeDownloader)
+	defer remove()
+
+	d, err := newDownloader()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var progress []string
+	record := func(p downloadProgress) {
+		mu.Lock()
+		progress = append(progress, p.String())
+		mu.Unlock()
+	}
+
+	audioPath, err := d.download(context.Background(), "https://youtu.be/abc", dir, record)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "song.mp3"), audioPath)
+	assert.FileExists(t, audioPath)
+	assert.Equal(t, []string{
+		"0.0% of 3.00MiB",
+		"50.0% of 3.00MiB at 1.00MiB/s ETA 00:02",
+		"100.0% of 3.00MiB at 1.50MiB/s ETA 00:00",
+	}, progress)
+
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args.txt"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(args), "--newline")
+
+	// the last line of the error output explains the failure
+	_, err = d.download(context.Background(), "https://youtu.be/fail", dir, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "ERROR: Video unavailable")
+}
+
+func TestDownloaderCancel(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+
+	dir, remove := fakeDownloaderDir(t, "fake-dl", fakeDownloader)
+	defer remove()
+
+	d, err := newDownloader()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{}, 3)
+
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	start := time.Now()
+	_, err = d.download(ctx, "https://youtu.be/slow", dir, func(p downloadProgress) {
+		started <- struct{}{}
+	})
+
+	// the child processes of the downloader are killed as well
+	assert.Error(t, err)
+	assert.Less(t, int64(time.Since(start)), int64(5*time.Second))
+	assert.NoFileExists(t, filepath.Join(dir, "song.mp3"))
+}
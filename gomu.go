@@ -18,10 +18,13 @@ var gomu *Gomu
 type Gomu struct {
 	app        *tview.Application
 	playingBar *PlayingBar
+	visualizer *Visualizer
+	lyrics     *Lyrics
 	queue      *Queue
 	playlist   *Playlist
 	player     *player.Player
 	pages      *tview.Pages
+	layout     *Layout
 	colors     *Colors
 	command    Command
 	// popups is used to manage focus between popups and panels
@@ -31,6 +34,12 @@ type Gomu struct {
 	args      Args
 	anko      *anko.Anko
 	hook      *hook.EventHook
+	// keys keeps track of multi-key bindings being typed
+	keys *anko.Sequence
+	// journal records destructive operations so that they can be undone
+	journal *Journal
+	// jobs runs downloads, lyric fetches and scripts in the background
+	jobs *Jobs
 }
 
 // Creates new instance of gomu with default values
@@ -40,6 +49,8 @@ func newGomu() *Gomu {
 		command: newCommand(),
 		anko:    anko.NewAnko(),
 		hook:    hook.NewEventHook(),
+		journal: newJournal(journalLimit),
+		jobs:    newJobs(func(string) int { return 1 }),
 	}
 
 	return gomu
@@ -51,10 +62,13 @@ func newGomu() *Gomu {
 func (g *Gomu) initPanels(app *tview.Application, args Args) {
 	g.app = app
 	g.playingBar = newPlayingBar()
+	g.visualizer = newVisualizer()
+	g.lyrics = newLyrics()
 	g.queue = newQueue()
 	g.playlist = newPlaylist(args)
 	g.player = player.New(g.anko.GetInt("General.volume"))
 	g.pages = tview.NewPages()
+	g.layout = newLayout()
 	g.panels = []Panel{g.playlist, g.queue, g.playingBar}
 }
 
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ztrue/tracerr"
+
+	"github.com/issadarkthing/gomu/player"
+)
+
+const (
+	historyDone     = "done"
+	historyFailed   = "failed"
+	historyCanceled = "canceled"
+)
+
+// historyEntry is a download recorded in General.history_path, one json object
+// per line. Older versions wrote the url alone, such lines are read as done
+// downloads without path nor date.
+type historyEntry struct {
+	URL     string    `json:"url"`
+	VideoID string    `json:"video_id,omitempty"`
+	Title   string    `json:"title,omitempty"`
+	Path    string    `json:"path,omitempty"`
+	Date    time.Time `json:"date"`
+	Status  string    `json:"status"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// historyPath returns the path of the history of downloads
+func historyPath() string {
+	return expandTilde(gomu.anko.GetString("General.history_path"))
+}
+
+// newHistoryEntry records the download of url to audioPath, err is the error
+// of the download if it failed
+func newHistoryEntry(url, title, audioPath string, err error) historyEntry {
+
+	entry := historyEntry{
+		URL:     url,
+		VideoID: videoID(url),
+		Title:   title,
+		Path:    audioPath,
+		Date:    time.Now(),
+		Status:  historyDone,
+	}
+
+	if audioPath != "" {
+		entry.Title = getName(audioPath)
+	}
+
+	if err != nil {
+		entry.Status = historyFailed
+		entry.Error = err.Error()
+	}
+
+	return entry
+}
+
+// key identifies the video of the entry, its url if it has no video id
+func (e historyEntry) key() string {
+	if e.VideoID != "" {
+		return e.VideoID
+	}
+	return strings.TrimSpace(e.URL)
+}
+
+// missing reports whether the audio of a done download has been removed
+func (e historyEntry) missing() bool {
+	if e.Status != historyDone || e.Path == "" {
+		return false
+	}
+	_, err := os.Stat(e.Path)
+	return os.IsNotExist(err)
+}
+
+// state is the status of the entry, missing if the audio has been removed
+func (e historyEntry) state() string {
+	if e.missing() {
+		return "missing"
+	}
+	return e.Status
+}
+
+// readHistory returns the downloads recorded in the history in the order
+// they were made, the history is empty before the first download
+func readHistory(path string) ([]historyEntry, error) {
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+	defer f.Close()
+
+	var entries []historyEntry
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(line, "{") {
+			entries = append(entries, historyEntry{
+				URL:     line,
+				VideoID: videoID(line),
+				Status:  historyDone,
+			})
+			continue
+		}
+
+		var entry historyEntry
+		err = json.Unmarshal([]byte(line), &entry)
+		if err != nil {
+			logError(tracerr.Wrap(err))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, tracerr.Wrap(scanner.Err())
+}
+
+// appendHistory records the entry at the end of the history
+func appendHistory(path string, entry historyEntry) error {
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+
+	return appendFile(path, string(line)+"\n")
+}
+
+// libraryPath returns the path relative to the music directory
+func libraryPath(path string) string {
+	root := gomu.playlist.GetRoot().GetReference().(*player.AudioFile).Path()
+	rel, err := filepath.Rel(root, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
+
+// lastDownload returns the latest done download of the video of url
+func lastDownload(entries []historyEntry, url string) (historyEntry, bool) {
+
+	key := historyEntry{URL: url, VideoID: videoID(url)}.key()
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Status == historyDone && entries[i].key() == key {
+			return entries[i], true
+		}
+	}
+
+	return historyEntry{}, false
+}
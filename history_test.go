@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistory(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "gomu-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	songPath := filepath.Join(dir, "music", "One.mp3")
+	gonePath := filepath.Join(dir, "music", "Two.mp3")
+	err = os.MkdirAll(filepath.Dir(songPath), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(songPath, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the history of older versions holds urls only
+	historyPath := filepath.Join(dir, "share", "urls")
+	err = os.MkdirAll(filepath.Dir(historyPath), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(historyPath, []byte("https://youtu.be/v0\n\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range []historyEntry{
+		newHistoryEntry("https://www.youtube.com/watch?v=v1", "", songPath, nil),
+		newHistoryEntry("https://youtu.be/v2", "Two", gonePath, nil),
+		newHistoryEntry("https://youtu.be/v3", "Three", "", errors.New("Video unavailable")),
+	} {
+		assert.NoError(t, appendHistory(historyPath, entry))
+	}
+
+	entries, err := readHistory(historyPath)
+	assert.NoError(t, err)
+	if !assert.Len(t, entries, 4) {
+		return
+	}
+
+	assert.Equal(t, "v0", entries[0].VideoID)
+	assert.Equal(t, historyDone, entries[0].Status)
+	assert.True(t, entries[0].Date.IsZero())
+
+	assert.Equal(t, "One", entries[1].Title)
+	assert.Equal(t, songPath, entries[1].Path)
+	assert.False(t, entries[1].Date.IsZero())
+	assert.Equal(t, historyDone, entries[1].state())
+
+	// the audio of the second download has been removed
+	assert.Equal(t, "missing", entries[2].state())
+
+	assert.Equal(t, historyFailed, entries[3].state())
+	assert.Equal(t, "Video unavailable", entries[3].Error)
+
+	// the same video is found from another url
+	entry, ok := lastDownload(entries, "https://youtu.be/v1")
+	assert.True(t, ok)
+	assert.Equal(t, songPath, entry.Path)
+
+	_, ok = lastDownload(entries, "https://youtu.be/v3")
+	assert.False(t, ok)
+
+	// failed downloads are downloaded again with the playlist
+	downloaded, err := downloadedURLs(historyPath)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"v0": true, "v1": true, "v2": true}, downloaded)
+
+	// the directory of the history is created by the first download
+	newPath := filepath.Join(dir, "new", "urls")
+	assert.NoError(t, appendHistory(newPath, entry))
+	entries, err = readHistory(newPath)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	entries, err = readHistory(filepath.Join(dir, "missing"))
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestHistoryTable(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+
+	dir, err := ioutil.TempDir("", "gomu-history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	songPath := filepath.Join(dir, "One.mp3")
+	err = ioutil.WriteFile(songPath, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []historyEntry{
+		{URL: "https://youtu.be/v1", Title: "One", Status: historyDone},
+		{URL: "https://youtu.be/v2", Title: "Two", Path: filepath.Join(dir, "Two.mp3"), Status: historyDone},
+		{URL: "https://youtu.be/v3", Title: "Three", Path: songPath, Status: historyDone},
+	}
+
+	table := &historyTable{entries: entries}
+
+	// the latest download is shown first
+	shown := table.visible()
+	if assert.Len(t, shown, 3) {
+		assert.Equal(t, "Three", shown[0].Title)
+	}
+
+	table.onlyMissing = true
+	shown = table.visible()
+	if assert.Len(t, shown, 1) {
+		assert.Equal(t, "Two", shown[0].Title)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/ztrue/tracerr"
+)
+
+// historyTable lists the downloads of the history, the latest first
+type historyTable struct {
+	*tview.Table
+	// help lists the keys under the table
+	help    *tview.TextView
+	entries []historyEntry
+	// onlyMissing hides the downloads whose audio is still in the library
+	onlyMissing bool
+	shown       []historyEntry
+}
+
+func newHistoryTable(entries []historyEntry) *historyTable {
+
+	t := &historyTable{
+		Table:   tview.NewTable(),
+		help:    tview.NewTextView(),
+		entries: entries,
+	}
+
+	t.SetSelectable(true, false)
+	t.SetBorder(true).SetBorderPadding(0, 0, 1, 1)
+
+	t.recolor()
+
+	return t
+}
+
+// recolor sets the colors of the theme and shows the entries with them
+func (t *historyTable) recolor() {
+	t.SetSelectedStyle(tcell.StyleDefault.
+		Background(gomu.colors.accent).
+		Foreground(gomu.colors.foreground))
+	t.SetBackgroundColor(gomu.colors.popup)
+	t.help.SetBackgroundColor(gomu.colors.popup)
+	t.refresh()
+}
+
+// visible returns the entries shown, the latest first
+func (t *historyTable) visible() []historyEntry {
+
+	var shown []historyEntry
+	for i := len(t.entries) - 1; i >= 0; i-- {
+		entry := t.entries[i]
+		if t.onlyMissing && !entry.missing() {
+			continue
+		}
+		shown = append(shown, entry)
+	}
+
+	return shown
+}
+
+// refresh shows the entries in the table
+func (t *historyTable) refresh() {
+
+	row, _ := t.GetSelection()
+	t.shown = t.visible()
+	t.Clear()
+
+	title := " Download history "
+	if t.onlyMissing {
+		title = " Download history (missing) "
+	}
+	t.SetTitle(title)
+
+	for i, entry := range t.shown {
+
+		date := "-"
+		if !entry.Date.IsZero() {
+			date = entry.Date.Format("2006-01-02")
+		}
+
+		name := entry.Title
+		if name == "" {
+			name = entry.URL
+		}
+
+		dir := ""
+		if entry.Path != "" {
+			dir = filepath.Dir(libraryPath(entry.Path))
+		}
+
+		state := entry.state()
+		color := gomu.colors.foreground
+		if state != historyDone {
+			color = tcell.GetColor(gomu.colors.subtitle)
+		}
+
+		t.SetCell(i, 0, tview.NewTableCell(date).
+			SetTextColor(tcell.GetColor(gomu.colors.subtitle)))
+		t.SetCell(i, 1, tview.NewTableCell(state).
+			SetTextColor(color))
+		t.SetCell(i, 2, tview.NewTableCell(tview.Escape(name)).
+			SetTextColor(gomu.colors.foreground).
+			SetExpansion(1).
+			SetMaxWidth(50))
+		t.SetCell(i, 3, tview.NewTableCell(tview.Escape(dir)).
+			SetTextColor(gomu.colors.foreground).
+			SetMaxWidth(30))
+	}
+
+	if row >= len(t.shown) {
+		row = len(t.shown) - 1
+	}
+	t.Select(clamp(row, 0, len(t.shown)), 0)
+}
+
+// selected returns the entry of the selected row
+func (t *historyTable) selected() (historyEntry, bool) {
+	row, _ := t.GetSelection()
+	if row < 0 || row >= len(t.shown) {
+		return historyEntry{}, false
+	}
+	return t.shown[row], true
+}
+
+// historyPopup lists the downloads, the missing ones can be shown alone and
+// downloaded again to their playlist
+func historyPopup() error {
+
+	entries, err := readHistory(historyPath())
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+
+	popupID := "history-popup"
+	table := newHistoryTable(entries)
+
+	table.SetInputCapture(func(e *tcell.EventKey) *tcell.EventKey {
+
+		entry, ok := table.selected()
+
+		switch e.Key() {
+		case tcell.KeyEsc:
+			gomu.pages.RemovePage(popupID)
+			gomu.popups.pop()
+			return nil
+
+		case tcell.KeyEnter:
+			if !ok {
+				return nil
+			}
+			// the audio is downloaded to its playlist if it still exists
+			node := gomu.playlist.GetRoot()
+			if entry.Path != "" {
+				if dir := gomu.playlist.findNode(filepath.Dir(entry.Path)); dir != nil {
+					node = dir
+				}
+			}
+			gomu.pages.RemovePage(popupID)
+			gomu.popups.pop()
+			confirmDownload(entry.URL, entry.Title, node)
+			return nil
+		}
+
+		switch e.Rune() {
+		case 'M':
+			table.onlyMissing = !table.onlyMissing
+			table.refresh()
+		case 'i':
+			if ok {
+				info := entry.URL + "\n" + entry.Path
+				if entry.Error != "" {
+					info += "\n" + entry.Error
+				}
+				defaultTimedPopup(" "+entry.state()+" ", info)
+			}
+		default:
+			return e
+		}
+
+		return nil
+	})
+
+	table.help.
+		SetTextAlign(tview.AlignCenter).
+		SetText("enter download again  M show missing  i details  esc close")
+
+	popup := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(table, 0, 1, true).
+		AddItem(table.help, 1, 0, false)
+
+	gomu.pages.AddPage(popupID, center(popup, 100, 25), true, true)
+	gomu.popups.push(table)
+
+	return nil
+}
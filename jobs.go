@@ -0,0 +1,519 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ztrue/tracerr"
+)
+
+// jobTick is the refresh interval of the progress while jobs are running
+const jobTick = 100 * time.Millisecond
+
+type jobState int
+
+const (
+	jobQueued jobState = iota
+	jobRunning
+	jobDone
+	jobFailed
+	jobCanceled
+)
+
+func (s jobState) String() string {
+	switch s {
+	case jobQueued:
+		return "queued"
+	case jobRunning:
+		return "running"
+	case jobDone:
+		return "done"
+	case jobFailed:
+		return "failed"
+	case jobCanceled:
+		return "canceled"
+	}
+	return "unknown"
+}
+
+// jobFunc does the work of a job, it should return soon after ctx is done.
+// The progress is reported with the job.
+type jobFunc func(ctx context.Context, j *Job) error
+
+// Job is a task run in the background by Jobs
+type Job struct {
+	id   int
+	kind string
+	name string
+	run  jobFunc
+	jobs *Jobs
+	// the fields below are guarded by the mutex of jobs
+	state  jobState
+	done   int
+	total  int
+	status string
+	err    error
+	cancel context.CancelFunc
+	// alive is set while run has not returned, a canceled job keeps its slot
+	// until then
+	alive bool
+}
+
+// jobInfo is a copy of the state of a job shown in the jobs popup
+type jobInfo struct {
+	id     int
+	kind   string
+	name   string
+	state  jobState
+	done   int
+	total  int
+	status string
+	err    error
+}
+
+// Jobs runs the jobs in the background, the number of jobs of a kind running
+// at the same time is limited and the other ones wait in the queue
+type Jobs struct {
+	mu     sync.Mutex
+	jobs   []*Job
+	nextID int
+	// limit returns the number of jobs of the kind run at the same time
+	limit func(kind string) int
+	// changed is called when the state or the progress of a job changes and
+	// periodically while jobs are running
+	changed func()
+	// finished is called when a job ends
+	finished func(j jobInfo)
+	ticking  bool
+}
+
+func newJobs(limit func(kind string) int) *Jobs {
+	return &Jobs{limit: limit}
+}
+
+// jobLimits returns the concurrency limit of each kind set in
+// General.job_limits or else General.job_limit. The config is read once as the
+// jobs are scheduled from their own goroutines where anko cannot be used.
+func jobLimits() func(kind string) int {
+
+	limits := make(map[string]int)
+
+	value, err := gomu.anko.Execute("General.job_limits")
+	if err == nil {
+		values, _ := value.(map[interface{}]interface{})
+		for kind, value := range values {
+			if n, ok := toInt(value); ok && n > 0 {
+				limits[fmt.Sprint(kind)] = n
+			}
+		}
+	}
+
+	limit := gomu.anko.GetInt("General.job_limit")
+	if limit <= 0 {
+		limit = 1
+	}
+
+	return func(kind string) int {
+		if n, ok := limits[kind]; ok {
+			return n
+		}
+		return limit
+	}
+}
+
+// submit queues a new job and starts it if the limit of its kind allows it
+func (js *Jobs) submit(kind, name string, run jobFunc) *Job {
+
+	js.mu.Lock()
+	js.nextID++
+	j := &Job{id: js.nextID, kind: kind, name: name, run: run, jobs: js}
+	js.jobs = append(js.jobs, j)
+	js.mu.Unlock()
+
+	js.schedule()
+	js.notify()
+
+	return j
+}
+
+// schedule starts the queued jobs in order within the limits of their kind
+func (js *Jobs) schedule() {
+
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	running := make(map[string]int)
+	for _, j := range js.jobs {
+		if j.alive {
+			running[j.kind]++
+		}
+	}
+
+	for _, j := range js.jobs {
+		if j.state != jobQueued || running[j.kind] >= js.limit(j.kind) {
+			continue
+		}
+		running[j.kind]++
+		js.start(j)
+	}
+
+	if !js.ticking && js.changed != nil && len(running) > 0 {
+		js.ticking = true
+		go js.tick()
+	}
+}
+
+// start runs the job, the mutex must be held
+func (js *Jobs) start(j *Job) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	j.state = jobRunning
+	j.alive = true
+	j.cancel = cancel
+
+	go func() {
+		err := j.safeRun(ctx)
+		cancel()
+		js.finish(j, err)
+	}()
+}
+
+// safeRun runs the job, a panic fails the job instead of crashing gomu
+func (j *Job) safeRun(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = tracerr.Errorf("%s: %v", j.name, r)
+		}
+	}()
+	return j.run(ctx, j)
+}
+
+// finish records the result of the job and starts the next ones
+func (js *Jobs) finish(j *Job, err error) {
+
+	js.mu.Lock()
+	j.alive = false
+	switch {
+	case j.state == jobCanceled:
+	case err != nil:
+		j.state = jobFailed
+		j.err = err
+	default:
+		j.state = jobDone
+	}
+	info := j.info()
+	js.mu.Unlock()
+
+	if js.finished != nil {
+		js.finished(info)
+	}
+
+	js.schedule()
+	js.notify()
+}
+
+// tick refreshes the progress while jobs are running
+func (js *Jobs) tick() {
+	for {
+		time.Sleep(jobTick)
+
+		js.mu.Lock()
+		active := js.activeLocked("") > 0
+		if !active {
+			js.ticking = false
+		}
+		js.mu.Unlock()
+
+		js.notify()
+		if !active {
+			return
+		}
+	}
+}
+
+func (js *Jobs) notify() {
+	if js.changed != nil {
+		js.changed()
+	}
+}
+
+// find returns the job with the id
+func (js *Jobs) find(id int) (*Job, error) {
+	for _, j := range js.jobs {
+		if j.id == id {
+			return j, nil
+		}
+	}
+	return nil, tracerr.Errorf("no job %d", id)
+}
+
+// cancel stops a queued or running job
+func (js *Jobs) cancel(id int) error {
+
+	js.mu.Lock()
+	j, err := js.find(id)
+	if err == nil {
+		switch j.state {
+		case jobQueued:
+			j.state = jobCanceled
+		case jobRunning:
+			j.state = jobCanceled
+			j.cancel()
+		default:
+			err = tracerr.Errorf("job %d is %s", id, j.state)
+		}
+	}
+	js.mu.Unlock()
+
+	js.notify()
+	return err
+}
+
+// retry queues a failed or canceled job again
+func (js *Jobs) retry(id int) error {
+
+	js.mu.Lock()
+	j, err := js.find(id)
+	if err == nil {
+		if (j.state == jobFailed || j.state == jobCanceled) && !j.alive {
+			j.state = jobQueued
+			j.done, j.total, j.status, j.err = 0, 0, "", nil
+		} else {
+			err = tracerr.Errorf("job %d is %s", id, j.state)
+		}
+	}
+	js.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	js.schedule()
+	js.notify()
+	return nil
+}
+
+// clear removes the jobs which have ended
+func (js *Jobs) clear() {
+
+	js.mu.Lock()
+	var jobs []*Job
+	for _, j := range js.jobs {
+		if j.alive || j.state == jobQueued || j.state == jobRunning {
+			jobs = append(jobs, j)
+		}
+	}
+	js.jobs = jobs
+	js.mu.Unlock()
+
+	js.notify()
+}
+
+// list returns the state of every job in the order they were submitted
+func (js *Jobs) list() []jobInfo {
+
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	infos := make([]jobInfo, 0, len(js.jobs))
+	for _, j := range js.jobs {
+		infos = append(infos, j.info())
+	}
+
+	return infos
+}
+
+// info copies the state of the job, the mutex must be held
+func (j *Job) info() jobInfo {
+	return jobInfo{
+		id:     j.id,
+		kind:   j.kind,
+		name:   j.name,
+		state:  j.state,
+		done:   j.done,
+		total:  j.total,
+		status: j.status,
+		err:    j.err,
+	}
+}
+
+// scriptArgv returns the program and the arguments of a command of a script,
+// the command is either a string split on spaces or a list
+func scriptArgv(command interface{}) ([]string, error) {
+
+	var argv []string
+	switch command := command.(type) {
+	case string:
+		argv = strings.Fields(command)
+	case []interface{}:
+		for _, arg := range command {
+			argv = append(argv, fmt.Sprint(arg))
+		}
+	}
+
+	if len(argv) == 0 {
+		return nil, tracerr.Errorf("invalid command %v", command)
+	}
+
+	return argv, nil
+}
+
+// submitScriptJob runs the command of a script in a job and returns the id of
+// the job, the job fails if the command fails. The output is passed to done
+// once the command succeeds, anko is not safe to use from several goroutines
+// so done is run on the UI goroutine and the job fails if it throws or returns
+// an error.
+func submitScriptJob(name string, command interface{}, done ...func(output string) interface{}) int {
+	j := gomu.jobs.submit("script", name, func(ctx context.Context, j *Job) error {
+
+		argv, err := scriptArgv(command)
+		if err != nil {
+			return err
+		}
+
+		j.setStatus("running %s", argv[0])
+		cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+
+		err = cmd.Run()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return tracerr.Errorf("%s: %v: %s", argv[0], err, lastLine(stderr.String()))
+		}
+
+		if len(done) == 0 || done[0] == nil {
+			return nil
+		}
+
+		errs := make(chan error, 1)
+
+		gomu.app.QueueUpdateDraw(func() {
+			defer func() {
+				if r := recover(); r != nil {
+					errs <- tracerr.Errorf("%s: %v", name, r)
+				}
+			}()
+
+			if err, ok := done[0](stdout.String()).(error); ok {
+				errs <- tracerr.Wrap(err)
+				return
+			}
+			errs <- nil
+		})
+
+		return <-errs
+	})
+	return j.id
+}
+
+// jobsProgress describes the jobs being run e.g. "2 downloads, 3/20 lyrics",
+// it is empty if there is none
+func jobsProgress(infos []jobInfo) string {
+
+	var parts []string
+	downloads, others := 0, 0
+
+	for _, info := range infos {
+		switch {
+		case info.state != jobQueued && info.state != jobRunning:
+		case info.kind == "download":
+			downloads++
+		case info.state == jobRunning && info.total > 0:
+			parts = append(parts, fmt.Sprintf("%d/%d %ss", info.done, info.total, info.kind))
+		default:
+			others++
+		}
+	}
+
+	if downloads > 0 {
+		parts = append([]string{fmt.Sprintf("%d downloads", downloads)}, parts...)
+	}
+	if others > 0 {
+		parts = append(parts, fmt.Sprintf("%d jobs", others))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// active returns the number of queued and running jobs of the kind, every
+// kind if it is empty
+func (js *Jobs) active(kind string) int {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	return js.activeLocked(kind)
+}
+
+func (js *Jobs) activeLocked(kind string) int {
+	count := 0
+	for _, j := range js.jobs {
+		if (kind == "" || j.kind == kind) && (j.state == jobQueued || j.state == jobRunning) {
+			count++
+		}
+	}
+	return count
+}
+
+// wait waits for the jobs to end, the number of jobs done and of jobs which
+// failed or were canceled is passed to progress every jobTick. The jobs left
+// are canceled if ctx is done first.
+func (js *Jobs) wait(ctx context.Context, jobs []*Job, progress func(done, failed int)) error {
+
+	ticker := time.NewTicker(jobTick)
+	defer ticker.Stop()
+
+	for {
+		done, failed := 0, 0
+
+		js.mu.Lock()
+		for _, j := range jobs {
+			switch {
+			case j.alive:
+			case j.state == jobDone:
+				done++
+			case j.state == jobFailed || j.state == jobCanceled:
+				failed++
+			}
+		}
+		js.mu.Unlock()
+
+		progress(done, failed)
+		if done+failed == len(jobs) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			for _, j := range jobs {
+				// the jobs which have ended cannot be canceled
+				_ = js.cancel(j.id)
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// setProgress records that done of total steps of the job are done
+func (j *Job) setProgress(done, total int) {
+	j.jobs.mu.Lock()
+	j.done, j.total = done, total
+	j.jobs.mu.Unlock()
+	j.jobs.notify()
+}
+
+// setStatus records what the job is doing
+func (j *Job) setStatus(format string, args ...interface{}) {
+	j.jobs.mu.Lock()
+	j.status = fmt.Sprintf(format, args...)
+	j.jobs.mu.Unlock()
+	j.jobs.notify()
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/stretchr/testify/assert"
+)
+
+// waitJob waits until the job is in the state
+func waitJob(t *testing.T, js *Jobs, id int, state jobState) jobInfo {
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		for _, info := range js.list() {
+			if info.id == id && info.state == state {
+				return info
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %d is not %s: %v", id, state, js.list())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestJobsLimit(t *testing.T) {
+
+	js := newJobs(func(kind string) int { return 1 })
+
+	release := make(chan struct{})
+	block := func(ctx context.Context, j *Job) error {
+		<-release
+		return nil
+	}
+
+	first := js.submit("download", "first", block)
+	second := js.submit("download", "second", block)
+	// other kinds have their own limit
+	other := js.submit("lyric", "other", block)
+
+	waitJob(t, js, first.id, jobRunning)
+	waitJob(t, js, other.id, jobRunning)
+	assert.Equal(t, jobQueued, js.list()[1].state)
+	assert.Equal(t, 3, js.active(""))
+	assert.Equal(t, 2, js.active("download"))
+
+	release <- struct{}{}
+	release <- struct{}{}
+	waitJob(t, js, second.id, jobRunning)
+
+	close(release)
+	waitJob(t, js, second.id, jobDone)
+	assert.Equal(t, 0, js.active(""))
+
+	js.clear()
+	assert.Empty(t, js.list())
+}
+
+func TestJobsCancel(t *testing.T) {
+
+	js := newJobs(func(kind string) int { return 1 })
+
+	running := js.submit("download", "running", func(ctx context.Context, j *Job) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	ran := false
+	queued := js.submit("download", "queued", func(ctx context.Context, j *Job) error {
+		ran = true
+		return nil
+	})
+
+	waitJob(t, js, running.id, jobRunning)
+
+	assert.NoError(t, js.cancel(queued.id))
+	assert.NoError(t, js.cancel(running.id))
+	waitJob(t, js, running.id, jobCanceled)
+
+	// the error of a canceled job is not kept
+	assert.NoError(t, js.list()[0].err)
+	assert.Equal(t, 0, js.active(""))
+	assert.False(t, ran)
+
+	assert.Error(t, js.cancel(running.id))
+	assert.Error(t, js.cancel(42))
+}
+
+func TestJobsWait(t *testing.T) {
+
+	js := newJobs(func(kind string) int { return 1 })
+
+	items := []*Job{
+		js.submit("download", "done", func(ctx context.Context, j *Job) error {
+			return nil
+		}),
+		js.submit("download", "failed", func(ctx context.Context, j *Job) error {
+			return errors.New("failed")
+		}),
+	}
+
+	var done, failed int
+	err := js.wait(context.Background(), items, func(d, f int) {
+		done, failed = d, f
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, done)
+	assert.Equal(t, 1, failed)
+
+	// the jobs left are canceled with the parent
+	block := func(ctx context.Context, j *Job) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	items = []*Job{
+		js.submit("download", "running", block),
+		js.submit("download", "queued", block),
+	}
+	waitJob(t, js, items[0].id, jobRunning)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = js.wait(ctx, items, func(d, f int) {})
+	assert.Equal(t, context.Canceled, err)
+	waitJob(t, js, items[0].id, jobCanceled)
+	waitJob(t, js, items[1].id, jobCanceled)
+	assert.Equal(t, 0, js.active(""))
+}
+
+func TestJobsRetry(t *testing.T) {
+
+	js := newJobs(func(kind string) int { return 1 })
+
+	attempts := 0
+	j := js.submit("lyric", "flaky", func(ctx context.Context, j *Job) error {
+		attempts++
+		j.setProgress(1, 2)
+		if attempts == 1 {
+			return errors.New("no connection")
+		}
+		return nil
+	})
+
+	info := waitJob(t, js, j.id, jobFailed)
+	assert.EqualError(t, info.err, "no connection")
+	assert.Equal(t, "error", jobProgress(info))
+
+	assert.NoError(t, js.retry(j.id))
+	info = waitJob(t, js, j.id, jobDone)
+	assert.NoError(t, info.err)
+	assert.Equal(t, 2, attempts)
+
+	// only failed and canceled jobs are retried
+	assert.Error(t, js.retry(j.id))
+}
+
+func TestJobsPanic(t *testing.T) {
+
+	js := newJobs(func(kind string) int { return 1 })
+
+	var finished []jobInfo
+	done := make(chan struct{})
+	js.finished = func(info jobInfo) {
+		finished = append(finished, info)
+		close(done)
+	}
+
+	j := js.submit("script", "crash", func(ctx context.Context, j *Job) error {
+		panic("boom")
+	})
+
+	<-done
+	assert.Equal(t, j.id, finished[0].id)
+	assert.Equal(t, jobFailed, finished[0].state)
+	assert.EqualError(t, finished[0].err, "crash: boom")
+}
+
+func TestJobsProgress(t *testing.T) {
+
+	infos := []jobInfo{
+		{kind: "download", state: jobRunning},
+		{kind: "download", state: jobQueued},
+		{kind: "download", state: jobDone},
+		{kind: "lyric", state: jobRunning, done: 3, total: 20},
+		{kind: "script", state: jobRunning},
+		{kind: "tag", state: jobFailed},
+	}
+
+	assert.Equal(t, "2 downloads, 3/20 lyrics, 1 jobs", jobsProgress(infos))
+	assert.Equal(t, "", jobsProgress(infos[5:]))
+}
+
+func TestJobLimit(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+
+	_, err := gomu.anko.Execute(`General.job_limits = {"download": 3}
+General.job_limit = 2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limit := jobLimits()
+	assert.Equal(t, 3, limit("download"))
+	assert.Equal(t, 2, limit("lyric"))
+
+	_, err = gomu.anko.Execute(`General.job_limit = 0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, jobLimits()("lyric"))
+}
+
+func TestSubmitScriptJob(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+	defineBuiltins()
+	gomu.anko.DefineGlobal("fail", func() error { return errors.New("failed") })
+
+	// the callbacks of the scripts are run by the application
+	gomu.app = tview.NewApplication().SetScreen(tcell.NewSimulationScreen("UTF-8"))
+	go gomu.app.Run()
+	defer gomu.app.Stop()
+
+	value, err := gomu.anko.Execute(`
+output = ""
+[
+	submit_job("fine", "true"),
+	submit_job("exit", ["sh", "-c", "echo oops >&2; exit 3"]),
+	submit_job("output", ["echo", "hello"], func(out) { output = out }),
+	submit_job("error", "true", func(out) { return fail() }),
+	submit_job("throw", "true", func(out) { throw "thrown" }),
+	submit_job("empty", ""),
+	submit_job("sleep", "sleep 10"),
+]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := value.([]interface{})
+	assert.Len(t, ids, 7)
+
+	waitJob(t, gomu.jobs, ids[0].(int), jobDone)
+	info := waitJob(t, gomu.jobs, ids[1].(int), jobFailed)
+	assert.Contains(t, info.err.Error(), "oops")
+	waitJob(t, gomu.jobs, ids[2].(int), jobDone)
+	info = waitJob(t, gomu.jobs, ids[3].(int), jobFailed)
+	assert.EqualError(t, info.err, "failed")
+	info = waitJob(t, gomu.jobs, ids[4].(int), jobFailed)
+	assert.Contains(t, info.err.Error(), "thrown")
+	waitJob(t, gomu.jobs, ids[5].(int), jobFailed)
+
+	// the command is killed when the job is canceled
+	waitJob(t, gomu.jobs, ids[6].(int), jobRunning)
+	assert.NoError(t, gomu.jobs.cancel(ids[6].(int)))
+	waitJob(t, gomu.jobs, ids[6].(int), jobCanceled)
+	assert.Equal(t, 0, gomu.jobs.active(""))
+
+	done := make(chan string, 1)
+	gomu.app.QueueUpdate(func() {
+		done <- gomu.anko.GetString("output")
+	})
+	assert.Equal(t, "hello\n", <-done)
+
+	for _, info := range gomu.jobs.list() {
+		assert.Equal(t, "script", info.kind)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// jobsTable lists the background jobs, it is refreshed every time it is drawn
+type jobsTable struct {
+	*tview.Table
+	// help lists the keys under the table
+	help  *tview.TextView
+	jobs  *Jobs
+	infos []jobInfo
+}
+
+func newJobsTable(jobs *Jobs) *jobsTable {
+
+	t := &jobsTable{
+		Table: tview.NewTable(),
+		help:  tview.NewTextView(),
+		jobs:  jobs,
+	}
+
+	t.SetSelectable(true, false)
+	t.SetBorder(true).SetBorderPadding(0, 0, 1, 1)
+	t.SetTitle(" Jobs ")
+
+	t.recolor()
+
+	return t
+}
+
+// recolor sets the colors of the theme and shows the jobs with them
+func (t *jobsTable) recolor() {
+	t.SetSelectedStyle(tcell.StyleDefault.
+		Background(gomu.colors.accent).
+		Foreground(gomu.colors.foreground))
+	t.SetBackgroundColor(gomu.colors.popup)
+	t.help.SetBackgroundColor(gomu.colors.popup)
+	t.refresh()
+}
+
+// jobProgress describes the progress of the job e.g. "3/20"
+func jobProgress(info jobInfo) string {
+	switch {
+	case info.state == jobFailed:
+		return "error"
+	case info.total > 0:
+		return fmt.Sprintf("%d/%d", info.done, info.total)
+	}
+	return info.status
+}
+
+// refresh shows the current state of the jobs
+func (t *jobsTable) refresh() {
+
+	row, _ := t.GetSelection()
+	t.infos = t.jobs.list()
+	t.Clear()
+
+	for i, info := range t.infos {
+		t.SetCell(i, 0, tview.NewTableCell(info.kind).
+			SetTextColor(tcell.GetColor(gomu.colors.subtitle)))
+		t.SetCell(i, 1, tview.NewTableCell(tview.Escape(info.name)).
+			SetTextColor(gomu.colors.foreground).
+			SetExpansion(1).
+			SetMaxWidth(50))
+		t.SetCell(i, 2, tview.NewTableCell(info.state.String()).
+			SetTextColor(gomu.colors.foreground))
+		t.SetCell(i, 3, tview.NewTableCell(tview.Escape(jobProgress(info))).
+			SetTextColor(gomu.colors.foreground))
+	}
+
+	if row >= len(t.infos) {
+		row = len(t.infos) - 1
+	}
+	t.Select(clamp(row, 0, len(t.infos)), 0)
+}
+
+// selected returns the job of the selected row
+func (t *jobsTable) selected() (jobInfo, bool) {
+	row, _ := t.GetSelection()
+	if row < 0 || row >= len(t.infos) {
+		return jobInfo{}, false
+	}
+	return t.infos[row], true
+}
+
+func (t *jobsTable) Draw(screen tcell.Screen) {
+	t.refresh()
+	t.Table.Draw(screen)
+}
+
+// jobsPopup lists the background jobs, they can be canceled and retried and
+// the error of a failed job is shown
+func jobsPopup() {
+
+	popupID := "jobs-popup"
+	table := newJobsTable(gomu.jobs)
+
+	table.SetInputCapture(func(e *tcell.EventKey) *tcell.EventKey {
+
+		info, ok := table.selected()
+
+		switch e.Key() {
+		case tcell.KeyEsc:
+			gomu.pages.RemovePage(popupID)
+			gomu.popups.pop()
+			return nil
+
+		case tcell.KeyEnter:
+			switch {
+			case !ok:
+			case info.err != nil:
+				errorPopup(info.err)
+			default:
+				defaultTimedPopup(" "+info.name+" ", info.state.String()+"\n"+info.status)
+			}
+			return nil
+		}
+
+		switch e.Rune() {
+		case 'x':
+			if ok {
+				if err := gomu.jobs.cancel(info.id); err != nil {
+					errorPopup(err)
+				}
+			}
+		case 'r':
+			if ok {
+				if err := gomu.jobs.retry(info.id); err != nil {
+					errorPopup(err)
+				}
+			}
+		case 'D':
+			gomu.jobs.clear()
+		default:
+			return e
+		}
+
+		table.refresh()
+		return nil
+	})
+
+	table.help.
+		SetTextAlign(tview.AlignCenter).
+		SetText("x cancel  r retry  enter details  D clear finished  esc close")
+
+	popup := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(table, 0, 1, true).
+		AddItem(table.help, 1, 0, false)
+
+	gomu.pages.AddPage(popupID, center(popup, 90, 20), true, true)
+	gomu.popups.push(table)
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ztrue/tracerr"
+)
+
+// journalLimit is the maximum number of operations that can be undone
+const journalLimit = 100
+
+// trashManifest is the file of the trash directory listing the files moved
+// there by gomu, the other files of the directory are never removed
+const trashManifest = ".gomu-trash"
+
+// operation is a change to the library or the queue that can be reverted
+type operation struct {
+	desc string
+	undo func() error
+	redo func() error
+}
+
+// Journal keeps track of destructive operations so that they can be undone
+type Journal struct {
+	mu    sync.Mutex
+	undos []operation
+	redos []operation
+	limit int
+}
+
+func newJournal(limit int) *Journal {
+	return &Journal{limit: limit}
+}
+
+// record adds an operation which has just been done. Operations that were
+// undone cannot be redone anymore.
+func (j *Journal) record(desc string, undo, redo func() error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.undos = append(j.undos, operation{desc: desc, undo: undo, redo: redo})
+	if len(j.undos) > j.limit {
+		j.undos = j.undos[len(j.undos)-j.limit:]
+	}
+	j.redos = nil
+}
+
+// undo reverts the last operation and returns its description
+func (j *Journal) undo() (string, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if len(j.undos) == 0 {
+		return "", tracerr.New("nothing to undo")
+	}
+
+	op := j.undos[len(j.undos)-1]
+	err := op.undo()
+	if err != nil {
+		return "", tracerr.Wrap(err)
+	}
+
+	j.undos = j.undos[:len(j.undos)-1]
+	j.redos = append(j.redos, op)
+
+	return op.desc, nil
+}
+
+// redo applies the last undone operation again and returns its description
+func (j *Journal) redo() (string, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if len(j.redos) == 0 {
+		return "", tracerr.New("nothing to redo")
+	}
+
+	op := j.redos[len(j.redos)-1]
+	err := op.redo()
+	if err != nil {
+		return "", tracerr.Wrap(err)
+	}
+
+	j.redos = j.redos[:len(j.redos)-1]
+	j.undos = append(j.undos, op)
+
+	return op.desc, nil
+}
+
+// trashDir returns the directory deleted files are moved to
+func trashDir() string {
+	return expandTilde(gomu.anko.GetString("General.trash_dir"))
+}
+
+// trashMaxAge returns how long the files are kept in the trash, they are kept
+// forever if it is zero
+func trashMaxAge() time.Duration {
+	return time.Duration(gomu.anko.GetInt("General.trash_days")) * 24 * time.Hour
+}
+
+// trashEntry is a file moved to the trash recorded in the manifest, one json
+// object per line
+type trashEntry struct {
+	// Name is the name of the file in the trash
+	Name string    `json:"name"`
+	Path string    `json:"path"`
+	Date time.Time `json:"date"`
+}
+
+// readTrash returns the files moved to the trash by gomu
+func readTrash(trashDir string) ([]trashEntry, error) {
+
+	f, err := os.Open(filepath.Join(trashDir, trashManifest))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+	defer f.Close()
+
+	var entries []trashEntry
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var entry trashEntry
+		err = json.Unmarshal([]byte(line), &entry)
+		if err != nil {
+			logError(tracerr.Wrap(err))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, tracerr.Wrap(scanner.Err())
+}
+
+// purgeTrash removes the files moved to the trash by gomu more than maxAge
+// ago, the other files of the directory are left alone. Nothing is removed if
+// maxAge is zero.
+func purgeTrash(trashDir string, maxAge time.Duration) error {
+
+	if maxAge <= 0 {
+		return nil
+	}
+
+	entries, err := readTrash(trashDir)
+	if err != nil || len(entries) == 0 {
+		return tracerr.Wrap(err)
+	}
+
+	var kept []string
+	for _, entry := range entries {
+		if time.Since(entry.Date) < maxAge {
+			line, err := json.Marshal(entry)
+			if err != nil {
+				return tracerr.Wrap(err)
+			}
+			kept = append(kept, string(line)+"\n")
+			continue
+		}
+
+		err = os.RemoveAll(filepath.Join(trashDir, filepath.Base(entry.Name)))
+		if err != nil {
+			return tracerr.Wrap(err)
+		}
+	}
+
+	err = ioutil.WriteFile(filepath.Join(trashDir, trashManifest),
+		[]byte(strings.Join(kept, "")), 0644)
+
+	return tracerr.Wrap(err)
+}
+
+// moveToTrash moves the file or directory to the trash directory instead of
+// deleting it, returns the path in the trash.
+func moveToTrash(path string) (string, error) {
+
+	trashDir := trashDir()
+
+	err := os.MkdirAll(trashDir, 0755)
+	if err != nil {
+		return "", tracerr.Wrap(err)
+	}
+
+	// prefix with timestamp so that files with the same name do not clash
+	name := fmt.Sprintf("%d-%s", time.Now().UnixNano(), filepath.Base(path))
+	trashPath := filepath.Join(trashDir, name)
+
+	err = movePath(path, trashPath)
+	if err != nil {
+		return "", tracerr.Wrap(err)
+	}
+
+	// the file is kept in the trash if it cannot be recorded
+	line, err := json.Marshal(trashEntry{Name: name, Path: path, Date: time.Now()})
+	if err == nil {
+		err = appendFile(filepath.Join(trashDir, trashManifest), string(line)+"\n")
+	}
+	if err != nil {
+		logError(tracerr.Wrap(err))
+	}
+
+	return trashPath, nil
+}
+
+// movePath moves file or directory from src to dst. It falls back to copying
+// when they are on different filesystems. Existing files are never overwritten.
+func movePath(src, dst string) error {
+
+	if _, err := os.Lstat(dst); err == nil {
+		return tracerr.Errorf("%s already exists", dst)
+	}
+
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+
+	linkErr, ok := err.(*os.LinkError)
+	if !ok || linkErr.Err != syscall.EXDEV {
+		return tracerr.Wrap(err)
+	}
+
+	err = copyPath(src, dst)
+	if err != nil {
+		os.RemoveAll(dst)
+		return tracerr.Wrap(err)
+	}
+
+	return tracerr.Wrap(os.RemoveAll(src))
+}
+
+// copyPath copies file or directory recursively
+func copyPath(src, dst string) error {
+
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm())
+		}
+
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(out, in)
+		if err != nil {
+			out.Close()
+			return err
+		}
+
+		return out.Close()
+	})
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournal(t *testing.T) {
+
+	j := newJournal(2)
+
+	var value int
+	set := func(n int) func() error {
+		return func() error {
+			value = n
+			return nil
+		}
+	}
+
+	_, err := j.undo()
+	assert.Error(t, err)
+
+	j.record("first", set(0), set(1))
+	j.record("second", set(1), set(2))
+	j.record("third", set(2), set(3))
+	value = 3
+
+	desc, err := j.undo()
+	assert.NoError(t, err)
+	assert.Equal(t, "third", desc)
+	assert.Equal(t, 2, value)
+
+	desc, err = j.undo()
+	assert.NoError(t, err)
+	assert.Equal(t, "second", desc)
+	assert.Equal(t, 1, value)
+
+	// limited to two operations
+	_, err = j.undo()
+	assert.Error(t, err)
+
+	desc, err = j.redo()
+	assert.NoError(t, err)
+	assert.Equal(t, "second", desc)
+	assert.Equal(t, 2, value)
+
+	// new operation clears redo
+	j.record("fourth", set(2), set(4))
+	_, err = j.redo()
+	assert.Error(t, err)
+}
+
+func TestMovePath(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "gomu-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	err = os.MkdirAll(filepath.Join(src, "album"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(src, "album", "song.mp3"), []byte("mp3"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(dir, "dst")
+	assert.NoError(t, movePath(src, dst))
+	assert.NoDirExists(t, src)
+	assert.FileExists(t, filepath.Join(dst, "album", "song.mp3"))
+
+	// existing files are not overwritten
+	assert.NoError(t, os.Mkdir(src, 0755))
+	assert.Error(t, movePath(src, dst))
+
+	copied := filepath.Join(dir, "copied")
+	assert.NoError(t, copyPath(dst, copied))
+	content, err := ioutil.ReadFile(filepath.Join(copied, "album", "song.mp3"))
+	assert.NoError(t, err)
+	assert.Equal(t, "mp3", string(content))
+}
+
+func TestPurgeTrash(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+
+	dir, err := ioutil.TempDir("", "gomu-trash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	trashDir := filepath.Join(dir, "trash")
+	_, err = gomu.anko.Execute(fmt.Sprintf("General.trash_dir = %q", trashDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// files of the user in a shared trash directory
+	for _, name := range []string{"01-intro.mp3", filepath.Join("2019-tour", "live.mp3")} {
+		path := filepath.Join(trashDir, name)
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(path, nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var trashed []string
+	for _, name := range []string{"old.mp3", "recent.mp3"} {
+		path := filepath.Join(dir, name)
+		err = ioutil.WriteFile(path, nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		trashPath, err := moveToTrash(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		trashed = append(trashed, trashPath)
+	}
+
+	entries, err := readTrash(trashDir)
+	assert.NoError(t, err)
+	if !assert.Len(t, entries, 2) {
+		return
+	}
+	assert.Equal(t, filepath.Join(dir, "old.mp3"), entries[0].Path)
+
+	// the first file was deleted long ago
+	entries[0].Date = time.Now().Add(-40 * 24 * time.Hour)
+	var manifest string
+	for _, entry := range entries {
+		line, _ := json.Marshal(entry)
+		manifest += string(line) + "\n"
+	}
+	err = ioutil.WriteFile(filepath.Join(trashDir, trashManifest), []byte(manifest), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing is removed when the files are kept forever
+	assert.NoError(t, purgeTrash(trashDir, 0))
+	assert.FileExists(t, trashed[0])
+
+	assert.NoError(t, purgeTrash(trashDir, 30*24*time.Hour))
+	assert.NoFileExists(t, trashed[0])
+	assert.FileExists(t, trashed[1])
+	assert.FileExists(t, filepath.Join(trashDir, "01-intro.mp3"))
+	assert.FileExists(t, filepath.Join(trashDir, "2019-tour", "live.mp3"))
+
+	entries, err = readTrash(trashDir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	assert.NoError(t, purgeTrash(filepath.Join(dir, "missing"), time.Hour))
+}
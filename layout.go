@@ -0,0 +1,397 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/ztrue/tracerr"
+)
+
+// orientations of layout groups, horizontal groups place their items side by
+// side and vertical groups stack them
+const (
+	horizontal = "horizontal"
+	vertical   = "vertical"
+)
+
+// collapsible panels keep their place in the layout while they are hidden
+type collapsible interface {
+	tview.Primitive
+	place(flex *tview.Flex, size, ratio int)
+	itemSize() (size, ratio int)
+}
+
+// layoutNode is either a panel or a group of nodes
+type layoutNode struct {
+	panel    string
+	vertical bool
+	// size is a fixed number of cells, ratio is used when it is zero
+	size  int
+	ratio int
+	items []layoutNode
+}
+
+// layoutSpec is a layout declared with Layout.def
+type layoutSpec struct {
+	root layoutNode
+	// hidden panels are left out of the layout
+	hidden map[string]bool
+}
+
+// layoutPresets are available without declaring them in the config
+var layoutPresets = map[string]layoutSpec{
+	"default": {root: layoutNode{ratio: 1, items: []layoutNode{
+		{panel: "playlist", ratio: 1},
+		{vertical: true, ratio: 2, items: []layoutNode{
+			{ratio: 5, items: []layoutNode{
+				{panel: "queue", ratio: 1},
+				{panel: "lyrics", ratio: 1},
+			}},
+			{panel: "playing_bar", size: 9},
+			{panel: "visualizer", size: visualizerHeight},
+		}},
+	}}},
+	"stacked": {root: layoutNode{vertical: true, ratio: 1, items: []layoutNode{
+		{panel: "playlist", ratio: 1},
+		{panel: "queue", ratio: 1},
+		{panel: "lyrics", ratio: 1},
+		{panel: "playing_bar", size: 9},
+		{panel: "visualizer", size: visualizerHeight},
+	}}},
+	"compact": {root: layoutNode{vertical: true, ratio: 1, items: []layoutNode{
+		{panel: "queue", ratio: 1},
+		{panel: "playing_bar", size: 9},
+	}}},
+}
+
+var presetOrder = []string{"default", "stacked", "compact"}
+
+// parseLayout converts a layout declared in anko to a layoutSpec. A layout is
+// a panel or a group, e.g.
+//
+//	{"orientation": "horizontal", "items": [
+//	    {"panel": "playlist", "ratio": 1},
+//	    {"panel": "queue", "ratio": 2}],
+//	 "hidden": ["visualizer"]}
+func parseLayout(value interface{}) (layoutSpec, error) {
+
+	root, err := parseLayoutNode(value)
+	if err != nil {
+		return layoutSpec{}, tracerr.Wrap(err)
+	}
+
+	spec := layoutSpec{root: root, hidden: make(map[string]bool)}
+
+	fields, _ := value.(map[interface{}]interface{})
+	if hidden, ok := fields["hidden"]; ok {
+		panels, ok := hidden.([]interface{})
+		if !ok {
+			return layoutSpec{}, tracerr.New("hidden must be a list of panels")
+		}
+		for _, panel := range panels {
+			name, ok := panel.(string)
+			if !ok || layoutPanel(name) == nil {
+				return layoutSpec{}, tracerr.Errorf("invalid hidden panel: %v", panel)
+			}
+			spec.hidden[name] = true
+		}
+	}
+
+	return spec, nil
+}
+
+func parseLayoutNode(value interface{}) (layoutNode, error) {
+
+	fields, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return layoutNode{}, tracerr.Errorf("layout must be a map, got %v", value)
+	}
+
+	node := layoutNode{ratio: 1}
+
+	if size, ok := fields["size"]; ok {
+		n, ok := toInt(size)
+		if !ok || n < 0 {
+			return layoutNode{}, tracerr.Errorf("invalid size: %v", size)
+		}
+		node.size = n
+	}
+
+	if ratio, ok := fields["ratio"]; ok {
+		n, ok := toInt(ratio)
+		if !ok || n <= 0 {
+			return layoutNode{}, tracerr.Errorf("invalid ratio: %v", ratio)
+		}
+		node.ratio = n
+	}
+
+	if panel, ok := fields["panel"]; ok {
+		name, ok := panel.(string)
+		if !ok || layoutPanel(name) == nil {
+			return layoutNode{}, tracerr.Errorf("unknown panel: %v", panel)
+		}
+		node.panel = name
+		return node, nil
+	}
+
+	switch orientation := fields["orientation"]; orientation {
+	case nil, horizontal:
+	case vertical:
+		node.vertical = true
+	default:
+		return layoutNode{}, tracerr.Errorf("invalid orientation: %v", orientation)
+	}
+
+	items, ok := fields["items"].([]interface{})
+	if !ok || len(items) == 0 {
+		return layoutNode{}, tracerr.New("layout must have a panel or items")
+	}
+
+	for _, item := range items {
+		child, err := parseLayoutNode(item)
+		if err != nil {
+			return layoutNode{}, tracerr.Wrap(err)
+		}
+		node.items = append(node.items, child)
+	}
+
+	return node, nil
+}
+
+// toInt converts numbers from anko
+func toInt(value interface{}) (int, bool) {
+	switch n := value.(type) {
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	case float64:
+		return int(n), true
+	}
+	return 0, false
+}
+
+// layoutPanel returns the panel with the name used in layouts
+func layoutPanel(name string) tview.Primitive {
+	switch name {
+	case "playlist":
+		return gomu.playlist
+	case "queue":
+		return gomu.queue
+	case "playing_bar":
+		return gomu.playingBar
+	case "visualizer":
+		return gomu.visualizer
+	case "lyrics":
+		return gomu.lyrics
+	}
+	return nil
+}
+
+// Layout arranges the panels following the layout chosen in Layout.startup or
+// with cycle_layout. The narrow layout is used while the terminal is narrower
+// than Layout.narrow_width.
+type Layout struct {
+	*tview.Flex
+	layouts map[string]layoutSpec
+	// order is the order of cycle_layout
+	order   []string
+	current string
+	// shown is the layout on screen, it differs from current when the
+	// terminal is narrow
+	shown       string
+	narrow      string
+	narrowWidth int
+}
+
+func newLayout() *Layout {
+	return &Layout{Flex: tview.NewFlex(), current: "default"}
+}
+
+// load reads the layouts declared in the Layout module, invalid layouts are
+// reported and skipped
+func (l *Layout) load() error {
+
+	l.layouts = make(map[string]layoutSpec, len(layoutPresets))
+	l.order = append([]string(nil), presetOrder...)
+	for name, spec := range layoutPresets {
+		l.layouts[name] = spec
+	}
+
+	var errs []string
+
+	value, err := gomu.anko.Execute("Layout.layouts")
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+	declared, _ := value.(map[interface{}]interface{})
+
+	value, err = gomu.anko.Execute("Layout.order")
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+	order, _ := value.([]interface{})
+
+	for _, name := range order {
+		name, ok := name.(string)
+		if !ok {
+			continue
+		}
+
+		spec, err := parseLayout(declared[name])
+		if err != nil {
+			errs = append(errs, name+": "+err.Error())
+			continue
+		}
+
+		if _, ok := l.layouts[name]; !ok {
+			l.order = append(l.order, name)
+		}
+		l.layouts[name] = spec
+	}
+
+	l.narrow = gomu.anko.GetString("Layout.narrow")
+	l.narrowWidth = gomu.anko.GetInt("Layout.narrow_width")
+	l.shown = ""
+
+	startup := gomu.anko.GetString("Layout.startup")
+	if _, ok := l.layouts[startup]; ok {
+		l.current = startup
+	} else if startup != "" {
+		errs = append(errs, "unknown layout: "+startup)
+	}
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return tracerr.Errorf("invalid layouts: %v", errs)
+	}
+
+	return nil
+}
+
+// set chooses the layout, it is applied on the next draw
+func (l *Layout) set(name string) error {
+	if _, ok := l.layouts[name]; !ok {
+		return tracerr.Errorf("unknown layout: %s", name)
+	}
+	l.current = name
+	return nil
+}
+
+// cycle chooses the next layout and returns its name
+func (l *Layout) cycle() string {
+
+	next := 0
+	for i, name := range l.order {
+		if name == l.current {
+			next = (i + 1) % len(l.order)
+		}
+	}
+
+	l.current = l.order[next]
+	return l.current
+}
+
+// Draw switches to the narrow layout when the terminal is narrow and draws the
+// panels
+func (l *Layout) Draw(screen tcell.Screen) {
+
+	name := l.current
+	width, _ := screen.Size()
+	if _, ok := l.layouts[l.narrow]; ok && width < l.narrowWidth {
+		name = l.narrow
+	}
+
+	if name != l.shown {
+		l.apply(name)
+	}
+
+	l.Flex.Draw(screen)
+}
+
+// apply replaces the panels on screen with the layout
+func (l *Layout) apply(name string) {
+
+	spec := l.layouts[name]
+
+	l.Clear()
+	gomu.visualizer.place(nil, 0, 0)
+	gomu.lyrics.place(nil, 0, 1)
+
+	visible := make(map[string]bool)
+	if item := l.build(spec.root, spec.hidden, visible); item != nil {
+		l.AddItem(item, 0, 1, false)
+	}
+	l.shown = name
+
+	// panels cycled with tab
+	var panels []Panel
+	for _, name := range []string{"playlist", "queue", "playing_bar", "lyrics"} {
+		if visible[name] {
+			panels = append(panels, layoutPanel(name).(Panel))
+		}
+	}
+	if len(panels) == 0 {
+		return
+	}
+	gomu.panels = panels
+
+	// the focus cannot be changed while drawing
+	for _, panel := range panels {
+		if panel == gomu.prevPanel {
+			return
+		}
+	}
+	go gomu.app.QueueUpdateDraw(func() {
+		if gomu.popups.peekTop() == nil {
+			focusPanel(panels[0])
+		} else {
+			gomu.prevPanel = panels[0]
+		}
+	})
+}
+
+// build creates the primitive of the node, visible records the panels shown.
+// It returns nil if every panel of the node is hidden.
+func (l *Layout) build(node layoutNode, hidden map[string]bool, visible map[string]bool) tview.Primitive {
+
+	if node.panel != "" {
+		if hidden[node.panel] || visible[node.panel] {
+			return nil
+		}
+		visible[node.panel] = true
+		return layoutPanel(node.panel)
+	}
+
+	flex := tview.NewFlex().SetDirection(tview.FlexColumn)
+	if node.vertical {
+		flex.SetDirection(tview.FlexRow)
+	}
+
+	var count int
+	for _, item := range node.items {
+		primitive := l.build(item, hidden, visible)
+		if primitive == nil {
+			continue
+		}
+		count++
+
+		// the visualizer and the lyrics keep their size while they are
+		// hidden with toggle_visualizer and toggle_lyrics
+		if panel, ok := primitive.(collapsible); ok {
+			panel.place(flex, item.size, item.ratio)
+			size, ratio := panel.itemSize()
+			flex.AddItem(primitive, size, ratio, false)
+			continue
+		}
+
+		flex.AddItem(primitive, item.size, item.ratio, false)
+	}
+
+	if count == 0 {
+		return nil
+	}
+
+	return flex
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/rivo/tview"
+	"github.com/stretchr/testify/assert"
+)
+
+// prepareLayoutTest creates the panels that can be placed in layouts
+func prepareLayoutTest() *Gomu {
+
+	gomu = newGomu()
+	err := execConfig(expandFilePath(testConfigPath))
+	if err != nil {
+		panic(err)
+	}
+	gomu.colors = newColor()
+
+	gomu.queue = newQueue()
+	gomu.playlist = &Playlist{TreeView: tview.NewTreeView()}
+	gomu.playingBar = newPlayingBar()
+	gomu.visualizer = newVisualizer()
+	gomu.lyrics = newLyrics()
+
+	return gomu
+}
+
+func TestParseLayout(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+
+	_, err := gomu.anko.Execute(`
+Layout.def("wide", {
+	"orientation": "horizontal",
+	"items": [
+		{"panel": "playlist", "ratio": 2},
+		{"orientation": "vertical", "items": [
+			{"panel": "queue"},
+			{"panel": "playing_bar", "size": 9}
+		]}
+	],
+	"hidden": ["playlist"]
+})
+Layout.def("bad_panel", {"panel": "album_art"})
+Layout.def("bad_orientation", {"orientation": "diagonal", "items": [{"panel": "queue"}]})
+Layout.def("no_items", {"orientation": "vertical"})
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := gomu.anko.Execute(`Layout.layouts`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layouts := value.(map[interface{}]interface{})
+
+	spec, err := parseLayout(layouts["wide"])
+	assert.NoError(t, err)
+	assert.Equal(t, layoutSpec{
+		root: layoutNode{ratio: 1, items: []layoutNode{
+			{panel: "playlist", ratio: 2},
+			{vertical: true, ratio: 1, items: []layoutNode{
+				{panel: "queue", ratio: 1},
+				{panel: "playing_bar", size: 9, ratio: 1},
+			}},
+		}},
+		hidden: map[string]bool{"playlist": true},
+	}, spec)
+
+	for _, name := range []string{"bad_panel", "bad_orientation", "no_items"} {
+		_, err := parseLayout(layouts[name])
+		assert.Error(t, err, name)
+	}
+
+	// invalid layouts are reported and skipped
+	l := newLayout()
+	err = l.load()
+	assert.Error(t, err)
+	assert.Equal(t, []string{"default", "stacked", "compact", "wide"}, l.order)
+	assert.Equal(t, "default", l.current)
+}
+
+func TestLayoutCycle(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+
+	l := newLayout()
+	err := l.load()
+	assert.NoError(t, err)
+
+	assert.Equal(t, "stacked", l.cycle())
+	assert.Equal(t, "compact", l.cycle())
+	assert.Equal(t, "default", l.cycle())
+
+	assert.NoError(t, l.set("compact"))
+	assert.Error(t, l.set("unknown"))
+	assert.Equal(t, "compact", l.current)
+}
+
+func TestLayoutApply(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+	gomu.prevPanel = gomu.queue
+
+	l := newLayout()
+	err := l.load()
+	assert.NoError(t, err)
+
+	l.apply("default")
+	assert.Equal(t, []Panel{gomu.playlist, gomu.queue, gomu.playingBar, gomu.lyrics}, gomu.panels)
+	assert.NotNil(t, gomu.visualizer.flex)
+	assert.NotNil(t, gomu.lyrics.flex)
+
+	// the playlist is not part of the compact layout
+	l.apply("compact")
+	assert.Equal(t, []Panel{gomu.queue, gomu.playingBar}, gomu.panels)
+	assert.Nil(t, gomu.visualizer.flex)
+	assert.Nil(t, gomu.lyrics.flex)
+	assert.Equal(t, "compact", l.shown)
+
+	// hidden panels are left out and empty groups are dropped
+	spec := layoutSpec{
+		root: layoutNode{items: []layoutNode{
+			{panel: "playlist"},
+			{vertical: true, items: []layoutNode{{panel: "visualizer"}}},
+		}},
+		hidden: map[string]bool{"visualizer": true},
+	}
+	visible := make(map[string]bool)
+	flex := l.build(spec.root, spec.hidden, visible).(*tview.Flex)
+	assert.Equal(t, 1, flex.GetItemCount())
+	assert.Equal(t, map[string]bool{"playlist": true}, visible)
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/ztrue/tracerr"
+
+	"github.com/issadarkthing/gomu/lyric"
+)
+
+// lrcNudge is the step of the keys moving the timestamp of a line
+const lrcNudge = 100
+
+// lrcEditor edits the timing of the lines of a lyric while the song is played.
+// Timestamps are in milliseconds from the start of the song, the offset of the
+// lyric is already applied.
+type lrcEditor struct {
+	*tview.Table
+	// help lists the keys under the table
+	help     *tview.TextView
+	songPath string
+	langExt  string
+	// lyric is the edited lyric, its metadata is kept when saving
+	lyric    *lyric.Lyric
+	captions []lyric.UnsyncedCaption
+	modified bool
+}
+
+// newLrcEditor edits the synced captions of subtitle, the lines of unsynced
+// are used without timestamps if there is no synced lyric
+func newLrcEditor(songPath string, subtitle *lyric.Lyric, unsynced string) *lrcEditor {
+
+	e := &lrcEditor{
+		Table:    tview.NewTable(),
+		help:     tview.NewTextView(),
+		songPath: songPath,
+		langExt:  "en",
+		lyric:    &lyric.Lyric{},
+	}
+
+	lines, synced := lyricLines(subtitle, unsynced)
+	for i, line := range lines {
+		caption := lyric.UnsyncedCaption{Text: line}
+		if synced {
+			caption.Timestamp = subtitle.SyncedCaptions[i].Timestamp
+		}
+		// the word timestamps of the lrc lines are moved with the line
+		if synced && len(subtitle.UnsyncedCaptions) == len(lines) {
+			words := subtitle.UnsyncedCaptions[i]
+			caption.Words = words.Shift(int(caption.Timestamp) - int(words.Timestamp)).Words
+		}
+		e.captions = append(e.captions, caption)
+	}
+
+	if subtitle != nil {
+		e.lyric = subtitle
+		if subtitle.LangExt != "" {
+			e.langExt = subtitle.LangExt
+		}
+	}
+
+	e.SetSelectable(true, false)
+	e.SetBorder(true).SetBorderPadding(0, 0, 1, 1)
+
+	e.recolor()
+
+	return e
+}
+
+// recolor sets the colors of the theme and shows the captions with them
+func (e *lrcEditor) recolor() {
+	e.SetSelectedStyle(tcell.StyleDefault.
+		Background(gomu.colors.accent).
+		Foreground(gomu.colors.foreground))
+	e.SetBackgroundColor(gomu.colors.popup)
+	e.help.SetBackgroundColor(gomu.colors.popup)
+	e.refresh()
+}
+
+// refresh shows the captions in the table
+func (e *lrcEditor) refresh() {
+
+	row, _ := e.GetSelection()
+	e.Clear()
+
+	for i, caption := range e.captions {
+		e.SetCell(i, 0, tview.NewTableCell(fmtLrcTime(caption.Timestamp)).
+			SetTextColor(tcell.GetColor(gomu.colors.subtitle)))
+		e.SetCell(i, 1, tview.NewTableCell(tview.Escape(caption.Text)).
+			SetTextColor(gomu.colors.foreground).
+			SetExpansion(1))
+	}
+
+	if row >= len(e.captions) {
+		row = len(e.captions) - 1
+	}
+	e.Select(clamp(row, 0, len(e.captions)), 0)
+}
+
+// valid reports whether row is a line of the lyric
+func (e *lrcEditor) valid(row int) bool {
+	return row >= 0 && row < len(e.captions)
+}
+
+// stamp sets the timestamp of the line, its words are moved with it, and
+// selects the next line
+func (e *lrcEditor) stamp(row int, position uint32) {
+	if !e.valid(row) {
+		return
+	}
+	e.captions[row] = e.captions[row].Shift(int(position) - int(e.captions[row].Timestamp))
+	e.modified = true
+	e.refresh()
+	if e.valid(row + 1) {
+		e.Select(row+1, 0)
+	}
+}
+
+// nudge moves the timestamp of the line and of its words by delta
+// milliseconds
+func (e *lrcEditor) nudge(row int, delta int) {
+	if !e.valid(row) {
+		return
+	}
+	e.captions[row] = e.captions[row].Shift(delta)
+	e.modified = true
+	e.refresh()
+}
+
+// insert adds a line after row with the same timestamp
+func (e *lrcEditor) insert(row int, text string) {
+
+	var caption lyric.UnsyncedCaption
+	caption.Text = text
+
+	index := 0
+	if e.valid(row) {
+		caption.Timestamp = e.captions[row].Timestamp
+		index = row + 1
+	}
+
+	e.captions = append(e.captions, lyric.UnsyncedCaption{})
+	copy(e.captions[index+1:], e.captions[index:])
+	e.captions[index] = caption
+
+	e.modified = true
+	e.refresh()
+	e.Select(index, 0)
+}
+
+// remove deletes the line
+func (e *lrcEditor) remove(row int) {
+	if !e.valid(row) {
+		return
+	}
+	e.captions = append(e.captions[:row], e.captions[row+1:]...)
+	e.modified = true
+	e.refresh()
+}
+
+// setText replaces the text of the line
+func (e *lrcEditor) setText(row int, text string) {
+	if !e.valid(row) {
+		return
+	}
+	// the word timestamps do not match the new text
+	e.captions[row].Text = text
+	e.captions[row].Words = nil
+	e.modified = true
+	e.refresh()
+}
+
+// result returns the edited lyric, the lines are sorted by timestamp
+func (e *lrcEditor) result() *lyric.Lyric {
+
+	result := *e.lyric
+	result.LangExt = e.langExt
+	result.Offset = 0
+	result.SyncedCaptions = nil
+	result.UnsyncedCaptions = append([]lyric.UnsyncedCaption(nil), e.captions...)
+
+	sort.SliceStable(result.UnsyncedCaptions, func(i, j int) bool {
+		return result.UnsyncedCaptions[i].Timestamp < result.UnsyncedCaptions[j].Timestamp
+	})
+
+	return &result
+}
+
+// save embeds the lyric in the song and exports it to its sidecar .lrc file
+func (e *lrcEditor) save() error {
+
+	result := e.result()
+
+	err := embedLyric(e.songPath, result, false)
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+
+	err = ioutil.WriteFile(sidecarPath(e.songPath, e.langExt, defaultLyricLang()), []byte(result.AsLRC()), 0644)
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+
+	e.modified = false
+	return nil
+}
+
+// fmtLrcTime formats milliseconds as mm:ss.xx
+func fmtLrcTime(ms uint32) string {
+	return fmt.Sprintf("%02d:%02d.%02d", ms/60000, ms/1000%60, ms%1000/10)
+}
+
+// Draw shows the position of the song in the title and highlights the line
+// being sung
+func (e *lrcEditor) Draw(screen tcell.Screen) {
+
+	var position uint32
+	if gomu.player.IsRunning() {
+		position = uint32(gomu.player.GetPosition().Milliseconds())
+	}
+
+	modified := ""
+	if e.modified {
+		modified = " *"
+	}
+	e.SetTitle(fmt.Sprintf(" Sync lyric %s %s%s ", e.langExt, fmtLrcTime(position), modified))
+
+	// the last line started before the position, lines may be out of order
+	// while editing
+	current := -1
+	for i, caption := range e.captions {
+		if caption.Timestamp <= position &&
+			(current < 0 || caption.Timestamp >= e.captions[current].Timestamp) {
+			current = i
+		}
+	}
+
+	for i := range e.captions {
+		color := gomu.colors.foreground
+		if i == current {
+			color = gomu.colors.title
+		}
+		e.GetCell(i, 1).SetTextColor(color)
+	}
+
+	e.Table.Draw(screen)
+}
+
+// lrcEditorPopup opens the sync editor for the lyric of the song being played
+func lrcEditorPopup() {
+
+	if !gomu.player.IsRunning() {
+		defaultTimedPopup(" Sync lyric ", "No song is playing")
+		return
+	}
+
+	popupID := "lrc-editor-popup"
+	songPath := gomu.player.GetCurrentSong().Path()
+	editor := newLrcEditor(songPath, gomu.playingBar.subtitle, gomu.playingBar.unsynced)
+
+	closeEditor := func() {
+		gomu.pages.RemovePage(popupID)
+		gomu.popups.pop()
+	}
+
+	// edits the text of a line in an input popup, done is called with the
+	// text entered
+	editText := func(title, text string, done func(text string)) {
+		inputID := "lrc-editor-input-popup"
+		input := newInputPopup(inputID, title, "Text: ", text)
+		input.SetAcceptanceFunc(nil)
+		input.SetDoneFunc(func(key tcell.Key) {
+			gomu.pages.RemovePage(inputID)
+			gomu.popups.pop()
+			if key == tcell.KeyEnter {
+				done(input.GetText())
+			}
+		})
+	}
+
+	editor.SetInputCapture(func(e *tcell.EventKey) *tcell.EventKey {
+
+		row, _ := editor.GetSelection()
+
+		switch e.Key() {
+		case tcell.KeyEsc:
+			if !editor.modified {
+				closeEditor()
+				return nil
+			}
+			confirmationPopup("Discard the changes?", func(_ int, label string) {
+				if label == "yes" {
+					closeEditor()
+				}
+			})
+			return nil
+
+		case tcell.KeyEnter:
+			// plays the song from the line to check the timing
+			if editor.valid(row) {
+				err := seekTo(int(editor.captions[row].Timestamp / 1000))
+				if err != nil {
+					errorPopup(err)
+				}
+			}
+			return nil
+		}
+
+		switch e.Rune() {
+		case 's':
+			position := gomu.player.GetPosition()
+			editor.stamp(row, uint32(position/time.Millisecond))
+		case 'h':
+			editor.nudge(row, -lrcNudge)
+		case 'l':
+			editor.nudge(row, lrcNudge)
+		case 'H':
+			editor.nudge(row, -10*lrcNudge)
+		case 'L':
+			editor.nudge(row, 10*lrcNudge)
+		case 'o':
+			editText(" Insert line ", "", func(text string) {
+				editor.insert(row, text)
+			})
+		case 'e':
+			if editor.valid(row) {
+				editText(" Edit line ", editor.captions[row].Text, func(text string) {
+					editor.setText(row, text)
+				})
+			}
+		case 'd':
+			editor.remove(row)
+		case 'w':
+			err := editor.save()
+			if err != nil {
+				errorPopup(err)
+				return nil
+			}
+			if gomu.player.GetCurrentSong().Path() == songPath {
+				err = gomu.playingBar.reloadSubtitle(editor.langExt)
+				if err != nil {
+					errorPopup(err)
+				}
+			}
+			defaultTimedPopup(" Sync lyric ", "Lyric saved to "+filepath.Base(sidecarPath(songPath, editor.langExt, defaultLyricLang())))
+		default:
+			return e
+		}
+
+		return nil
+	})
+
+	editor.help.
+		SetTextAlign(tview.AlignCenter).
+		SetText("s stamp  h/l ±0.1s  H/L ±1s  o insert  e edit  d delete  enter play from line  w save")
+
+	popup := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(editor, 0, 1, true).
+		AddItem(editor.help, 1, 0, false)
+
+	gomu.pages.AddPage(popupID, center(popup, 90, 30), true, true)
+	gomu.popups.push(editor)
+}
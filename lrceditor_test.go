@@ -0,0 +1,137 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tramhao/id3v2"
+
+	"github.com/issadarkthing/gomu/lyric"
+)
+
+func TestLrcEditor(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+
+	subtitle := &lyric.Lyric{
+		LangExt: "en",
+		SyncedCaptions: []id3v2.SyncedText{
+			{Timestamp: 1000, Text: "first"},
+			{Timestamp: 5000, Text: "second"},
+		},
+	}
+
+	e := newLrcEditor("song.mp3", subtitle, "")
+	assert.Equal(t, []lyric.UnsyncedCaption{
+		{Timestamp: 1000, Text: "first"},
+		{Timestamp: 5000, Text: "second"},
+	}, e.captions)
+
+	// stamping selects the next line
+	e.stamp(0, 2500)
+	row, _ := e.GetSelection()
+	assert.Equal(t, 1, row)
+	assert.True(t, e.modified)
+
+	e.nudge(1, -lrcNudge)
+	e.nudge(0, -5000)
+	e.insert(1, "third")
+	e.setText(0, "first!")
+	e.insert(-1, "intro")
+	e.remove(10)
+
+	assert.Equal(t, []lyric.UnsyncedCaption{
+		{Timestamp: 0, Text: "intro"},
+		{Timestamp: 0, Text: "first!"},
+		{Timestamp: 4900, Text: "second"},
+		{Timestamp: 4900, Text: "third"},
+	}, e.captions)
+
+	e.remove(0)
+	e.nudge(2, 3000)
+
+	// lines are sorted when saving
+	result := e.result()
+	assert.Equal(t, "en", result.LangExt)
+	assert.Equal(t, []lyric.UnsyncedCaption{
+		{Timestamp: 0, Text: "first!"},
+		{Timestamp: 4900, Text: "second"},
+		{Timestamp: 7900, Text: "third"},
+	}, result.UnsyncedCaptions)
+
+	// the lines of unsynced lyrics have no timestamps
+	e = newLrcEditor("song.mp3", nil, "one\ntwo")
+	assert.Equal(t, []lyric.UnsyncedCaption{{Text: "one"}, {Text: "two"}}, e.captions)
+	assert.Equal(t, "en", e.langExt)
+}
+
+func TestLrcEditorSave(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+
+	dir, err := ioutil.TempDir("", "gomu-lrceditor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	songPath := filepath.Join(dir, "song.mp3")
+	err = ioutil.WriteFile(songPath, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := newLrcEditor(songPath, nil, "one\ntwo")
+	e.nudge(1, 3000)
+	assert.NoError(t, e.save())
+	assert.False(t, e.modified)
+
+	lrc, err := ioutil.ReadFile(filepath.Join(dir, "song.lrc"))
+	assert.NoError(t, err)
+	assert.Equal(t, "[00:00.000]one\n[00:03.000]two\n", string(lrc))
+
+	tag, err := id3v2.Open(songPath, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tag.Close()
+
+	frames := tag.GetFrames(tag.CommonID("Synchronised lyrics/text"))
+	assert.Len(t, frames, 1)
+	sylt := frames[0].(id3v2.SynchronisedLyricsFrame)
+	assert.Equal(t, "en", sylt.ContentDescriptor)
+	assert.Equal(t, []id3v2.SyncedText{
+		{Timestamp: 0, Text: "one"},
+		{Timestamp: 3000, Text: "two"},
+	}, sylt.SynchronizedTexts)
+}
+
+func TestFmtLrcTime(t *testing.T) {
+	assert.Equal(t, "00:00.00", fmtLrcTime(0))
+	assert.Equal(t, "01:05.43", fmtLrcTime(65439))
+}
+
+func TestLrcEditorWords(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+
+	var subtitle lyric.Lyric
+	err := subtitle.NewFromLRC("[offset:500]\n[00:10.00]<00:10.00>One <00:10.50>two\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the offset is applied to the words
+	e := newLrcEditor("song.mp3", &subtitle, "")
+	assert.Equal(t, []lyric.Word{{Timestamp: 9500, Text: "One "}, {Timestamp: 10000, Text: "two"}}, e.captions[0].Words)
+
+	// words are moved with the line
+	e.stamp(0, 12000)
+	assert.Equal(t, []lyric.Word{{Timestamp: 12000, Text: "One "}, {Timestamp: 12500, Text: "two"}}, e.captions[0].Words)
+
+	e.setText(0, "One two three")
+	assert.Nil(t, e.captions[0].Words)
+}
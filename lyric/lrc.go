@@ -13,6 +13,8 @@
 // [al:Hits Of The 60's - Vol. 2 – Oldies]
 // [00:12.00]Lyrics beginning ...
 // [00:15.30]Some more lyrics ...
+// Enhanced lrc adds timestamps to the words of a line
+// [00:17.00]<00:17.00>Word <00:17.40>by <00:17.80>word
 package lyric
 
 import (
@@ -33,7 +35,9 @@ import (
 type Lyric struct {
 	Album               string
 	Artist              string
+	Author              string // Author of the song
 	ByCreator           string // Creator of LRC file
+	Length              string // Length of the song
 	Offset              int32  // positive means delay lyric
 	RePlayerEditor      string // Player or Editor to create this LRC file
 	Title               string
@@ -41,12 +45,30 @@ type Lyric struct {
 	LangExt             string
 	UnsyncedCaptions    []UnsyncedCaption  // USLT captions
 	SyncedCaptions      []id3v2.SyncedText // SYLT captions
+	// Headers are the other metadata tags, kept in their order
+	Headers []Header
+}
+
+// Header is a metadata tag of lrc e.g. [key:value]
+type Header struct {
+	Key   string
+	Value string
 }
 
 // UnsyncedCaption is only showing in tageditor
 type UnsyncedCaption struct {
 	Timestamp uint32
 	Text      string
+	// Words of enhanced lrc lines, Text is the text of the words without
+	// their timestamps
+	Words []Word
+}
+
+// Word is a word of an enhanced lrc line, the text includes the spaces
+// following the word
+type Word struct {
+	Timestamp uint32
+	Text      string
 }
 
 // Eol is the end of line characters to use when writing .srt data
@@ -67,27 +89,29 @@ func looksLikeLRC(s string) bool {
 	return false
 }
 
+var (
+	headerPattern     = regexp.MustCompile(`^\[([a-zA-Z#]+):(.*)\]$`)
+	wordPattern       = regexp.MustCompile(`<([0-9]+:[0-9]+(?:[.:][0-9]+)?)>`)
+	whitespacePattern = regexp.MustCompile(`\s+`)
+)
+
 // NewFromLRC parses a .lrc text into Subtitle, assumes s is a clean utf8 string
 func (lyric *Lyric) NewFromLRC(s string) (err error) {
 	s = cleanLRC(s)
 	lines := strings.Split(s, "\n")
 
-	for i := 0; i < len(lines)-1; i++ {
+	for i := 0; i < len(lines); i++ {
 		seq := strings.Trim(lines[i], "\r ")
 		if seq == "" {
 			continue
 		}
 
-		if strings.HasPrefix(seq, "[offset") {
-			tmpString := strings.TrimPrefix(seq, "[offset:")
-			tmpString = strings.TrimSuffix(tmpString, "]")
-			tmpString = strings.ReplaceAll(tmpString, " ", "")
-			var intOffset int
-			intOffset, err = strconv.Atoi(tmpString)
+		if header := headerPattern.FindStringSubmatch(seq); header != nil {
+			err = lyric.setHeader(header[1], header[2])
 			if err != nil {
 				return tracerr.Wrap(err)
 			}
-			lyric.Offset = int32(intOffset)
+			continue
 		}
 
 		timestampPattern := regexp.MustCompile(`(?U)^\[[0-9].*\]`)
@@ -106,13 +130,23 @@ func (lyric *Lyric) NewFromLRC(s string) (err error) {
 			break
 		}
 
-		r2 := regexp.MustCompile(`^\[.*\]`)
-		s2 := r2.ReplaceAllString(lines[i], "$1")
+		// only the timestamps are removed, the text may contain brackets
+		r2 := regexp.MustCompile(`^(\[[0-9][^\]]*\])+`)
+		s2 := r2.ReplaceAllString(lines[i], "")
 		s3 := strings.Trim(s2, "\r")
 		s3 = strings.Trim(s3, "\n")
+
+		o.Words, err = parseWords(s3, o.Timestamp)
+		if err != nil {
+			err = fmt.Errorf("lrc: word error at line %d: %v", i, err)
+			break
+		}
+		if o.Words != nil {
+			s3 = wordPattern.ReplaceAllString(s3, "")
+		}
+
 		s3 = strings.TrimSpace(s3)
-		singleSpacePattern := regexp.MustCompile(`\s+`)
-		s3 = singleSpacePattern.ReplaceAllString(s3, " ")
+		s3 = whitespacePattern.ReplaceAllString(s3, " ")
 		o.Text = s3
 		lyric.UnsyncedCaptions = append(lyric.UnsyncedCaptions, o)
 	}
@@ -128,15 +162,7 @@ func (lyric *Lyric) NewFromLRC(s string) (err error) {
 	for _, v := range lyric.UnsyncedCaptions {
 		var s id3v2.SyncedText
 		s.Text = v.Text
-		if lyric.Offset <= 0 {
-			s.Timestamp = v.Timestamp + uint32(-lyric.Offset)
-		} else {
-			if v.Timestamp > uint32(lyric.Offset) {
-				s.Timestamp = v.Timestamp - uint32(lyric.Offset)
-			} else {
-				s.Timestamp = 0
-			}
-		}
+		s.Timestamp = lyric.applyOffset(v.Timestamp)
 		lyric.SyncedCaptions = append(lyric.SyncedCaptions, s)
 	}
 
@@ -145,6 +171,91 @@ func (lyric *Lyric) NewFromLRC(s string) (err error) {
 	return
 }
 
+// applyOffset returns the time in the song of a timestamp of lrc
+func (lyric *Lyric) applyOffset(timestamp uint32) uint32 {
+	if lyric.Offset <= 0 {
+		return timestamp + uint32(-lyric.Offset)
+	}
+	if timestamp > uint32(lyric.Offset) {
+		return timestamp - uint32(lyric.Offset)
+	}
+	return 0
+}
+
+// setHeader sets the metadata tag, unknown tags are kept in Headers
+func (lyric *Lyric) setHeader(key, value string) error {
+
+	value = strings.TrimSpace(value)
+
+	switch strings.ToLower(key) {
+	case "ti":
+		lyric.Title = value
+	case "ar":
+		lyric.Artist = value
+	case "al":
+		lyric.Album = value
+	case "au":
+		lyric.Author = value
+	case "length":
+		lyric.Length = value
+	case "by":
+		lyric.ByCreator = value
+	case "re":
+		lyric.RePlayerEditor = value
+	case "ve":
+		lyric.VersionPlayerEditor = value
+	case "offset":
+		offset, err := strconv.Atoi(strings.ReplaceAll(value, " ", ""))
+		if err != nil {
+			return tracerr.Wrap(err)
+		}
+		lyric.Offset = int32(offset)
+	default:
+		lyric.Headers = append(lyric.Headers, Header{Key: key, Value: value})
+	}
+
+	return nil
+}
+
+// parseWords parses the word timestamps of an enhanced lrc line, the text
+// before the first word timestamp starts at the timestamp of the line. It
+// returns nil for lines without word timestamps.
+func parseWords(line string, lineTimestamp uint32) ([]Word, error) {
+
+	matches := wordPattern.FindAllStringSubmatchIndex(line, -1)
+	if matches == nil {
+		return nil, nil
+	}
+
+	var words []Word
+
+	if leading := line[:matches[0][0]]; strings.TrimSpace(leading) != "" {
+		words = append(words, Word{
+			Timestamp: lineTimestamp,
+			Text:      strings.TrimLeft(leading, " "),
+		})
+	}
+
+	for i, match := range matches {
+		timestamp, err := parseLrcTime(line[match[2]:match[3]])
+		if err != nil {
+			return nil, err
+		}
+
+		end := len(line)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+
+		words = append(words, Word{
+			Timestamp: timestamp,
+			Text:      line[match[1]:end],
+		})
+	}
+
+	return words, nil
+}
+
 // parseLrcTime parses a lrc subtitle time (ms since start of song)
 func parseLrcTime(in string) (uint32, error) {
 	in = strings.TrimPrefix(in, "[")
@@ -153,7 +264,11 @@ func parseLrcTime(in string) (uint32, error) {
 	in = strings.Replace(in, ",", ":", -1)
 	in = strings.Replace(in, ".", ":", -1)
 
-	if strings.Count(in, ":") == 2 {
+	switch strings.Count(in, ":") {
+	case 1:
+		// without fraction of a second
+		in += ":000:000"
+	case 2:
 		in += ":000"
 	}
 
@@ -162,6 +277,12 @@ func parseLrcTime(in string) (uint32, error) {
 	if len(matches) < 5 {
 		return 0, fmt.Errorf("[lrc] Regexp didnt match: %s", in)
 	}
+	// the fraction of a second is written with 2 digits in most lrc files
+	// and with 3 digits by AsLRC, e.g. .5, .50 and .500 are 500ms
+	for len(matches[3]) < 3 {
+		matches[3] += "0"
+	}
+	matches[3] = matches[3][:3]
 	m, err := strconv.Atoi(matches[1])
 	if err != nil {
 		return 0, err
@@ -201,6 +322,7 @@ func (lyric *Lyric) mergeLRC() {
 	lenLyric := len(lyric.UnsyncedCaptions)
 	for i := 0; i < lenLyric-1; i++ {
 		if lyric.UnsyncedCaptions[i].Timestamp+2000 > lyric.UnsyncedCaptions[i+1].Timestamp && lyric.UnsyncedCaptions[i].Text != "" {
+			lyric.UnsyncedCaptions[i].Words = mergeWords(lyric.UnsyncedCaptions[i], lyric.UnsyncedCaptions[i+1])
 			lyric.UnsyncedCaptions[i].Text = lyric.UnsyncedCaptions[i].Text + " " + lyric.UnsyncedCaptions[i+1].Text
 			lyric.UnsyncedCaptions = removeUnsynced(lyric.UnsyncedCaptions, i+1)
 			i--
@@ -224,6 +346,56 @@ func (lyric *Lyric) mergeSyncLRC() {
 	}
 }
 
+// mergeWords returns the words of the two captions merged in one line, lines
+// without word timestamps become one word. It returns nil if neither caption
+// has word timestamps.
+func mergeWords(first, second UnsyncedCaption) []Word {
+
+	if first.Words == nil && second.Words == nil {
+		return nil
+	}
+
+	words := first.words()
+	if last := len(words) - 1; !strings.HasSuffix(words[last].Text, " ") {
+		words[last].Text += " "
+	}
+
+	return append(words, second.words()...)
+}
+
+// words returns the words of the caption, the whole text is one word for
+// lines without word timestamps
+func (cap UnsyncedCaption) words() []Word {
+	if cap.Words != nil {
+		return append([]Word(nil), cap.Words...)
+	}
+	return []Word{{Timestamp: cap.Timestamp, Text: cap.Text}}
+}
+
+// Shift moves the caption and its words by delta milliseconds, timestamps
+// stop at 0
+func (cap UnsyncedCaption) Shift(delta int) UnsyncedCaption {
+
+	shift := func(timestamp uint32) uint32 {
+		shifted := int64(timestamp) + int64(delta)
+		if shifted < 0 {
+			return 0
+		}
+		return uint32(shifted)
+	}
+
+	cap.Timestamp = shift(cap.Timestamp)
+	if cap.Words != nil {
+		words := make([]Word, len(cap.Words))
+		for i, word := range cap.Words {
+			words[i] = Word{Timestamp: shift(word.Timestamp), Text: word.Text}
+		}
+		cap.Words = words
+	}
+
+	return cap
+}
+
 func removeUnsynced(slice []UnsyncedCaption, s int) []UnsyncedCaption {
 	return append(slice[:s], slice[s+1:]...)
 }
@@ -232,11 +404,30 @@ func removeSynced(slice []id3v2.SyncedText, s int) []id3v2.SyncedText {
 	return append(slice[:s], slice[s+1:]...)
 }
 
-// AsLRC renders the sub in .lrc format
+// AsLRC renders the sub in .lrc format, the metadata tags come first
 func (lyric *Lyric) AsLRC() (res string) {
+
+	headers := []Header{
+		{"ti", lyric.Title},
+		{"ar", lyric.Artist},
+		{"al", lyric.Album},
+		{"au", lyric.Author},
+		{"length", lyric.Length},
+		{"by", lyric.ByCreator},
+	}
 	if lyric.Offset != 0 {
-		stringOffset := strconv.Itoa(int(lyric.Offset))
-		res += "[offset:" + stringOffset + "]" + eol
+		headers = append(headers, Header{"offset", strconv.Itoa(int(lyric.Offset))})
+	}
+	headers = append(headers,
+		Header{"re", lyric.RePlayerEditor},
+		Header{"ve", lyric.VersionPlayerEditor},
+	)
+	headers = append(headers, lyric.Headers...)
+
+	for _, header := range headers {
+		if header.Value != "" {
+			res += "[" + header.Key + ":" + header.Value + "]" + eol
+		}
 	}
 
 	for _, cap := range lyric.UnsyncedCaptions {
@@ -248,8 +439,13 @@ func (lyric *Lyric) AsLRC() (res string) {
 // asLRC renders the caption as one line in lrc
 func (cap UnsyncedCaption) asLRC() string {
 	res := "[" + timeLRC(cap.Timestamp) + "]"
-	res += cap.Text + eol
-	return res
+	if cap.Words == nil {
+		return res + cap.Text + eol
+	}
+	for _, word := range cap.Words {
+		res += "<" + timeLRC(word.Timestamp) + ">" + word.Text
+	}
+	return res + eol
 }
 
 // timeLRC renders a timestamp for use in lrc
@@ -289,3 +485,61 @@ func (lyric *Lyric) GetText(time int) (string, error) {
 
 	return text, nil
 }
+
+// HasWords reports whether the lyric has word timestamps
+func (lyric *Lyric) HasWords() bool {
+	for _, cap := range lyric.UnsyncedCaptions {
+		if cap.Words != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Karaoke returns the caption shown at time in milliseconds split at the word
+// being sung, sung contains the words started at time. Like GetText, captions
+// are shown one second earlier. ok is false if the caption has no word
+// timestamps.
+func (lyric *Lyric) Karaoke(time int) (sung, rest string, ok bool) {
+
+	index := -1
+	for i, cap := range lyric.UnsyncedCaptions {
+		if time+1000 < int(lyric.applyOffset(cap.Timestamp)) {
+			break
+		}
+		index = i
+	}
+
+	if index < 0 || lyric.UnsyncedCaptions[index].Words == nil {
+		return "", "", false
+	}
+
+	var sungText, restText strings.Builder
+	for _, word := range lyric.UnsyncedCaptions[index].Words {
+		if time >= int(lyric.applyOffset(word.Timestamp)) {
+			sungText.WriteString(word.Text)
+		} else {
+			restText.WriteString(word.Text)
+		}
+	}
+
+	return sungText.String(), restText.String(), true
+}
+
+// CaptionAt returns the index of the synced caption shown at time in
+// milliseconds, -1 before the first caption. Like GetText, captions are shown
+// one second earlier.
+func (lyric *Lyric) CaptionAt(time int) int {
+
+	time += 1000
+
+	index := -1
+	for i, v := range lyric.SyncedCaptions {
+		if time < int(v.Timestamp) {
+			break
+		}
+		index = i
+	}
+
+	return index
+}
@@ -25,6 +25,18 @@ type LyricFetcher interface {
 	LyricOptions(search string) ([]*SongTag, error)
 }
 
+// TranslationFetcher is implemented by the fetchers returning a translation
+// along with the lyric, translation is empty if there is none
+type TranslationFetcher interface {
+	LyricFetchTranslation(songTag *SongTag) (lyric, translation string, err error)
+}
+
+// TranslationLang returns the language of the translation of a lyric in
+// langExt, it is used as the content descriptor of the translation
+func TranslationLang(langExt string) string {
+	return langExt + "-tr"
+}
+
 // cleanHTML parses html text to valid utf-8 text
 func cleanHTML(input string) string {
 
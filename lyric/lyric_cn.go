@@ -42,18 +42,41 @@ type tagLyric struct {
 	Tlyric string `json:"tlyric"`
 }
 
-type LyricFetcherCn struct{}
+// LyricFetcherCn fetches chinese lyrics from netease and kugou through the
+// sunyj api
+type LyricFetcherCn struct {
+	// BaseURL is the address of the api, the default one is used if empty
+	BaseURL string
+}
+
+func init() {
+	Register(Provider{
+		Name:      "sunyj",
+		Languages: []string{"zh-CN"},
+		BaseURL:   "http://api.sunyj.xyz",
+		New: func(baseURL string) LyricFetcher {
+			return LyricFetcherCn{BaseURL: baseURL}
+		},
+	})
+}
+
+func (cn LyricFetcherCn) baseURL() string {
+	if cn.BaseURL == "" {
+		return providers["sunyj"].BaseURL
+	}
+	return cn.BaseURL
+}
 
 // LyricOptions queries available song lyrics. It returns slice of SongTag
 func (cn LyricFetcherCn) LyricOptions(search string) ([]*SongTag, error) {
 
 	serviceProvider := "netease"
-	results, err := getLyricOptionsCnByProvider(search, serviceProvider)
+	results, err := cn.getLyricOptionsByProvider(search, serviceProvider)
 	if err != nil {
 		return nil, tracerr.Wrap(err)
 	}
 	serviceProvider = "kugou"
-	results2, err := getLyricOptionsCnByProvider(search, serviceProvider)
+	results2, err := cn.getLyricOptionsByProvider(search, serviceProvider)
 	if err != nil {
 		return nil, tracerr.Wrap(err)
 	}
@@ -66,43 +89,55 @@ func (cn LyricFetcherCn) LyricOptions(search string) ([]*SongTag, error) {
 // LyricFetch should receive songTag that was returned from getLyricOptions
 // and returns lyric of the queried song.
 func (cn LyricFetcherCn) LyricFetch(songTag *SongTag) (lyricString string, err error) {
+	lyricString, _, err = cn.LyricFetchTranslation(songTag)
+	return lyricString, err
+}
+
+// LyricFetchTranslation returns the lyric of the queried song and its
+// translation, the translation is empty if there is none.
+func (cn LyricFetcherCn) LyricFetchTranslation(songTag *SongTag) (lyricString, translation string, err error) {
 
-	urlSearch := "http://api.sunyj.xyz"
+	urlSearch := cn.baseURL()
 
 	params := url.Values{}
 	params.Add("site", songTag.ServiceProvider)
 	params.Add("lyric", songTag.LyricID)
 	resp, err := http.Get(urlSearch + "?" + params.Encode())
 	if err != nil {
-		return "", tracerr.Wrap(err)
+		return "", "", tracerr.Wrap(err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("http response error: %d", resp.StatusCode)
+		return "", "", fmt.Errorf("http response error: %d", resp.StatusCode)
 	}
 
 	var tagLyric tagLyric
 	err = json.NewDecoder(resp.Body).Decode(&tagLyric)
 	if err != nil {
-		return "", tracerr.Wrap(err)
+		return "", "", tracerr.Wrap(err)
 	}
 	lyricString = tagLyric.Lyric
 	if lyricString == "" {
-		return "", errors.New("no lyric available")
+		return "", "", errors.New("no lyric available")
 	}
 
-	if looksLikeLRC(lyricString) {
-		lyricString = cleanLRC(lyricString)
-		return lyricString, nil
+	if !looksLikeLRC(lyricString) {
+		return "", "", errors.New("lyric not compatible")
 	}
-	return "", errors.New("lyric not compatible")
+
+	// the translation is dropped if it is not synced
+	if looksLikeLRC(tagLyric.Tlyric) {
+		translation = cleanLRC(tagLyric.Tlyric)
+	}
+
+	return cleanLRC(lyricString), translation, nil
 }
 
-// getLyricOptionsCnByProvider do the query by provider
-func getLyricOptionsCnByProvider(search string, serviceProvider string) (resultTags []*SongTag, err error) {
+// getLyricOptionsByProvider do the query by provider
+func (cn LyricFetcherCn) getLyricOptionsByProvider(search string, serviceProvider string) (resultTags []*SongTag, err error) {
 
-	urlSearch := "http://api.sunyj.xyz"
+	urlSearch := cn.baseURL()
 
 	params := url.Values{}
 	params.Add("site", serviceProvider)
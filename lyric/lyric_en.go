@@ -8,7 +8,32 @@ import (
 	"github.com/gocolly/colly"
 )
 
-type LyricFetcherEn struct{}
+// LyricFetcherEn fetches english lyrics from rentanadviser
+type LyricFetcherEn struct {
+	// BaseURL is the address of the site, the default one is used if empty
+	BaseURL string
+}
+
+func init() {
+	Register(Provider{
+		Name:      "rentanadviser",
+		Languages: []string{"en"},
+		BaseURL:   "https://www.rentanadviser.com",
+		// the default provider of english lyrics, lrclib is chosen in the
+		// config
+		Priority: 1,
+		New: func(baseURL string) LyricFetcher {
+			return LyricFetcherEn{BaseURL: baseURL}
+		},
+	})
+}
+
+func (en LyricFetcherEn) baseURL() string {
+	if en.BaseURL == "" {
+		return providers["rentanadviser"].BaseURL
+	}
+	return en.BaseURL
+}
 
 // LyricFetch should receive SongTag that was returned from GetLyricOptions, and
 // returns lyric of the queried song.
@@ -58,7 +83,7 @@ func (en LyricFetcherEn) LyricOptions(search string) ([]*SongTag, error) {
 	})
 
 	query := url.QueryEscape(search)
-	err := c.Visit("https://www.rentanadviser.com/en/subtitles/subtitles4songs.aspx?src=" + query)
+	err := c.Visit(en.baseURL() + "/en/subtitles/subtitles4songs.aspx?src=" + query)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,265 @@
+package lyric
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ztrue/tracerr"
+)
+
+// MatchTolerance is the largest difference between the duration of a song and
+// the one of a lyric matching it
+const MatchTolerance = 2 * time.Second
+
+// Track is the metadata of a song used to find its lyric
+type Track struct {
+	Artist   string
+	Title    string
+	Album    string
+	Duration time.Duration
+}
+
+// Match is a lyric found for a track
+type Match struct {
+	SongTag *SongTag
+	// Lyric is the lrc lyric, it is empty if the provider has no synced lyric
+	Lyric string
+	// Diff is the difference between the duration of the lyric and the one of
+	// the track, matches closer in duration are better
+	Diff time.Duration
+}
+
+// LyricMatcher is implemented by the providers finding lyrics from the
+// metadata of the song without asking the user
+type LyricMatcher interface {
+	LyricMatch(track Track) ([]Match, error)
+}
+
+// BestMatch returns the synced match closest in duration within
+// MatchTolerance, nil if there is none. The match is ambiguous if another
+// synced match with a different lyric is as close.
+func BestMatch(matches []Match) (best *Match, ambiguous bool) {
+
+	var candidates []Match
+	for _, match := range matches {
+		if match.Lyric != "" && match.Diff <= MatchTolerance {
+			candidates = append(candidates, match)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return nil, false
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Diff < candidates[j].Diff
+	})
+
+	best = &candidates[0]
+	for _, match := range candidates[1:] {
+		if match.Diff-best.Diff < 500*time.Millisecond && match.Lyric != best.Lyric {
+			ambiguous = true
+		}
+	}
+
+	return best, ambiguous
+}
+
+// LyricFetcherLrclib fetches synced lyrics of any language from lrclib
+type LyricFetcherLrclib struct {
+	// BaseURL is the address of the api, the default one is used if empty
+	BaseURL string
+}
+
+func init() {
+	Register(Provider{
+		Name:      "lrclib",
+		Languages: []string{"en"},
+		BaseURL:   "https://lrclib.net",
+		New: func(baseURL string) LyricFetcher {
+			return LyricFetcherLrclib{BaseURL: baseURL}
+		},
+	})
+}
+
+// tagLrclib is a lyric record of lrclib, duration is in seconds
+type tagLrclib struct {
+	ID           int64   `json:"id"`
+	TrackName    string  `json:"trackName"`
+	ArtistName   string  `json:"artistName"`
+	AlbumName    string  `json:"albumName"`
+	Duration     float64 `json:"duration"`
+	Instrumental bool    `json:"instrumental"`
+	PlainLyrics  string  `json:"plainLyrics"`
+	SyncedLyrics string  `json:"syncedLyrics"`
+}
+
+func (l LyricFetcherLrclib) baseURL() string {
+	if l.BaseURL == "" {
+		return providers["lrclib"].BaseURL
+	}
+	return l.BaseURL
+}
+
+// get decodes the json response of the api endpoint
+func (l LyricFetcherLrclib) get(endpoint string, params url.Values, v interface{}) error {
+
+	u := l.baseURL() + endpoint
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+	req.Header.Set("User-Agent", "gomu (https://github.com/issadarkthing/gomu)")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("http response error: %d", resp.StatusCode)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(v)
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+
+	return nil
+}
+
+func (tag tagLrclib) songTag() *SongTag {
+	return &SongTag{
+		Artist:          tag.ArtistName,
+		Title:           tag.TrackName,
+		Album:           tag.AlbumName,
+		TitleForPopup:   fmt.Sprintf("%s - %s : %s", tag.ArtistName, tag.TrackName, tag.AlbumName),
+		LangExt:         "en",
+		ServiceProvider: "lrclib",
+		SongID:          strconv.FormatInt(tag.ID, 10),
+		LyricID:         strconv.FormatInt(tag.ID, 10),
+	}
+}
+
+// LyricOptions queries available song lyrics. It returns slice of SongTag
+func (l LyricFetcherLrclib) LyricOptions(search string) ([]*SongTag, error) {
+
+	params := url.Values{}
+	params.Add("q", search)
+
+	var tags []tagLrclib
+	err := l.get("/api/search", params, &tags)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+
+	var results []*SongTag
+	for _, tag := range tags {
+		if tag.SyncedLyrics != "" {
+			results = append(results, tag.songTag())
+		}
+	}
+
+	return results, nil
+}
+
+// LyricFetch should receive SongTag that was returned from LyricOptions, and
+// returns the synced lyric of the queried song.
+func (l LyricFetcherLrclib) LyricFetch(songTag *SongTag) (string, error) {
+
+	var tag tagLrclib
+	err := l.get("/api/get/"+url.PathEscape(songTag.LyricID), nil, &tag)
+	if err != nil {
+		return "", tracerr.Wrap(err)
+	}
+
+	if tag.SyncedLyrics == "" {
+		return "", errors.New("no lyric available")
+	}
+
+	return cleanLRC(tag.SyncedLyrics), nil
+}
+
+// match scores the record by the difference of duration with the track, the
+// album of the track is preferred
+func (tag tagLrclib) match(track Track) Match {
+
+	duration := time.Duration(tag.Duration * float64(time.Second))
+	diff := time.Duration(math.Abs(float64(duration - track.Duration)))
+
+	// a lyric of another release of the song is slightly worse
+	if track.Album != "" && !strings.EqualFold(tag.AlbumName, track.Album) {
+		diff += 100 * time.Millisecond
+	}
+
+	match := Match{SongTag: tag.songTag(), Diff: diff}
+	if tag.SyncedLyrics != "" {
+		match.Lyric = cleanLRC(tag.SyncedLyrics)
+	}
+
+	return match
+}
+
+// LyricMatch gets the lyric of the track by artist, title, album and duration
+// when they are all known. Otherwise, or if lrclib has no synced lyric of this
+// release, the lyrics are searched by title and artist and the matches are
+// scored by the difference of duration.
+func (l LyricFetcherLrclib) LyricMatch(track Track) ([]Match, error) {
+
+	if track.Title == "" {
+		return nil, errors.New("the song has no title")
+	}
+
+	if track.Artist != "" && track.Album != "" && track.Duration > 0 {
+		params := url.Values{}
+		params.Add("track_name", track.Title)
+		params.Add("artist_name", track.Artist)
+		params.Add("album_name", track.Album)
+		params.Add("duration", strconv.Itoa(int(math.Round(track.Duration.Seconds()))))
+
+		// the release is not known by lrclib if it fails
+		var tag tagLrclib
+		err := l.get("/api/get", params, &tag)
+		if err == nil && !tag.Instrumental && tag.SyncedLyrics != "" {
+			return []Match{tag.match(track)}, nil
+		}
+	}
+
+	params := url.Values{}
+	params.Add("track_name", track.Title)
+	if track.Artist != "" {
+		params.Add("artist_name", track.Artist)
+	}
+
+	var tags []tagLrclib
+	err := l.get("/api/search", params, &tags)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+
+	var matches []Match
+	for _, tag := range tags {
+		if !tag.Instrumental {
+			matches = append(matches, tag.match(track))
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Diff < matches[j].Diff
+	})
+
+	return matches, nil
+}
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/tramhao/id3v2"
 )
 
 func TestCleanHTML(t *testing.T) {
@@ -29,3 +30,128 @@ func TestCleanHTML(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestCaptionAt(t *testing.T) {
+
+	lyric := Lyric{SyncedCaptions: []id3v2.SyncedText{
+		{Timestamp: 5000, Text: "first"},
+		{Timestamp: 9000, Text: "second"},
+		{Timestamp: 15000, Text: "third"},
+	}}
+
+	assert.Equal(t, -1, lyric.CaptionAt(0))
+	// captions are shown one second earlier
+	assert.Equal(t, 0, lyric.CaptionAt(4000))
+	assert.Equal(t, 0, lyric.CaptionAt(7999))
+	assert.Equal(t, 1, lyric.CaptionAt(8000))
+	assert.Equal(t, 2, lyric.CaptionAt(60000))
+
+	assert.Equal(t, -1, (&Lyric{}).CaptionAt(1000))
+}
+
+func TestEnhancedLRC(t *testing.T) {
+
+	lrc := `[ti:Song]
+[ar:Artist]
+[au:Author]
+[by:Someone]
+[offset:500]
+[la:en]
+[00:10.00]<00:10.00>Word <00:10.50>by <00:11.00>word
+[00:20.5]Plain line
+`
+
+	var lyric Lyric
+	err := lyric.NewFromLRC(lrc)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "Song", lyric.Title)
+	assert.Equal(t, "Artist", lyric.Artist)
+	assert.Equal(t, "Author", lyric.Author)
+	assert.Equal(t, "Someone", lyric.ByCreator)
+	assert.Equal(t, int32(500), lyric.Offset)
+	assert.Equal(t, []Header{{"la", "en"}}, lyric.Headers)
+
+	assert.Equal(t, []UnsyncedCaption{
+		{Timestamp: 10000, Text: "Word by word", Words: []Word{
+			{10000, "Word "}, {10500, "by "}, {11000, "word"},
+		}},
+		{Timestamp: 20500, Text: "Plain line"},
+	}, lyric.UnsyncedCaptions)
+	assert.Equal(t, "Word by word", lyric.SyncedCaptions[0].Text)
+	assert.Equal(t, uint32(9500), lyric.SyncedCaptions[0].Timestamp)
+
+	// the metadata and the words are kept
+	var again Lyric
+	err = again.NewFromLRC(lyric.AsLRC())
+	assert.NoError(t, err)
+	assert.Equal(t, lyric, again)
+	assert.Equal(t, `[ti:Song]
+[ar:Artist]
+[au:Author]
+[by:Someone]
+[offset:500]
+[la:en]
+[00:10.000]<00:10.000>Word <00:10.500>by <00:11.000>word
+[00:20.500]Plain line
+`, lyric.AsLRC())
+
+	assert.True(t, lyric.HasWords())
+}
+
+func TestKaraoke(t *testing.T) {
+
+	var lyric Lyric
+	err := lyric.NewFromLRC("[00:10.00]<00:10.00>Word <00:10.50>by <00:11.00>word\n[00:20.00]Plain\n")
+	assert.NoError(t, err)
+
+	_, _, ok := lyric.Karaoke(5000)
+	assert.False(t, ok)
+
+	// the line is shown one second earlier
+	sung, rest, ok := lyric.Karaoke(9000)
+	assert.True(t, ok)
+	assert.Equal(t, "", sung)
+	assert.Equal(t, "Word by word", rest)
+
+	sung, rest, _ = lyric.Karaoke(10600)
+	assert.Equal(t, "Word by ", sung)
+	assert.Equal(t, "word", rest)
+
+	_, _, ok = lyric.Karaoke(19500)
+	assert.False(t, ok)
+}
+
+func TestMergeWords(t *testing.T) {
+
+	var lyric Lyric
+	err := lyric.NewFromLRC("[00:10.00]<00:10.00>One <00:10.50>two\n[00:11.00]three\n")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []UnsyncedCaption{
+		{Timestamp: 10000, Text: "One two three", Words: []Word{
+			{10000, "One "}, {10500, "two "}, {11000, "three"},
+		}},
+	}, lyric.UnsyncedCaptions)
+
+	shifted := lyric.UnsyncedCaptions[0].Shift(-10200)
+	assert.Equal(t, uint32(0), shifted.Timestamp)
+	assert.Equal(t, []Word{{0, "One "}, {300, "two "}, {800, "three"}}, shifted.Words)
+	// the words of the lyric are not changed
+	assert.Equal(t, uint32(10500), lyric.UnsyncedCaptions[0].Words[1].Timestamp)
+}
+
+func TestParseLrcTime(t *testing.T) {
+
+	for in, expected := range map[string]uint32{
+		"[00:12.5]":   12500,
+		"[00:12.50]":  12500,
+		"[00:12.500]": 12500,
+		"[01:02]":     62000,
+		"00:00.07":    70,
+	} {
+		got, err := parseLrcTime(in)
+		assert.NoError(t, err, in)
+		assert.Equal(t, expected, got, in)
+	}
+}
@@ -0,0 +1,90 @@
+package lyric
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/ztrue/tracerr"
+)
+
+// Provider is a source of lyrics registered with Register
+type Provider struct {
+	Name string
+	// Languages are the languages of the lyrics returned by the provider
+	Languages []string
+	// BaseURL is the default address of the provider, it can be replaced
+	// e.g. by a mirror or a test server
+	BaseURL string
+	// Priority orders the providers of a language, the one with the highest
+	// priority is the default provider of the language
+	Priority int
+	// New returns the fetcher querying the provider at baseURL
+	New func(baseURL string) LyricFetcher
+}
+
+var providers = map[string]Provider{}
+
+// Register makes the provider available by its name, registering a provider
+// twice replaces it
+func Register(provider Provider) {
+	providers[provider.Name] = provider
+}
+
+// Providers returns the registered providers sorted by name
+func Providers() []Provider {
+
+	result := make([]Provider, 0, len(providers))
+	for _, provider := range providers {
+		result = append(result, provider)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+// ProvidersFor returns the providers of lyrics in lang, the highest priority
+// first and then by name
+func ProvidersFor(lang string) []Provider {
+
+	var result []Provider
+	for _, provider := range Providers() {
+		if provider.Supports(lang) {
+			result = append(result, provider)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Priority > result[j].Priority
+	})
+
+	return result
+}
+
+// Supports reports whether the provider returns lyrics in lang
+func (p Provider) Supports(lang string) bool {
+	for _, v := range p.Languages {
+		if strings.EqualFold(v, lang) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewFetcher returns the fetcher of the provider, the default base url is
+// used if baseURL is empty
+func NewFetcher(name, baseURL string) (LyricFetcher, error) {
+
+	provider, ok := providers[name]
+	if !ok {
+		return nil, tracerr.Errorf("unknown lyric provider: %s", name)
+	}
+
+	if baseURL == "" {
+		baseURL = provider.BaseURL
+	}
+
+	return provider.New(strings.TrimSuffix(baseURL, "/")), nil
+}
@@ -0,0 +1,261 @@
+package lyric
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRentanadviser serves a search page with one song and its lrc page
+func fakeRentanadviser() *httptest.Server {
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/en/subtitles/subtitles4songs.aspx", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<div id="tablecontainer"><table><tr><td>
+			<a href="/en/subtitles/getsubtitle.aspx?song=%s">Artist - %s</a>
+		</td></tr></table></div>`, r.URL.Query().Get("src"), r.URL.Query().Get("src"))
+	})
+
+	mux.HandleFunc("/en/subtitles/getsubtitle.aspx", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("type") != "lrc" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<span id="ctl00_ContentPlaceHolder1_lbllyrics"><h3>Artist - Song</h3>
+[00:01.00]first line<br/>
+[00:03.00]second line<br/></span>`)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+// fakeSunyj serves the search and lyric api of netease and kugou
+func fakeSunyj() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		switch {
+		case r.URL.Path != "/":
+			http.NotFound(w, r)
+		case query.Get("lyric") != "":
+			fmt.Fprintf(w, `{"lyric": "[00:01.00]%s %s", "tlyric": "[00:01.00]translation"}`,
+				query.Get("site"), query.Get("lyric"))
+		case query.Get("site") == "netease":
+			fmt.Fprint(w, `[{"album": "Album", "artist": ["A", "B"], "id": 1,
+				"lyric_id": 2, "name": "Song", "source": "netease"}]`)
+		case query.Get("site") == "kugou":
+			fmt.Fprint(w, `[{"album": "Album", "artist": ["C"], "id": "x",
+				"lyric_id": "y", "name": "Song", "source": "kugou"}]`)
+		default:
+			http.Error(w, "bad request", http.StatusBadRequest)
+		}
+	}))
+}
+
+func TestRegistry(t *testing.T) {
+
+	var names []string
+	for _, provider := range Providers() {
+		names = append(names, provider.Name)
+	}
+	assert.Subset(t, names, []string{"lrclib", "rentanadviser", "sunyj"})
+
+	providers := ProvidersFor("zh-cn")
+	assert.Len(t, providers, 1)
+	assert.Equal(t, "sunyj", providers[0].Name)
+
+	// rentanadviser stays the default provider of english lyrics
+	providers = ProvidersFor("en")
+	assert.Equal(t, "rentanadviser", providers[0].Name)
+
+	fetcher, err := NewFetcher("sunyj", "http://localhost:1234/")
+	assert.NoError(t, err)
+	assert.Equal(t, LyricFetcherCn{BaseURL: "http://localhost:1234"}, fetcher)
+
+	fetcher, err = NewFetcher("rentanadviser", "")
+	assert.NoError(t, err)
+	assert.Equal(t, LyricFetcherEn{BaseURL: "https://www.rentanadviser.com"}, fetcher)
+
+	_, err = NewFetcher("unknown", "")
+	assert.Error(t, err)
+}
+
+func TestLyricFetcherEn(t *testing.T) {
+
+	server := fakeRentanadviser()
+	defer server.Close()
+
+	fetcher, err := NewFetcher("rentanadviser", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options, err := fetcher.LyricOptions("Song")
+	assert.NoError(t, err)
+	assert.Len(t, options, 1)
+	assert.Equal(t, "Artist - Song", options[0].TitleForPopup)
+	assert.Equal(t, "en", options[0].LangExt)
+
+	lyric, err := fetcher.LyricFetch(options[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "[00:01.00]first line\n[00:03.00]second line\n", lyric)
+}
+
+func TestLyricFetcherCn(t *testing.T) {
+
+	server := fakeSunyj()
+	defer server.Close()
+
+	fetcher, err := NewFetcher("sunyj", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options, err := fetcher.LyricOptions("Song")
+	assert.NoError(t, err)
+	assert.Len(t, options, 2)
+	assert.Equal(t, "A B - Song : Album", options[0].TitleForPopup)
+	assert.Equal(t, "2", options[0].LyricID)
+	assert.Equal(t, "kugou", options[1].ServiceProvider)
+
+	lyric, err := fetcher.LyricFetch(options[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "[00:01.00]netease 2", lyric)
+
+	lyric, translation, err := fetcher.(TranslationFetcher).LyricFetchTranslation(options[1])
+	assert.NoError(t, err)
+	assert.Equal(t, "[00:01.00]kugou y", lyric)
+	assert.Equal(t, "[00:01.00]translation", translation)
+
+	// errors of the api are returned
+	_, err = LyricFetcherCn{BaseURL: server.URL + "/missing"}.LyricOptions("Song")
+	assert.Error(t, err)
+}
+
+// fakeLrclib serves the search and get api with three records of a song
+func fakeLrclib() *httptest.Server {
+
+	records := map[string]string{
+		"1": `{"id": 1, "trackName": "Song", "artistName": "Artist", "albumName": "Live",
+			"duration": 200.5, "syncedLyrics": "[00:01.00]live"}`,
+		"2": `{"id": 2, "trackName": "Song", "artistName": "Artist", "albumName": "Album",
+			"duration": 181, "syncedLyrics": "[00:01.00]album"}`,
+		"3": `{"id": 3, "trackName": "Song", "artistName": "Artist", "albumName": "Album",
+			"duration": 180, "plainLyrics": "plain", "syncedLyrics": null}`,
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/api/search", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("q") == "" && query.Get("track_name") != "Song" {
+			fmt.Fprint(w, "[]")
+			return
+		}
+		fmt.Fprintf(w, "[%s, %s, %s]", records["1"], records["2"], records["3"])
+	})
+
+	// the release of the second record is known
+	mux.HandleFunc("/api/get", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("track_name") != "Song" || query.Get("artist_name") != "Artist" ||
+			query.Get("album_name") != "Album" || query.Get("duration") != "181" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, records["2"])
+	})
+
+	mux.HandleFunc("/api/get/", func(w http.ResponseWriter, r *http.Request) {
+		record, ok := records[r.URL.Path[len("/api/get/"):]]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, record)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestLyricFetcherLrclib(t *testing.T) {
+
+	server := fakeLrclib()
+	defer server.Close()
+
+	fetcher, err := NewFetcher("lrclib", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the synced lyrics are listed
+	options, err := fetcher.LyricOptions("Artist Song")
+	assert.NoError(t, err)
+	assert.Len(t, options, 2)
+	assert.Equal(t, "Artist - Song : Album", options[1].TitleForPopup)
+
+	lyric, err := fetcher.LyricFetch(options[1])
+	assert.NoError(t, err)
+	assert.Equal(t, "[00:01.00]album", lyric)
+
+	_, err = fetcher.LyricFetch(&SongTag{LyricID: "3"})
+	assert.Error(t, err)
+
+	// the lyric of the release is used without searching
+	matches, err := fetcher.(LyricMatcher).LyricMatch(Track{
+		Artist:   "Artist",
+		Title:    "Song",
+		Album:    "Album",
+		Duration: 181 * time.Second,
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, matches, 1) {
+		assert.Equal(t, "[00:01.00]album", matches[0].Lyric)
+		assert.Equal(t, time.Duration(0), matches[0].Diff)
+	}
+
+	matches, err = fetcher.(LyricMatcher).LyricMatch(Track{
+		Artist:   "Artist",
+		Title:    "Song",
+		Album:    "Album",
+		Duration: 180 * time.Second,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, matches, 3)
+
+	// the plain lyric is the closest but only synced lyrics are embedded
+	best, ambiguous := BestMatch(matches)
+	assert.False(t, ambiguous)
+	assert.Equal(t, "[00:01.00]album", best.Lyric)
+	assert.Equal(t, time.Second, best.Diff)
+
+	matches, err = fetcher.(LyricMatcher).LyricMatch(Track{Title: "Other"})
+	assert.NoError(t, err)
+	assert.Empty(t, matches)
+}
+
+func TestBestMatch(t *testing.T) {
+
+	best, _ := BestMatch([]Match{{Lyric: "far", Diff: 3 * time.Second}})
+	assert.Nil(t, best)
+
+	best, ambiguous := BestMatch([]Match{
+		{Lyric: "second", Diff: 1200 * time.Millisecond},
+		{Lyric: "first", Diff: time.Second},
+	})
+	assert.Equal(t, "first", best.Lyric)
+	assert.True(t, ambiguous)
+
+	// the same lyric from another release is not ambiguous
+	_, ambiguous = BestMatch([]Match{
+		{Lyric: "first", Diff: time.Second},
+		{Lyric: "first", Diff: time.Second},
+	})
+	assert.False(t, ambiguous)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/ztrue/tracerr"
+
+	"github.com/issadarkthing/gomu/lyric"
+)
+
+// lyricSource is a language of General.lang_lyric and the provider chosen for
+// it, provider is empty to use the first provider of the language
+type lyricSource struct {
+	lang     string
+	provider string
+}
+
+// parseLyricSources parses the languages separated by comma, a provider is
+// chosen after a colon e.g. "en:rentanadviser,zh-CN"
+func parseLyricSources(value string) []lyricSource {
+
+	var sources []lyricSource
+	for _, field := range strings.Split(value, ",") {
+		lang := strings.TrimSpace(field)
+		provider := ""
+		if i := strings.Index(lang, ":"); i >= 0 {
+			provider = strings.TrimSpace(lang[i+1:])
+			lang = strings.TrimSpace(lang[:i])
+		}
+		if lang != "" {
+			sources = append(sources, lyricSource{lang: lang, provider: provider})
+		}
+	}
+
+	return sources
+}
+
+// lyricSources returns the languages of General.lang_lyric
+func lyricSources() []lyricSource {
+	return parseLyricSources(gomu.anko.GetString("General.lang_lyric"))
+}
+
+// lyricLangs returns the languages of the registered providers, the preferred
+// language first
+func lyricLangs() []string {
+
+	seen := map[string]bool{}
+	for _, provider := range lyric.Providers() {
+		for _, lang := range provider.Languages {
+			seen[lang] = true
+		}
+	}
+
+	langs := make([]string, 0, len(seen))
+	for lang := range seen {
+		langs = append(langs, lang)
+	}
+
+	preferred := defaultLyricLang()
+	sort.Slice(langs, func(i, j int) bool {
+		if langs[i] == preferred || langs[j] == preferred {
+			return langs[i] == preferred
+		}
+		return langs[i] < langs[j]
+	})
+
+	return langs
+}
+
+// lyricBaseURL returns the base url of the provider set in General.lyric_urls,
+// it is empty if the default one is used
+func lyricBaseURL(name string) string {
+
+	value, err := gomu.anko.Execute("General.lyric_urls")
+	if err != nil {
+		return ""
+	}
+
+	urls, _ := value.(map[interface{}]interface{})
+	baseURL, _ := urls[name].(string)
+
+	return baseURL
+}
+
+// lyricProvider returns the name of the provider chosen for lang in
+// General.lang_lyric or else the first provider of the language
+func lyricProvider(lang string) (string, error) {
+
+	for _, source := range lyricSources() {
+		if source.lang == lang && source.provider != "" {
+			return source.provider, nil
+		}
+	}
+
+	providers := lyric.ProvidersFor(lang)
+	if len(providers) == 0 {
+		return "", tracerr.Errorf("no lyric provider for %s", lang)
+	}
+
+	return providers[0].Name, nil
+}
+
+// lyricFetcher returns the fetcher of the provider of lang
+func lyricFetcher(lang string) (lyric.LyricFetcher, error) {
+
+	name, err := lyricProvider(lang)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+
+	fetcher, err := lyric.NewFetcher(name, lyricBaseURL(name))
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+
+	return fetcher, nil
+}
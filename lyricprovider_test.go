@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/issadarkthing/gomu/lyric"
+)
+
+func TestParseLyricSources(t *testing.T) {
+
+	assert.Equal(t, []lyricSource{
+		{lang: "en", provider: "rentanadviser"},
+		{lang: "zh-CN", provider: ""},
+	}, parseLyricSources(" en : rentanadviser, zh-CN ,"))
+
+	assert.Nil(t, parseLyricSources(""))
+}
+
+func TestLyricFetcher(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+
+	_, err := gomu.anko.Execute(`
+General.lang_lyric = "zh-CN,en:rentanadviser"
+General.lyric_urls = {"sunyj": "http://localhost:8080"}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "zh-CN", defaultLyricLang())
+	assert.Equal(t, "zh-CN", lyricLangs()[0])
+
+	fetcher, err := lyricFetcher("zh-CN")
+	assert.NoError(t, err)
+	assert.Equal(t, lyric.LyricFetcherCn{BaseURL: "http://localhost:8080"}, fetcher)
+
+	fetcher, err = lyricFetcher("en")
+	assert.NoError(t, err)
+	assert.Equal(t, lyric.LyricFetcherEn{BaseURL: "https://www.rentanadviser.com"}, fetcher)
+
+	_, err = lyricFetcher("xx")
+	assert.Error(t, err)
+
+	// unknown providers are reported
+	_, err = gomu.anko.Execute(`General.lang_lyric = "en:nothing"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = lyricFetcher("en")
+	assert.Error(t, err)
+}
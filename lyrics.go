@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/ztrue/tracerr"
+
+	"github.com/issadarkthing/gomu/lyric"
+)
+
+// Lyrics shows the whole lyric of the song being played. The line being sung
+// is highlighted and kept in the middle of the panel, unsynced lyrics are
+// shown as they are.
+type Lyrics struct {
+	*tview.Box
+	// flex contains the panel, it is resized to hide the panel
+	flex    *tview.Flex
+	visible bool
+	// size and ratio of the panel in the layout
+	size  int
+	ratio int
+	// lyric is the lyric shown, the selection is reset when it changes
+	lyric *lyric.Lyric
+	// selected is the line chosen with the keys or the mouse, -1 follows the
+	// line being sung
+	selected int
+	// offset is the first line drawn
+	offset int
+}
+
+func (l *Lyrics) help() []string {
+	return keybindHelp("lyrics")
+}
+
+func newLyrics() *Lyrics {
+
+	box := tview.NewBox()
+	box.SetBorder(true).SetTitle(" Lyrics ")
+	box.SetBackgroundColor(gomu.colors.background)
+	box.SetBorderColor(gomu.colors.foreground)
+
+	l := &Lyrics{
+		Box:      box,
+		visible:  gomu.anko.GetBool("General.lyrics"),
+		ratio:    1,
+		selected: -1,
+	}
+
+	cmds := map[string]string{
+		"j": "lyrics_down",
+		"k": "lyrics_up",
+		"l": "lyrics_seek",
+	}
+
+	for key, cmdName := range cmds {
+		src := fmt.Sprintf(`Keybinds.def_l("%s", %s)`, key, cmdName)
+		gomu.anko.Execute(src)
+	}
+
+	return l
+}
+
+// place records the group containing the panel and its size in the layout
+func (l *Lyrics) place(flex *tview.Flex, size, ratio int) {
+	l.flex = flex
+	l.size = size
+	l.ratio = ratio
+}
+
+// itemSize returns the size of the panel in its group
+func (l *Lyrics) itemSize() (size, ratio int) {
+	if !l.visible {
+		return 0, 0
+	}
+	return l.size, l.ratio
+}
+
+// toggle shows or hides the panel, it returns false if the panel is not in the
+// layout
+func (l *Lyrics) toggle() bool {
+	l.visible = !l.visible
+	if l.flex == nil {
+		return false
+	}
+	size, ratio := l.itemSize()
+	l.flex.ResizeItem(l, size, ratio)
+	return true
+}
+
+// lines returns the lines of the lyric being shown, synced is false for
+// unsynced lyrics
+func (l *Lyrics) lines() (lines []string, synced bool) {
+	return lyricLines(gomu.playingBar.subtitle, gomu.playingBar.unsynced)
+}
+
+// lyricLines returns the synced captions of subtitle or the lines of the
+// unsynced text when there is no synced lyric
+func lyricLines(subtitle *lyric.Lyric, unsynced string) (lines []string, synced bool) {
+
+	if subtitle != nil && len(subtitle.SyncedCaptions) > 0 {
+		for _, caption := range subtitle.SyncedCaptions {
+			lines = append(lines, caption.Text)
+		}
+		return lines, true
+	}
+
+	unsynced = strings.TrimSpace(strings.ReplaceAll(unsynced, "\r\n", "\n"))
+	if unsynced == "" {
+		return nil, false
+	}
+
+	return strings.Split(unsynced, "\n"), false
+}
+
+// current returns the line being sung, -1 if there is none
+func (l *Lyrics) current() int {
+
+	subtitle := gomu.playingBar.subtitle
+	if subtitle == nil || !gomu.player.IsRunning() {
+		return -1
+	}
+
+	return subtitle.CaptionAt(int(gomu.player.GetPosition().Milliseconds()))
+}
+
+// scrollOffset returns the first line drawn so that focus is in the middle of
+// height rows
+func scrollOffset(focus, count, height int) int {
+	if count <= height || focus < 0 {
+		return 0
+	}
+	return clamp(focus-height/2, 0, count-height)
+}
+
+// move moves the selection by delta lines, starting from the line being sung
+func (l *Lyrics) move(delta int) {
+
+	lines, _ := l.lines()
+	if len(lines) == 0 {
+		return
+	}
+
+	selected := l.selected
+	if selected < 0 {
+		selected = l.current()
+	}
+
+	l.selected = clamp(selected+delta, 0, len(lines)-1)
+}
+
+// seek plays the song from the selected line and follows the line being sung
+// again
+func (l *Lyrics) seek() error {
+	if l.selected < 0 {
+		return nil
+	}
+	line := l.selected
+	l.selected = -1
+	return l.seekLine(line)
+}
+
+// seekLine plays the song from the start of the line
+func (l *Lyrics) seekLine(line int) error {
+
+	subtitle := gomu.playingBar.subtitle
+	if subtitle == nil || len(subtitle.SyncedCaptions) == 0 {
+		return tracerr.New("lyric is not synced")
+	}
+
+	if line < 0 || line >= len(subtitle.SyncedCaptions) {
+		return tracerr.Errorf("line out of range: %d", line)
+	}
+
+	return seekTo(int(subtitle.SyncedCaptions[line].Timestamp / 1000))
+}
+
+// Draw draws the lines around the line being sung or the selected line
+func (l *Lyrics) Draw(screen tcell.Screen) {
+	l.Box.DrawForSubclass(screen, l)
+
+	x, y, width, height := l.GetInnerRect()
+	if width <= 0 || height <= 0 {
+		return
+	}
+
+	if subtitle := gomu.playingBar.subtitle; subtitle != l.lyric {
+		l.lyric = subtitle
+		l.selected = -1
+	}
+
+	lines, synced := l.lines()
+	if len(lines) == 0 {
+		tview.Print(screen, "No lyric", x, y+height/2, width,
+			tview.AlignCenter, gomu.colors.foreground)
+		return
+	}
+
+	current := -1
+	if synced {
+		current = l.current()
+	}
+
+	focus := current
+	if l.selected >= 0 {
+		focus = l.selected
+	}
+	l.offset = scrollOffset(focus, len(lines), height)
+
+	for row := 0; row < height && l.offset+row < len(lines); row++ {
+		index := l.offset + row
+
+		if index == l.selected {
+			style := tcell.StyleDefault.Background(gomu.colors.queueHi)
+			for col := 0; col < width; col++ {
+				screen.SetContent(x+col, y+row, ' ', nil, style)
+			}
+		}
+
+		color := gomu.colors.foreground
+		if index == current {
+			color = gomu.colors.accent
+		}
+
+		tview.Print(screen, tview.Escape(lines[index]), x, y+row, width,
+			tview.AlignCenter, color)
+	}
+}
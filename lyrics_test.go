@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tramhao/id3v2"
+
+	"github.com/issadarkthing/gomu/lyric"
+)
+
+func TestLyricLines(t *testing.T) {
+
+	subtitle := &lyric.Lyric{SyncedCaptions: []id3v2.SyncedText{
+		{Timestamp: 1000, Text: "first"},
+		{Timestamp: 3000, Text: "second"},
+	}}
+
+	lines, synced := lyricLines(subtitle, "unused")
+	assert.True(t, synced)
+	assert.Equal(t, []string{"first", "second"}, lines)
+
+	// unsynced text is used without synced captions
+	lines, synced = lyricLines(&lyric.Lyric{}, "one\r\ntwo\n")
+	assert.False(t, synced)
+	assert.Equal(t, []string{"one", "two"}, lines)
+
+	lines, _ = lyricLines(nil, " ")
+	assert.Nil(t, lines)
+}
+
+func TestScrollOffset(t *testing.T) {
+
+	// every line fits
+	assert.Equal(t, 0, scrollOffset(8, 10, 10))
+
+	// the focused line is kept in the middle
+	assert.Equal(t, 0, scrollOffset(2, 30, 10))
+	assert.Equal(t, 10, scrollOffset(15, 30, 10))
+	assert.Equal(t, 20, scrollOffset(29, 30, 10))
+	assert.Equal(t, 0, scrollOffset(-1, 30, 10))
+}
+
+func TestLyricsToggle(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+	l := gomu.lyrics
+
+	// hidden panels take no space
+	l.visible = false
+	l.place(nil, 0, 2)
+	size, ratio := l.itemSize()
+	assert.Equal(t, 0, size)
+	assert.Equal(t, 0, ratio)
+
+	assert.False(t, l.toggle())
+	size, ratio = l.itemSize()
+	assert.Equal(t, 0, size)
+	assert.Equal(t, 2, ratio)
+}
+
+func TestLyricsMove(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+	gomu.playingBar.unsynced = "one\ntwo\nthree"
+	l := gomu.lyrics
+
+	l.move(1)
+	assert.Equal(t, 0, l.selected)
+	l.move(5)
+	assert.Equal(t, 2, l.selected)
+	l.move(-1)
+	assert.Equal(t, 1, l.selected)
+
+	// unsynced lyrics cannot be played from a line
+	assert.Error(t, l.seek())
+	assert.Equal(t, -1, l.selected)
+}
+
+func TestLyricsKeys(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+	gomu.command.defineCommands()
+	err := loadModules(gomu.anko)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the keys of the panel are bound to the commands defined above
+	gomu.lyrics = newLyrics()
+	gomu.playingBar.unsynced = "one\ntwo\nthree"
+	gomu.keys = gomu.anko.NewSequence(time.Second, nil)
+
+	gomu.lyrics.Focus(nil)
+	assert.Contains(t, keybindTables(), "lyrics")
+
+	consumed, err := gomu.keys.Feed(
+		tcell.NewEventKey(tcell.KeyRune, 'j', tcell.ModNone), keybindTables()...)
+	assert.NoError(t, err)
+	assert.True(t, consumed)
+	assert.Equal(t, 0, gomu.lyrics.selected)
+
+	assert.Contains(t, gomu.lyrics.help(), "j      lyrics_down")
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	"github.com/issadarkthing/gomu/player"
+)
+
+// mouseHandler is the signature of tview mouse handlers
+type mouseHandler = func(action tview.MouseAction, event *tcell.EventMouse, setFocus func(p tview.Primitive)) (consumed bool, capture tview.Primitive)
+
+// panelMouse reports whether the panels handle mouse events, they are ignored
+// while a popup is shown so that clicks around the popup do not reach the
+// panels below it
+func panelMouse() bool {
+	return gomu.popups.peekTop() == nil
+}
+
+// focusPanel focuses the panel clicked on
+func focusPanel(panel Panel) {
+	gomu.setFocusPanel(panel)
+	gomu.prevPanel = panel
+}
+
+// nodeAt returns the node shown at the row y of the screen
+func (p *Playlist) nodeAt(y int) *tview.TreeNode {
+
+	_, rectY, _, height := p.GetInnerRect()
+	if y < rectY || y >= rectY+height {
+		return nil
+	}
+
+	row := y - rectY + p.GetScrollOffset()
+
+	// visible nodes in the order they are drawn
+	var node *tview.TreeNode
+	var index int
+	p.GetRoot().Walk(func(n, _ *tview.TreeNode) bool {
+		if node != nil {
+			return false
+		}
+		if index == row {
+			node = n
+		}
+		index++
+		return n.IsExpanded()
+	})
+
+	return node
+}
+
+// MouseHandler highlights the node clicked on, double clicks play the file or
+// open the directory
+func (p *Playlist) MouseHandler() mouseHandler {
+	return p.WrapMouseHandler(func(action tview.MouseAction, event *tcell.EventMouse, setFocus func(p tview.Primitive)) (consumed bool, capture tview.Primitive) {
+
+		if !panelMouse() || !p.InRect(event.Position()) {
+			return false, nil
+		}
+
+		_, y := event.Position()
+
+		switch action {
+		case tview.MouseLeftDown:
+			focusPanel(p)
+			return true, nil
+
+		case tview.MouseLeftClick:
+			if node := p.nodeAt(y); node != nil {
+				p.setHighlight(node)
+			}
+			return true, nil
+
+		case tview.MouseLeftDoubleClick:
+			node := p.nodeAt(y)
+			if node == nil {
+				return true, nil
+			}
+			p.setHighlight(node)
+
+			audioFile := node.GetReference().(*player.AudioFile)
+			if audioFile.IsAudioFile() {
+				playNow(audioFile)
+			} else {
+				node.SetExpanded(!node.IsExpanded())
+			}
+			return true, nil
+		}
+
+		// scrolling
+		return p.TreeView.MouseHandler()(action, event, setFocus)
+	})
+}
+
+// MouseHandler highlights the song clicked on, double clicks play it
+func (q *Queue) MouseHandler() mouseHandler {
+	return q.WrapMouseHandler(func(action tview.MouseAction, event *tcell.EventMouse, setFocus func(p tview.Primitive)) (consumed bool, capture tview.Primitive) {
+
+		if !panelMouse() || !q.InRect(event.Position()) {
+			return false, nil
+		}
+
+		_, y := event.Position()
+		_, rectY, _, _ := q.GetInnerRect()
+		offset, _ := q.GetOffset()
+		index := y - rectY + offset
+
+		switch action {
+		case tview.MouseLeftDown:
+			focusPanel(q)
+			return true, nil
+
+		case tview.MouseLeftClick:
+			if y >= rectY && index < q.GetItemCount() {
+				q.SetCurrentItem(index)
+			}
+			return true, nil
+
+		case tview.MouseLeftDoubleClick:
+			if y >= rectY && index < q.GetItemCount() {
+				q.SetCurrentItem(index)
+				fn, err := gomu.command.getFn("play_selected")
+				if err != nil {
+					logError(err)
+					return true, nil
+				}
+				fn()
+			}
+			return true, nil
+		}
+
+		// scrolling
+		return q.List.MouseHandler()(action, event, setFocus)
+	})
+}
+
+// MouseHandler ignores the mouse so that the visualizer never takes the focus
+func (v *Visualizer) MouseHandler() mouseHandler {
+	return func(tview.MouseAction, *tcell.EventMouse, func(tview.Primitive)) (bool, tview.Primitive) {
+		return false, nil
+	}
+}
+
+// MouseHandler plays the song from the line clicked on, scrolling moves the
+// selection
+func (l *Lyrics) MouseHandler() mouseHandler {
+	return l.WrapMouseHandler(func(action tview.MouseAction, event *tcell.EventMouse, setFocus func(p tview.Primitive)) (consumed bool, capture tview.Primitive) {
+
+		if !panelMouse() || !l.InRect(event.Position()) {
+			return false, nil
+		}
+
+		_, y := event.Position()
+		_, rectY, _, _ := l.GetInnerRect()
+
+		switch action {
+		case tview.MouseLeftDown:
+			focusPanel(l)
+			return true, nil
+
+		case tview.MouseLeftClick:
+			lines, synced := l.lines()
+			line := l.offset + y - rectY
+			if y < rectY || line >= len(lines) {
+				return true, nil
+			}
+			if !synced {
+				l.selected = line
+				return true, nil
+			}
+			l.selected = -1
+			err := l.seekLine(line)
+			if err != nil {
+				errorPopup(err)
+			}
+			return true, nil
+
+		case tview.MouseScrollUp:
+			l.move(-1)
+			return true, nil
+
+		case tview.MouseScrollDown:
+			l.move(1)
+			return true, nil
+		}
+
+		return false, nil
+	})
+}
+
+// playNow plays the audio file right away, the current song is skipped
+func playNow(audioFile *player.AudioFile) {
+
+	gomu.queue.pushFront(audioFile)
+
+	if gomu.player.IsRunning() {
+		gomu.player.Skip()
+		return
+	}
+
+	err := gomu.queue.playQueue()
+	if err != nil {
+		errorPopup(err)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/rivo/tview"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodeAt(t *testing.T) {
+
+	root := tview.NewTreeNode("music")
+	rap := tview.NewTreeNode("rap")
+	pop := tview.NewTreeNode("pop").SetExpanded(false)
+	song := tview.NewTreeNode("song.mp3")
+
+	rap.AddChild(tview.NewTreeNode("track.mp3"))
+	pop.AddChild(tview.NewTreeNode("hidden.mp3"))
+	root.AddChild(rap).AddChild(pop).AddChild(song)
+
+	p := &Playlist{TreeView: tview.NewTreeView().SetRoot(root)}
+	p.SetRect(0, 2, 30, 10)
+
+	assert.Nil(t, p.nodeAt(1))
+	assert.Equal(t, root, p.nodeAt(2))
+	assert.Equal(t, rap, p.nodeAt(3))
+	assert.Equal(t, "track.mp3", p.nodeAt(4).GetText())
+	assert.Equal(t, pop, p.nodeAt(5))
+	// children of collapsed nodes are not shown
+	assert.Equal(t, song, p.nodeAt(6))
+	assert.Nil(t, p.nodeAt(7))
+}
@@ -0,0 +1,61 @@
+package player
+
+import (
+	"math"
+	"os"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/mp3"
+	"github.com/ztrue/tracerr"
+)
+
+// Peaks decodes the audio file and returns the peak amplitude of n equal parts
+// of the song, between 0 and 1.
+func Peaks(audioPath string, n int) ([]float64, error) {
+	f, err := os.Open(audioPath)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+
+	streamer, _, err := mp3.Decode(f)
+	if err != nil {
+		f.Close()
+		return nil, tracerr.Wrap(err)
+	}
+	defer streamer.Close()
+
+	peaks := StreamPeaks(streamer, streamer.Len(), n)
+
+	return peaks, tracerr.Wrap(streamer.Err())
+}
+
+// StreamPeaks returns the peak amplitude of n equal parts of the streamer,
+// total is the number of samples of the streamer.
+func StreamPeaks(streamer beep.Streamer, total, n int) []float64 {
+	peaks := make([]float64, n)
+	if total <= 0 || n <= 0 {
+		return peaks
+	}
+
+	samples := make([][2]float64, 4096)
+	var position int
+
+	for {
+		read, ok := streamer.Stream(samples)
+
+		for _, sample := range samples[:read] {
+			i := position * n / total
+			if i >= n {
+				i = n - 1
+			}
+
+			amplitude := math.Max(math.Abs(sample[0]), math.Abs(sample[1]))
+			peaks[i] = math.Max(peaks[i], math.Min(amplitude, 1))
+			position++
+		}
+
+		if !ok {
+			return peaks
+		}
+	}
+}
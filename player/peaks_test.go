@@ -0,0 +1,32 @@
+package player
+
+import (
+	"testing"
+
+	"github.com/faiface/beep"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamPeaks(t *testing.T) {
+
+	// the amplitude grows every 100 samples and clips after 1
+	amplitudes := []float64{0.1, -0.5, 0.25, 1.5}
+	total := len(amplitudes) * 100
+
+	var position int
+	streamer := beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+		var n int
+		for n < len(samples) && position < total {
+			amplitude := amplitudes[position/100]
+			samples[n] = [2]float64{amplitude / 2, amplitude}
+			n++
+			position++
+		}
+		return n, n > 0
+	})
+
+	peaks := StreamPeaks(streamer, total, 2)
+	assert.Equal(t, []float64{0.5, 1}, peaks)
+
+	assert.Equal(t, []float64{0, 0}, StreamPeaks(streamer, 0, 2))
+}
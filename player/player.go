@@ -13,6 +13,12 @@ import (
 	"github.com/ztrue/tracerr"
 )
 
+// SampleRate is the sample rate of the speaker, songs are resampled to it.
+const SampleRate = beep.SampleRate(48000)
+
+// tapSize is the number of recent samples kept for the visualizer
+const tapSize = 4096
+
 type Audio interface {
 	Name() string
 	Path() string
@@ -24,6 +30,7 @@ type Player struct {
 	volume    float64
 
 	vol              *effects.Volume
+	tap              *Tap
 	ctrl             *beep.Ctrl
 	format           *beep.Format
 	length           time.Duration
@@ -107,7 +114,7 @@ func (p *Player) Run(currSong Audio) error {
 	// song duration
 	p.length = format.SampleRate.D(p.streamSeekCloser.Len())
 
-	sr := beep.SampleRate(48000)
+	sr := SampleRate
 	if !p.hasInit {
 
 		// p.mu.Lock()
@@ -144,8 +151,16 @@ func (p *Player) Run(currSong Audio) error {
 	p.mu.Unlock()
 	resampler := beep.ResampleRatio(4, 1, ctrl)
 
+	// the samples are recorded before the volume is applied so that the
+	// visualizer does not depend on the volume
+	tap := NewTap(resampler, tapSize)
+
+	p.mu.Lock()
+	p.tap = tap
+	p.mu.Unlock()
+
 	volume := &effects.Volume{
-		Streamer: resampler,
+		Streamer: tap,
 		Base:     2,
 		Volume:   0,
 		Silent:   false,
@@ -264,6 +279,21 @@ func (p *Player) IsPaused() bool {
 	return p.ctrl.Paused
 }
 
+// Samples copies the most recent samples played to dst, oldest first. It
+// returns false if no song has been played yet.
+func (p *Player) Samples(dst []float64) bool {
+	p.mu.Lock()
+	tap := p.tap
+	p.mu.Unlock()
+
+	if tap == nil {
+		return false
+	}
+
+	tap.Samples(dst)
+	return true
+}
+
 // GetVolume returns current volume.
 func (p *Player) GetVolume() float64 {
 	return p.volume
@@ -0,0 +1,57 @@
+package player
+
+import (
+	"sync"
+
+	"github.com/faiface/beep"
+)
+
+// Tap passes the samples of the streamer through and keeps the most recent
+// ones so that they can be analysed while the audio is playing.
+type Tap struct {
+	Streamer beep.Streamer
+	mu       sync.Mutex
+	// buf is a ring buffer of mono samples, pos is the index of the oldest
+	buf []float64
+	pos int
+}
+
+// NewTap returns a Tap keeping the last size samples of the streamer.
+func NewTap(streamer beep.Streamer, size int) *Tap {
+	return &Tap{Streamer: streamer, buf: make([]float64, size)}
+}
+
+// Stream streams the wrapped streamer and records the samples.
+func (t *Tap) Stream(samples [][2]float64) (int, bool) {
+	n, ok := t.Streamer.Stream(samples)
+
+	t.mu.Lock()
+	for _, sample := range samples[:n] {
+		t.buf[t.pos] = (sample[0] + sample[1]) / 2
+		t.pos = (t.pos + 1) % len(t.buf)
+	}
+	t.mu.Unlock()
+
+	return n, ok
+}
+
+// Err propagates the error of the wrapped streamer.
+func (t *Tap) Err() error {
+	return t.Streamer.Err()
+}
+
+// Samples copies the most recent samples to dst, oldest first. dst must not be
+// longer than the size of the Tap.
+func (t *Tap) Samples(dst []float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	start := t.pos - len(dst)
+	if start < 0 {
+		start += len(t.buf)
+	}
+
+	for i := range dst {
+		dst[i] = t.buf[(start+i)%len(t.buf)]
+	}
+}
@@ -0,0 +1,42 @@
+package player
+
+import (
+	"testing"
+
+	"github.com/faiface/beep"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTap(t *testing.T) {
+
+	var next float64
+	streamer := beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+		for i := range samples {
+			next++
+			samples[i] = [2]float64{next, next + 2}
+		}
+		return len(samples), true
+	})
+
+	tap := NewTap(streamer, 4)
+
+	samples := make([][2]float64, 3)
+	n, ok := tap.Stream(samples)
+	assert.Equal(t, 3, n)
+	assert.True(t, ok)
+	// samples are passed through unchanged
+	assert.Equal(t, [2]float64{1, 3}, samples[0])
+
+	dst := make([]float64, 4)
+	tap.Samples(dst)
+	assert.Equal(t, []float64{0, 2, 3, 4}, dst)
+
+	// the ring buffer wraps around
+	tap.Stream(samples)
+	tap.Samples(dst)
+	assert.Equal(t, []float64{4, 5, 6, 7}, dst)
+
+	dst = dst[:2]
+	tap.Samples(dst)
+	assert.Equal(t, []float64{6, 7}, dst)
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"image"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync/atomic"
@@ -15,15 +16,19 @@ import (
 	"unsafe"
 
 	"github.com/disintegration/imaging"
+	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 	"github.com/tramhao/id3v2"
 	"github.com/ztrue/tracerr"
-	ugo "gitlab.com/diamondburned/ueberzug-go"
 
 	"github.com/issadarkthing/gomu/lyric"
 	"github.com/issadarkthing/gomu/player"
 )
 
+// karaokeInterval is the refresh interval of the playing bar while the words
+// of a lyric are highlighted
+const karaokeInterval = 100 * time.Millisecond
+
 // PlayingBar shows song name, progress and lyric
 type PlayingBar struct {
 	*tview.Frame
@@ -36,9 +41,26 @@ type PlayingBar struct {
 	tag              *id3v2.Tag
 	subtitle         *lyric.Lyric
 	subtitles        []*lyric.Lyric
-	albumPhoto       *ugo.Image
+	unsynced         string // USLT text shown when there is no synced lyric
 	albumPhotoSource image.Image
-	colrowPixel      int32
+	// peaks of the song drawn as progress bar, peaksPath is the song they are
+	// loaded for
+	peaks     []float64
+	peaksPath string
+	// position of the progress bar in the text, used to seek with the mouse
+	barOffset int
+	barWidth  int
+	lineWidth int
+	// cover draws the album photo in the queue, nil when covers are disabled
+	cover coverRenderer
+	// songTitle is kept to draw it again when the colors change
+	songTitle string
+	// secondary is a second lyric shown under subtitle, e.g. its translation
+	secondary *lyric.Lyric
+	// dual shows a second lyric, secondaryLang is the language chosen for it
+	// which is kept for the next songs
+	dual          bool
+	secondaryLang string
 }
 
 func (p *PlayingBar) help() []string {
@@ -60,6 +82,8 @@ func newPlayingBar() *PlayingBar {
 		Frame:  frame,
 		text:   textView,
 		update: make(chan struct{}),
+		cover:  newCoverRenderer(gomu.anko.GetString("General.cover_renderer")),
+		dual:   gomu.anko.GetBool("General.dual_lyric"),
 	}
 
 	return p
@@ -98,54 +122,89 @@ func (p *PlayingBar) run() error {
 		if err != nil {
 			return tracerr.Wrap(err)
 		}
-		var width, colrowPixel int
-		gomu.app.QueueUpdate(func() {
-			_, _, width, _ = p.GetInnerRect()
-			cols, rows, windowWidth, windowHeight := getConsoleSize()
-			rowPixel := windowHeight / rows
-			colPixel := windowWidth / cols
-			colrowPixel = rowPixel + colPixel
-		})
-
-		progressBar := progresStr(progress, full, width/2, "█", "━")
-		if p.getColRowPixel() != colrowPixel {
-			p.updatePhoto()
-			p.setColRowPixel(colrowPixel)
-		}
-		// our progress bar
 		var lyricText string
 		if p.subtitle != nil {
-			lyricText, err = p.subtitle.GetText(progress)
+			lyricText, err = karaokeText(p.subtitle, gomu.player.GetPosition())
+			if err != nil {
+				return tracerr.Wrap(err)
+			}
+		}
+
+		// the second lyric takes the place of the blank line
+		separator := "\n\n"
+		if secondary := p.secondary; secondary != nil {
+			secondaryText, err := karaokeText(secondary, gomu.player.GetPosition())
 			if err != nil {
 				return tracerr.Wrap(err)
 			}
+			separator = "\n"
+			lyricText += "\n" + secondaryText
 		}
 
 		gomu.app.QueueUpdateDraw(func() {
-			p.text.SetText(fmt.Sprintf("%s ┃%s┫ %s\n\n[%s]%v[-]",
-				fmtDuration(start),
-				progressBar,
-				fmtDuration(end),
-				gomu.colors.subtitle,
+			_, _, width, _ := p.GetInnerRect()
+			prefix := fmtDuration(start) + " ┃"
+			suffix := "┫ " + fmtDuration(end)
+
+			p.barOffset = tview.TaggedStringWidth(prefix)
+			p.barWidth = width / 2
+			p.lineWidth = p.barOffset + p.barWidth + tview.TaggedStringWidth(suffix)
+
+			p.text.SetText(fmt.Sprintf("%s%s%s%s%s",
+				prefix,
+				p.progressBar(progress, full, p.barWidth),
+				suffix,
+				separator,
 				lyricText,
 			))
 		})
 
-		<-time.After(time.Second)
+		// words of the lyric are highlighted as they are sung
+		interval := time.Second
+		if p.subtitle != nil && p.subtitle.HasWords() ||
+			p.secondary != nil && p.secondary.HasWords() {
+			interval = karaokeInterval
+		}
+		<-time.After(interval)
 	}
 
 	return nil
 }
 
+// karaokeText returns the line of the lyric being sung at position, the words
+// already sung are highlighted for lyrics with word timestamps
+func karaokeText(subtitle *lyric.Lyric, position time.Duration) (string, error) {
+
+	sung, rest, ok := subtitle.Karaoke(int(position.Milliseconds()))
+	if ok {
+		r, g, b := gomu.colors.accent.RGB()
+		return fmt.Sprintf("[#%s]%s[%s]%s[-]",
+			padHex(r, g, b),
+			tview.Escape(sung),
+			gomu.colors.subtitle,
+			tview.Escape(rest),
+		), nil
+	}
+
+	text, err := subtitle.GetText(int(position.Seconds()))
+	if err != nil {
+		return "", tracerr.Wrap(err)
+	}
+
+	return fmt.Sprintf("[%s]%s[-]", gomu.colors.subtitle, tview.Escape(text)), nil
+}
+
 // Updates song title
 func (p *PlayingBar) setSongTitle(title string) {
 	p.Clear()
+	p.songTitle = title
 	titleColor := gomu.colors.title
 	p.AddText(title, true, tview.AlignCenter, titleColor)
 
 }
 
-// Resets progress bar, ready for execution
+// Resets progress bar, ready for execution. It must be called from the UI
+// goroutine
 func (p *PlayingBar) newProgress(currentSong *player.AudioFile, full int) {
 	p.setFull(full)
 	p.setProgress(0)
@@ -153,10 +212,13 @@ func (p *PlayingBar) newProgress(currentSong *player.AudioFile, full int) {
 	p.tag = nil
 	p.subtitles = nil
 	p.subtitle = nil
-	if p.albumPhoto != nil {
-		p.albumPhoto.Clear()
-		p.albumPhoto.Destroy()
-		p.albumPhoto = nil
+	p.secondary = nil
+	p.peaks = nil
+	p.peaksPath = currentSong.Path()
+
+	// the peaks are computed in the background
+	if gomu.anko.GetBool("General.waveform") {
+		go p.loadPeaks(peaksCacheDir(), currentSong.Path())
 	}
 
 	err := p.loadLyrics(currentSong.Path())
@@ -191,6 +253,8 @@ func (p *PlayingBar) newProgress(currentSong *player.AudioFile, full int) {
 		if p.subtitle == nil {
 			p.subtitle = p.subtitles[0]
 		}
+
+		p.pickSecondary()
 	}
 	p.setSongTitle(currentSong.Name())
 
@@ -204,9 +268,9 @@ func (p *PlayingBar) setDefault() {
 		"%s ┣%s┫ %s", "00:00", strings.Repeat("━", width/2), "00:00",
 	)
 	p.text.SetText(text)
-	if p.albumPhoto != nil {
-		p.albumPhoto.Clear()
-	}
+	p.albumPhotoSource = nil
+	p.peaks = nil
+	p.barWidth = 0
 }
 
 // Skips the current playing song
@@ -226,12 +290,14 @@ func (p *PlayingBar) switchLyrics() {
 	if len(p.subtitles) == 0 {
 		defaultTimedPopup(" Warning ", "No embed lyric found")
 		p.subtitle = nil
+		p.secondary = nil
 		return
 	}
 
 	// only 1 subtitle, prompt to the user and select this one
 	if len(p.subtitles) == 1 {
 		p.subtitle = p.subtitles[0]
+		p.pickSecondary()
 		defaultTimedPopup(" Warning ", p.subtitle.LangExt+" lyric is the only lyric available")
 		return
 	}
@@ -250,6 +316,7 @@ func (p *PlayingBar) switchLyrics() {
 	}
 
 	p.subtitle = p.subtitles[langIndex]
+	p.pickSecondary()
 
 	defaultTimedPopup(" Success ", p.subtitle.LangExt+" lyric switched successfully.")
 }
@@ -262,22 +329,65 @@ func (p *PlayingBar) delayLyric(lyricDelay int) (err error) {
 		if err != nil {
 			return tracerr.Wrap(err)
 		}
-		err = p.loadLyrics(gomu.player.GetCurrentSong().Path())
-		if err != nil {
-			return tracerr.Wrap(err)
+		return p.reloadSubtitle(p.subtitle.LangExt)
+	}
+	return nil
+}
+
+// reloadSubtitle reads the lyrics of the current song again after they are
+// embedded and shows the lyric of the language
+func (p *PlayingBar) reloadSubtitle(langExt string) error {
+
+	err := p.loadLyrics(gomu.player.GetCurrentSong().Path())
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+
+	// the languages of the translations contain the language of the lyric
+	for _, v := range p.subtitles {
+		if v.LangExt == langExt {
+			p.subtitle = v
+			break
+		}
+	}
+	p.pickSecondary()
+
+	return nil
+}
+
+// pickSecondary chooses the lyric shown under subtitle: the one in the
+// language chosen with setSecondary or the translation of subtitle
+func (p *PlayingBar) pickSecondary() {
+
+	p.secondary = nil
+	if !p.dual || p.subtitle == nil {
+		return
+	}
+
+	for _, lang := range []string{p.secondaryLang, lyric.TranslationLang(p.subtitle.LangExt)} {
+		if lang == "" {
+			continue
 		}
 		for _, v := range p.subtitles {
-			if strings.Contains(v.LangExt, p.subtitle.LangExt) {
-				p.subtitle = v
-				break
+			if v != p.subtitle && v.LangExt == lang {
+				p.secondary = v
+				return
 			}
 		}
 	}
-	return nil
+}
+
+// setSecondary shows the lyric in the language under subtitle, an empty
+// language hides the second lyric
+func (p *PlayingBar) setSecondary(langExt string) {
+	p.dual = langExt != ""
+	p.secondaryLang = langExt
+	p.pickSecondary()
 }
 
 func (p *PlayingBar) loadLyrics(currentSongPath string) error {
 	p.subtitles = nil
+	p.unsynced = ""
 
 	var tag *id3v2.Tag
 	var err error
@@ -292,12 +402,7 @@ func (p *PlayingBar) loadLyrics(currentSongPath string) error {
 	}
 	p.hasTag = true
 	p.tag = tag
-
-	if p.albumPhoto != nil {
-		p.albumPhoto.Clear()
-		p.albumPhoto.Destroy()
-		p.albumPhoto = nil
-	}
+	p.albumPhotoSource = nil
 
 	syltFrames := tag.GetFrames(tag.CommonID("Synchronised lyrics/text"))
 	usltFrames := tag.GetFrames(tag.CommonID("Unsynchronised lyrics/text transcription"))
@@ -325,6 +430,22 @@ func (p *PlayingBar) loadLyrics(currentSongPath string) error {
 		}
 	}
 
+	// the preferred language is used if there are several unsynced lyrics
+	langLyric := gomu.anko.GetString("General.lang_lyric")
+	for _, u := range usltFrames {
+		uslf, ok := u.(id3v2.UnsynchronisedLyricsFrame)
+		if !ok {
+			return errors.New("USLT error")
+		}
+		if p.unsynced == "" || uslf.ContentDescriptor != "" &&
+			strings.Contains(langLyric, uslf.ContentDescriptor) {
+			p.unsynced = uslf.Lyrics
+		}
+	}
+
+	// .lrc files next to the song add the languages not embedded
+	p.loadSidecars(currentSongPath)
+
 	pictures := tag.GetFrames(tag.CommonID("Attached picture"))
 	for _, f := range pictures {
 		pic, ok := f.(id3v2.PictureFrame)
@@ -339,7 +460,17 @@ func (p *PlayingBar) loadLyrics(currentSongPath string) error {
 		}
 
 		p.albumPhotoSource = imgTmp
-		p.setColRowPixel(0)
+	}
+
+	// use the cover image of the directory when there is no embedded cover
+	if len(pictures) == 0 {
+		img, _, err := readCoverFile(filepath.Dir(currentSongPath))
+		if err != nil {
+			return tracerr.Wrap(err)
+		}
+		if img != nil {
+			p.albumPhotoSource = img
+		}
 	}
 
 	return nil
@@ -361,14 +492,6 @@ func (p *PlayingBar) setFull(full int) {
 	atomic.StoreInt32(&p.full, int32(full))
 }
 
-func (p *PlayingBar) getColRowPixel() int {
-	return int(atomic.LoadInt32(&p.colrowPixel))
-}
-
-func (p *PlayingBar) setColRowPixel(colrowPixel int) {
-	atomic.StoreInt32(&p.colrowPixel, int32(colrowPixel))
-}
-
 func getConsoleSize() (int, int, int, int) {
 	var sz struct {
 		rows    uint16
@@ -381,39 +504,121 @@ func getConsoleSize() (int, int, int, int) {
 	return int(sz.cols), int(sz.rows), int(sz.xpixels), int(sz.ypixels)
 }
 
-// updatePhoto finish two tasks: 1. resize photo based on room left for photo
-// 2. register photo in the correct position
-func (p *PlayingBar) updatePhoto() {
-	// Put the whole block in goroutine, in order not to block the whole apps
-	// also to avoid data race by adding QueueUpdateDraw
-	go gomu.app.QueueUpdateDraw(func() {
-		if p.albumPhotoSource == nil {
-			return
+// progressBar returns the waveform of the song with the played part
+// highlighted, or a plain bar until the peaks of the song are loaded
+func (p *PlayingBar) progressBar(progress, full, width int) string {
+
+	if len(p.peaks) == 0 {
+		return progresStr(progress, full, width, "█", "━")
+	}
+
+	played, rest := waveformStr(p.peaks, progress, full, width)
+	r, g, b := gomu.colors.accent.RGB()
+
+	return fmt.Sprintf("[#%s]%s[-]%s", padHex(r, g, b), played, rest)
+}
+
+// loadPeaks loads the peaks of the song in the background, they are computed
+// on the first time the song is played. They are only set on the UI goroutine,
+// and dropped if another song has started in the meantime.
+func (p *PlayingBar) loadPeaks(cacheDir, songPath string) {
+
+	peaks, err := loadPeaks(cacheDir, songPath)
+	if err != nil {
+		logError(err)
+		return
+	}
+
+	gomu.app.QueueUpdateDraw(func() {
+		// the song may have been skipped in the meantime
+		if p.peaksPath == songPath {
+			p.peaks = peaks
 		}
+	})
+}
+
+// seekPosition returns the position in the song of the column of the progress
+// bar at x, y
+func (p *PlayingBar) seekPosition(x, y int) (int, bool) {
+
+	textX, textY, width, _ := p.text.GetInnerRect()
+	if y != textY || p.barWidth == 0 {
+		return 0, false
+	}
+
+	// the text is centered
+	barX := textX + (width-p.lineWidth)/2 + p.barOffset
+	if x < barX || x >= barX+p.barWidth {
+		return 0, false
+	}
 
-		if p.albumPhoto != nil {
-			p.albumPhoto.Clear()
-			p.albumPhoto.Destroy()
-			p.albumPhoto = nil
+	return (x - barX) * p.getFull() / p.barWidth, true
+}
+
+// MouseHandler seeks to the position clicked on the progress bar, scrolling
+// changes the volume
+func (p *PlayingBar) MouseHandler() mouseHandler {
+	return p.WrapMouseHandler(func(action tview.MouseAction, event *tcell.EventMouse, setFocus func(p tview.Primitive)) (consumed bool, capture tview.Primitive) {
+
+		if !panelMouse() || !p.InRect(event.Position()) {
+			return false, nil
 		}
-		x, y, width, height := gomu.queue.GetInnerRect()
 
-		cols, rows, windowWidth, windowHeight := getConsoleSize()
+		var command string
+
+		switch action {
+		case tview.MouseLeftDown:
+			focusPanel(p)
+			return true, nil
 
-		colPixel := windowWidth / cols
-		rowPixel := windowHeight / rows
-		imageWidth := width * colPixel / 3
+		case tview.MouseLeftClick:
+			if position, ok := p.seekPosition(event.Position()); ok {
+				err := seekTo(position)
+				if err != nil {
+					errorPopup(err)
+				}
+			}
+			return true, nil
+
+		case tview.MouseScrollUp:
+			command = "volume_up"
+
+		case tview.MouseScrollDown:
+			command = "volume_down"
+
+		default:
+			return false, nil
+		}
 
-		// resize the photo according to space left for x and y axis
-		dstImage := imaging.Resize(p.albumPhotoSource, imageWidth, 0, imaging.Lanczos)
-		var err error
-		positionX := x*colPixel + width*colPixel - dstImage.Rect.Dx()
-		positionY := y*rowPixel + height*rowPixel - dstImage.Rect.Dy()
-		// register new image
-		p.albumPhoto, err = ugo.NewImage(dstImage, positionX, positionY)
+		fn, err := gomu.command.getFn(command)
 		if err != nil {
-			errorPopup(err)
+			logError(err)
+			return true, nil
 		}
-		p.albumPhoto.Show()
+		fn()
+
+		return true, nil
 	})
 }
+
+// drawCover draws the album photo at the bottom right of the queue, it is
+// hidden while a popup is shown
+func (p *PlayingBar) drawCover(screen tcell.Screen) {
+
+	if p.cover == nil {
+		return
+	}
+
+	if name, _ := gomu.pages.GetFrontPage(); name != "main" || p.albumPhotoSource == nil {
+		p.cover.clear()
+		return
+	}
+
+	x, y, width, height := gomu.queue.GetInnerRect()
+	cols, rows := fitCells(p.albumPhotoSource, width/3, height)
+	if cols == 0 || rows == 0 {
+		return
+	}
+
+	p.cover.draw(screen, p.albumPhotoSource, x+width-cols, y+height-rows, cols, rows)
+}
@@ -2,7 +2,11 @@ package main
 
 import (
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
+
+	"github.com/issadarkthing/gomu/lyric"
 	"github.com/issadarkthing/gomu/player"
 )
 
@@ -57,3 +61,55 @@ func Test_Stop(t *testing.T) {
 		t.Errorf("Expected %t; got %t", true, p.skip)
 	}
 }
+
+func TestKaraokeText(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+	r, g, b := gomu.colors.accent.RGB()
+	accent := "[#" + padHex(r, g, b) + "]"
+
+	var subtitle lyric.Lyric
+	err := subtitle.NewFromLRC("[00:10.00]<00:10.00>One <00:11.00>[two]\n[00:20.00]Plain\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text, err := karaokeText(&subtitle, 10500*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, accent+"One [darkgoldenrod][two[][-]", text)
+
+	// lines without word timestamps are not highlighted
+	text, err = karaokeText(&subtitle, 20*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "[darkgoldenrod]Plain[-]", text)
+}
+
+func TestPickSecondary(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+
+	en := &lyric.Lyric{LangExt: "en"}
+	ko := &lyric.Lyric{LangExt: "ko"}
+	translation := &lyric.Lyric{LangExt: lyric.TranslationLang("en")}
+
+	p := gomu.playingBar
+	p.subtitles = []*lyric.Lyric{en, ko, translation}
+	p.subtitle = en
+
+	// the translation is shown by default
+	p.dual = true
+	p.pickSecondary()
+	assert.Equal(t, translation, p.secondary)
+
+	p.setSecondary("ko")
+	assert.Equal(t, ko, p.secondary)
+
+	// the second lyric is never the lyric shown
+	p.subtitle = ko
+	p.pickSecondary()
+	assert.Nil(t, p.secondary)
+
+	p.setSecondary("")
+	assert.False(t, p.dual)
+	assert.Nil(t, p.secondary)
+}
@@ -6,26 +6,22 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
 	"sort"
-	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 	spin "github.com/tj/go-spin"
-	"github.com/tramhao/id3v2"
 	"github.com/ztrue/tracerr"
 
-	"github.com/issadarkthing/gomu/lyric"
 	"github.com/issadarkthing/gomu/player"
 )
 
@@ -35,33 +31,15 @@ type Playlist struct {
 	*tview.TreeView
 	prevNode     *tview.TreeNode
 	defaultTitle string
-	// number of downloads
-	download int
-	done     chan struct{}
+	// spinner animates the title while jobs are running
+	spinner  *spin.Spinner
 	yankFile *player.AudioFile
+	// paths of the files selected for batch operations
+	selected map[string]bool
 }
 
 func (p *Playlist) help() []string {
-
-	return []string{
-		"j      down",
-		"k      up",
-		"h      close node",
-		"a      create a playlist",
-		"l      add song to queue",
-		"L      add playlist to queue",
-		"d      delete file from filesystem",
-		"D      delete playlist from filesystem",
-		"Y      download audio from url",
-		"r      refresh",
-		"R      rename",
-		"y/p    yank/paste file",
-		"/      find in playlist",
-		"s      search audio from youtube",
-		"t      edit mp3 tags",
-		"1/2    find lyric if available",
-	}
-
+	return keybindHelp("playlist")
 }
 
 // newPlaylist returns new instance of playlist and runs populate function
@@ -104,7 +82,8 @@ func newPlaylist(args Args) *Playlist {
 	playlist := &Playlist{
 		TreeView:     tree,
 		defaultTitle: "─ Playlist ──┤ 0 downloads ├",
-		done:         make(chan struct{}),
+		spinner:      spin.New(),
+		selected:     make(map[string]bool),
 	}
 
 	rootAudioFile := new(player.AudioFile)
@@ -158,6 +137,15 @@ func newPlaylist(args Args) *Playlist {
 		't': "edit_tags",
 		'1': "fetch_lyric",
 		'2': "fetch_lyric_cn2",
+		'3': "fetch_lyric_auto",
+		'4': "fetch_lyric_bulk",
+		'v': "toggle_select",
+		'V': "clear_selection",
+		'e': "batch_edit_tags",
+		'E': "rename_by_tags",
+		'x': "export_lyrics",
+		'i': "import_lyrics",
+		'H': "download_history",
 	}
 
 	for key, cmdName := range cmds {
@@ -165,18 +153,9 @@ func newPlaylist(args Args) *Playlist {
 		anko.Execute(src)
 	}
 
+	// keybindings are resolved in the application input capture
 	playlist.SetInputCapture(func(e *tcell.EventKey) *tcell.EventKey {
 
-		if gomu.anko.KeybindExists("playlist", e) {
-
-			err := gomu.anko.ExecKeybind("playlist", e)
-			if err != nil {
-				errorPopup(err)
-			}
-
-			return nil
-		}
-
 		// disable default key handler for space
 		if e.Rune() == ' ' {
 			return nil
@@ -210,11 +189,12 @@ func (p *Playlist) deleteSong(audioFile *player.AudioFile) {
 			// hehe we need to move focus to next node before delete it
 			p.InputHandler()(tcell.NewEventKey(tcell.KeyDown, 0, tcell.ModNone), nil)
 
-			err := os.Remove(audioFile.Path())
+			trashPath, err := moveToTrash(audioFile.Path())
 			if err != nil {
 				errorPopup(err)
 				return
 			}
+			p.recordDelete(audioFile, trashPath)
 
 			defaultTimedPopup(" Success ",
 				audioFile.Name()+"\nhas been deleted successfully")
@@ -236,10 +216,11 @@ func (p *Playlist) deletePlaylist(audioFile *player.AudioFile) (err error) {
 	p.InputHandler()(tcell.NewEventKey(tcell.KeyRune, 'h', tcell.ModNone), nil)
 	p.InputHandler()(tcell.NewEventKey(tcell.KeyDown, 0, tcell.ModNone), nil)
 
-	err = os.RemoveAll(audioFile.Path())
+	trashPath, err := moveToTrash(audioFile.Path())
 	if err != nil {
 		return tracerr.Wrap(err)
 	}
+	p.recordDelete(audioFile, trashPath)
 
 	defaultTimedPopup(
 		" Success ",
@@ -255,6 +236,34 @@ func (p *Playlist) deletePlaylist(audioFile *player.AudioFile) (err error) {
 	return nil
 }
 
+// recordDelete records the deletion so that the file can be restored from the
+// trash
+func (p *Playlist) recordDelete(audioFile *player.AudioFile, trashPath string) {
+
+	path := audioFile.Path()
+
+	gomu.journal.record("delete "+audioFile.Name(),
+		func() error {
+			err := movePath(trashPath, path)
+			if err != nil {
+				return tracerr.Wrap(err)
+			}
+			p.refresh()
+			gomu.queue.updateQueuePath()
+			return nil
+		},
+		func() error {
+			err := movePath(path, trashPath)
+			if err != nil {
+				return tracerr.Wrap(err)
+			}
+			p.refresh()
+			gomu.queue.updateQueuePath()
+			gomu.queue.updateCurrentSongDelete(audioFile)
+			return nil
+		})
+}
+
 // Bulk add a playlist to queue
 func (p *Playlist) addAllToQueue(root *tview.TreeNode) {
 
@@ -292,6 +301,19 @@ func (p *Playlist) refresh() {
 
 	populate(root, node.Path(), gomu.anko.GetBool("General.sort_by_mtime"))
 
+	selected := p.selected
+	p.selected = make(map[string]bool)
+
+	root.Walk(func(node, _ *tview.TreeNode) bool {
+
+		// keep the selection of files that still exist
+		if selected[node.GetReference().(*player.AudioFile).Path()] {
+			p.toggleSelect(node)
+		}
+
+		return true
+	})
+
 	root.Walk(func(node, _ *tview.TreeNode) bool {
 
 		// to preserve previously highlighted node
@@ -305,6 +327,64 @@ func (p *Playlist) refresh() {
 
 }
 
+// Selects or unselects the audio file for batch operations
+func (p *Playlist) toggleSelect(node *tview.TreeNode) {
+
+	audioFile := node.GetReference().(*player.AudioFile)
+	if !audioFile.IsAudioFile() {
+		return
+	}
+
+	if p.selected[audioFile.Path()] {
+		delete(p.selected, audioFile.Path())
+		node.SetText(setDisplayText(audioFile))
+		return
+	}
+
+	p.selected[audioFile.Path()] = true
+	node.SetText("* " + setDisplayText(audioFile))
+}
+
+// Unselects all selected audio files
+func (p *Playlist) clearSelection() {
+
+	p.GetRoot().Walk(func(node, _ *tview.TreeNode) bool {
+		audioFile := node.GetReference().(*player.AudioFile)
+		if p.selected[audioFile.Path()] {
+			node.SetText(setDisplayText(audioFile))
+		}
+		return true
+	})
+
+	p.selected = make(map[string]bool)
+}
+
+// Returns the selected audio files in tree order. If nothing is selected, the
+// highlighted file or all audio files under the highlighted directory are
+// returned.
+func (p *Playlist) getSelectedFiles() []*player.AudioFile {
+
+	root := p.GetRoot()
+	if len(p.selected) == 0 {
+		root = p.GetCurrentNode()
+	}
+
+	var audioFiles []*player.AudioFile
+
+	root.Walk(func(node, _ *tview.TreeNode) bool {
+		audioFile := node.GetReference().(*player.AudioFile)
+		if !audioFile.IsAudioFile() {
+			return true
+		}
+		if len(p.selected) == 0 || p.selected[audioFile.Path()] {
+			audioFiles = append(audioFiles, audioFile)
+		}
+		return true
+	})
+
+	return audioFiles
+}
+
 // Adds child while setting reference to audio file
 func (p *Playlist) addSongToPlaylist(
 	audioPath string, selPlaylist *tview.TreeNode,
@@ -434,6 +514,33 @@ func (p *Playlist) findAudioFile(audioName string) (*player.AudioFile, error) {
 	return selNode, nil
 }
 
+// Traverses the playlist and finds the node of the file or directory at path.
+// Relative paths are resolved from the music directory.
+func (p *Playlist) findNode(path string) *tview.TreeNode {
+
+	root := p.GetRoot()
+
+	if !filepath.IsAbs(path) {
+		rootPath := root.GetReference().(*player.AudioFile).Path()
+		path = filepath.Join(rootPath, path)
+	}
+	path = filepath.Clean(path)
+
+	var selNode *tview.TreeNode
+
+	root.Walk(func(node, _ *tview.TreeNode) bool {
+
+		if filepath.Clean(node.GetReference().(*player.AudioFile).Path()) == path {
+			selNode = node
+			return false
+		}
+
+		return true
+	})
+
+	return selNode
+}
+
 func (p *Playlist) rename(newName string) error {
 
 	currentNode := p.GetCurrentNode()
@@ -446,181 +553,158 @@ func (p *Playlist) rename(newName string) error {
 	} else {
 		newPath = pathToFile + newName
 	}
-	err := os.Rename(audio.Path(), newPath)
+	oldPath := audio.Path()
+	err := movePath(oldPath, newPath)
 	if err != nil {
 		return tracerr.Wrap(err)
 	}
 
+	gomu.journal.record("rename "+audio.Name(),
+		func() error { return p.move(newPath, oldPath) },
+		func() error { return p.move(oldPath, newPath) })
+
 	return nil
 }
 
-// updateTitle creates a spinning motion on the title
-// of the playlist panel when downloading.
-func (p *Playlist) updateTitle() {
+// move moves the file or directory at oldPath to newPath while keeping the
+// queue and the playing song updated.
+func (p *Playlist) move(oldPath, newPath string) error {
 
-	if p.download == 0 {
-		p.SetTitle(p.defaultTitle)
-		return
+	var oldAudio *player.AudioFile
+	if node := p.findNode(oldPath); node != nil {
+		oldAudio = node.GetReference().(*player.AudioFile)
 	}
 
-	// only one call can be made in one time
-	if p.download > 1 {
-		return
+	err := movePath(oldPath, newPath)
+	if err != nil {
+		return tracerr.Wrap(err)
 	}
 
-	s := spin.New()
-
-Download:
-	for {
+	p.refresh()
 
-		select {
-		case <-p.done:
-			p.download--
-			if p.download == 0 {
-				p.SetTitle(p.defaultTitle)
-				break Download
-			}
-		case <-time.After(time.Millisecond * 100):
+	newNode := p.findNode(newPath)
+	if oldAudio == nil || newNode == nil {
+		gomu.queue.updateQueuePath()
+		return nil
+	}
 
-			r, g, b := gomu.colors.accent.RGB()
-			hexColor := padHex(r, g, b)
+	newAudio := newNode.GetReference().(*player.AudioFile)
+	p.setHighlight(newNode)
 
-			title := fmt.Sprintf("─ Playlist ──┤ %d downloads [green]%s[#%s] ├",
-				p.download, s.Next(), hexColor)
-			p.SetTitle(title)
-			gomu.app.Draw()
+	if oldAudio.IsAudioFile() {
+		err = gomu.queue.renameItem(oldAudio, newAudio)
+		if err != nil {
+			return tracerr.Wrap(err)
 		}
+		return gomu.queue.updateCurrentSongName(oldAudio, newAudio)
 	}
 
+	gomu.queue.updateQueuePath()
+	return gomu.queue.updateCurrentSongPath(oldAudio, newAudio)
 }
 
-// Download audio from youtube audio and adds the song to the selected playlist
-func ytdl(url string, selPlaylist *tview.TreeNode) error {
+// updateTitle shows the progress of the background jobs in the title with a
+// spinning motion
+func (p *Playlist) updateTitle() {
 
-	// lookup if youtube-dl exists
-	_, err := exec.LookPath("youtube-dl")
+	progress := jobsProgress(gomu.jobs.list())
+	if progress == "" {
+		p.SetTitle(p.defaultTitle)
+		return
+	}
 
-	if err != nil {
-		defaultTimedPopup(" Error ", "youtube-dl is not in your $PATH")
+	r, g, b := gomu.colors.accent.RGB()
+	hexColor := padHex(r, g, b)
 
-		return tracerr.Wrap(err)
-	}
+	title := fmt.Sprintf("─ Playlist ──┤ %s [green]%s[#%s] ├",
+		progress, p.spinner.Next(), hexColor)
+	p.SetTitle(title)
+}
+
+// Download audio from youtube audio and adds the song to the selected playlist,
+// the progress of the downloader is passed to status and it is killed when
+// ctx is done. It is run by a job so the playlist and the popups are updated
+// on the UI goroutine. The path of the audio is returned once it is downloaded.
+func ytdl(
+	ctx context.Context, config *downloadConfig, url string,
+	selPlaylist *tview.TreeNode, status func(string),
+) (string, error) {
 
 	selAudioFile := selPlaylist.GetReference().(*player.AudioFile)
 	dir := selAudioFile.Path()
 
-	defaultTimedPopup(" Ytdl ", "Downloading")
-
-	// specify the output path for ytdl
-	outputDir := fmt.Sprintf(
-		"%s/%%(title)s.%%(ext)s",
-		dir)
-
-	metaData := fmt.Sprintf("%%(artist)s - %%(title)s")
+	audioPath, err := config.downloader.download(ctx, url, dir, func(p downloadProgress) {
+		status(p.String())
+	})
+	if err != nil {
+		return "", tracerr.Wrap(err)
+	}
 
-	args := []string{
-		"--extract-audio",
-		"--audio-format",
-		"mp3",
-		"--output",
-		outputDir,
-		"--add-metadata",
-		"--embed-thumbnail",
-		"--metadata-from-title",
-		metaData,
-		"--write-sub",
-		"--all-subs",
-		"--convert-subs",
-		"lrc",
-		url,
+	// Embed the lyrics of the song, the .lrc files are kept as sidecar
+	// lyrics if keep_lrc is set
+	lyricWritten, err := importLyrics(audioPath, config.lang)
+	if err != nil {
+		return audioPath, tracerr.Wrap(err)
 	}
 
-	cmd := exec.Command("youtube-dl", args...)
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	if !config.keepLrc {
+		err = removeSidecars(audioPath, config.lang)
+		if err != nil {
+			return audioPath, tracerr.Wrap(err)
+		}
+	}
 
-	gomu.playlist.download++
-	go gomu.playlist.updateTitle()
+	gomu.app.QueueUpdateDraw(func() {
+		err := gomu.playlist.addSongToPlaylist(audioPath, selPlaylist)
+		if err != nil {
+			errorPopup(err)
+			return
+		}
+		downloadFinishedMessage := fmt.Sprintf("Finished downloading\n%s\n%v lyrics embeded", getName(audioPath), lyricWritten)
+		defaultTimedPopup(" Ytdl ", downloadFinishedMessage)
+	})
 
-	// blocking
-	err = cmd.Run()
+	return audioPath, nil
+}
 
-	gomu.playlist.done <- struct{}{}
+// downloadAudio downloads the audio to the playlist in the background as a
+// job and records it in the history, the job is named after the url when
+// title is empty
+func downloadAudio(url, title string, selPlaylist *tview.TreeNode) {
 
+	config, err := newDownloadConfig()
 	if err != nil {
-		return tracerr.Wrap(err)
+		errorPopup(err)
+		return
 	}
 
-	playlistPath := dir
-	audioPath := extractFilePath(stdout.Bytes(), playlistPath)
-
-	historyPath := gomu.anko.GetString("General.history_path")
-
-	err = appendFile(expandTilde(historyPath), url+"\n")
-	if err != nil {
-		return tracerr.Wrap(err)
-	}
+	config.downloadAudio(url, title, selPlaylist)
+}
 
-	err = gomu.playlist.addSongToPlaylist(audioPath, selPlaylist)
-	if err != nil {
-		return tracerr.Wrap(err)
-	}
+// downloadAudio submits the job downloading the audio with the config
+func (c *downloadConfig) downloadAudio(url, title string, selPlaylist *tview.TreeNode) *Job {
 
-	// Embed lyric to mp3 as uslt
-	var tag *id3v2.Tag
-	tag, err = id3v2.Open(audioPath, id3v2.Options{Parse: true})
-	if err != nil {
-		return tracerr.Wrap(err)
+	name := title
+	if name == "" {
+		name = url
 	}
-	defer tag.Close()
 
-	pathToFile, _ := filepath.Split(audioPath)
-	files, err := ioutil.ReadDir(pathToFile)
-	if err != nil {
-		logError(err)
-	}
-	var lyricWritten int = 0
-	for _, file := range files {
-		fileName := file.Name()
-		fileExt := filepath.Ext(fileName)
-		lyricFileName := filepath.Join(pathToFile, fileName)
-		if fileExt == ".lrc" {
-			// Embed all lyrics and use langExt as content descriptor of uslt
-			fileNameWithoutExt := strings.TrimSuffix(fileName, fileExt)
-			langExt := strings.TrimPrefix(filepath.Ext(fileNameWithoutExt), ".")
-
-			// Read entire file content, giving us little control but
-			// making it very simple. No need to close the file.
-			byteContent, err := ioutil.ReadFile(lyricFileName)
-			if err != nil {
-				return tracerr.Wrap(err)
-			}
-			lyricContent := string(byteContent)
+	return gomu.jobs.submit("download", "Download "+name, func(ctx context.Context, j *Job) error {
+		j.setStatus("downloading")
+		audioPath, err := ytdl(ctx, c, url, selPlaylist, func(status string) {
+			j.setStatus("%s", status)
+		})
 
-			var lyric lyric.Lyric
-			err = lyric.NewFromLRC(lyricContent)
-			if err != nil {
-				return tracerr.Wrap(err)
-			}
-			lyric.LangExt = langExt
-			err = embedLyric(audioPath, &lyric, false)
-			if err != nil {
-				return tracerr.Wrap(err)
-			}
-			err = os.Remove(lyricFileName)
-			if err != nil {
-				return tracerr.Wrap(err)
-			}
-			lyricWritten++
+		entry := newHistoryEntry(url, title, audioPath, err)
+		if ctx.Err() != nil {
+			entry.Status = historyCanceled
+		}
+		if herr := appendHistory(c.history, entry); herr != nil {
+			logError(herr)
 		}
-	}
-
-	downloadFinishedMessage := fmt.Sprintf("Finished downloading\n%s\n%v lyrics embeded", getName(audioPath), lyricWritten)
-	defaultTimedPopup(" Ytdl ", downloadFinishedMessage)
-	gomu.app.Draw()
 
-	return nil
+		return err
+	})
 }
 
 // Add songs and their directories in Playlist panel.
@@ -646,6 +730,11 @@ func populate(root *tview.TreeNode, rootPath string, sortMtime bool) error {
 
 	for _, file := range files {
 
+		// the data gomu keeps about the library is not a playlist
+		if file.IsDir() && file.Name() == libraryDataDir {
+			continue
+		}
+
 		path, err := filepath.EvalSymlinks(filepath.Join(rootPath, file.Name()))
 		if err != nil {
 			continue
@@ -751,12 +840,17 @@ func (p *Playlist) paste() error {
 		return nil
 	}
 
+	oldPathFull := p.yankFile.Path()
 	newPathFull := filepath.Join(newPathDir, oldPathFileName)
-	err := os.Rename(p.yankFile.Path(), newPathFull)
+	err := movePath(oldPathFull, newPathFull)
 	if err != nil {
 		return tracerr.Wrap(err)
 	}
 
+	gomu.journal.record("paste "+p.yankFile.Name(),
+		func() error { return p.move(newPathFull, oldPathFull) },
+		func() error { return p.move(oldPathFull, newPathFull) })
+
 	defaultTimedPopup(" Success ", p.yankFile.Name()+"\n has been pasted to\n"+newPathDir)
 
 	// keep queue references updated
@@ -784,25 +878,59 @@ func (p *Playlist) paste() error {
 
 func setDisplayText(audioFile *player.AudioFile) string {
 	useEmoji := gomu.anko.GetBool("General.use_emoji")
-	if !useEmoji {
-		return audioFile.Name()
-	}
 
 	if audioFile.IsAudioFile() {
+		name := displayName(audioFile)
+		if !useEmoji {
+			return name
+		}
 		emojiFile := gomu.anko.GetString("Emoji.file")
-		return fmt.Sprintf(" %s %s", emojiFile, audioFile.Name())
+		return fmt.Sprintf(" %s %s", emojiFile, name)
+	}
+
+	if !useEmoji {
+		return audioFile.Name()
 	}
 
 	emojiDir := gomu.anko.GetString("Emoji.playlist")
 	return fmt.Sprintf(" %s %s", emojiDir, audioFile.Name())
 }
 
+// displayNames caches the names formatted with General.display_format
+var displayNames = newNameCache()
+
+// Formats the name of the audio file with General.display_format. The file name
+// is used when the file has no tags.
+func displayName(audioFile *player.AudioFile) string {
+
+	format := gomu.anko.GetString("General.display_format")
+	if format == "" || format == "{name}" {
+		return audioFile.Name()
+	}
+
+	return displayNames.get(audioFile.Path(), format, func() string {
+
+		fields, err := readTagFields(audioFile.Path(), formatKeys(format)...)
+		if err != nil {
+			return audioFile.Name()
+		}
+		fields["name"] = audioFile.Name()
+
+		text, hasValue := formatTags(format, fields)
+		if !hasValue {
+			return audioFile.Name()
+		}
+
+		return text
+	})
+}
+
 // refreshByNode is called after rename of file or folder, to refresh queue info
 func (p *Playlist) refreshAfterRename(node *player.AudioFile, newName string) error {
 
 	root := p.GetRoot()
 	root.Walk(func(node, _ *tview.TreeNode) bool {
-		if strings.Contains(node.GetText(), newName) {
+		if node.GetReference().(*player.AudioFile).Name() == newName {
 			p.setHighlight(node)
 		}
 		return true
@@ -3,6 +3,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 	"strings"
@@ -67,9 +68,6 @@ func (s *Stack) pop() tview.Primitive {
 	} else {
 		// focus the panel if no popup left
 		gomu.app.SetFocus(gomu.prevPanel.(tview.Primitive))
-		if gomu.playingBar.albumPhoto != nil {
-			gomu.playingBar.albumPhoto.Show()
-		}
 	}
 
 	return last
@@ -89,6 +87,20 @@ func getPopupTimeout() time.Duration {
 	return m
 }
 
+// Gets the time to wait for the next key of a multi-key binding from config file
+func getKeybindTimeout() time.Duration {
+
+	dur := gomu.anko.GetString("General.keybind_timeout")
+	m, err := time.ParseDuration(dur)
+
+	if err != nil {
+		logError(err)
+		return time.Second
+	}
+
+	return m
+}
+
 // Simple confirmation popup. Accepts callback
 func confirmationPopup(
 	text string,
@@ -263,22 +275,17 @@ func helpPopup(panel Panel) {
 
 	helpText := panel.help()
 
-	genHelp := []string{
+	// user-defined mode is shown on top of the list
+	if mode := gomu.anko.GetString("Keybinds.mode"); mode != "" {
+		modeHelp := append([]string{"mode: " + mode}, keybindHelp(mode)...)
+		helpText = append(append(modeHelp, " "), helpText...)
+	}
+
+	genHelp := append([]string{
 		" ",
 		"tab    change panel",
-		"space  toggle play/pause",
 		"esc    close popup",
-		"n      skip",
-		"q      quit",
-		"+      volume up",
-		"-      volume down",
-		"f/F    forward 10/60 seconds",
-		"b/B    rewind 10/60 seconds",
-		"?      toggle help",
-		"m      open repl",
-		"T      switch lyrics",
-		"c      show colors",
-	}
+	}, keybindHelp("global")...)
 
 	list := tview.NewList().ShowSecondaryText(false)
 	list.SetBackgroundColor(gomu.colors.popup).SetTitle(" Help ").
@@ -326,18 +333,37 @@ func helpPopup(panel Panel) {
 		return nil
 	})
 
-	if gomu.playingBar.albumPhoto != nil {
-		gomu.playingBar.albumPhoto.Clear()
-	}
-
 	gomu.pages.AddPage("help-page", center(list, 50, 32), true, true)
 	gomu.popups.push(list)
 }
 
+// keybindHelp lists the keybindings of a Keybinds table. Bindings to commands
+// are shown with the command name.
+func keybindHelp(table string) []string {
+
+	var help []string
+
+	for _, kb := range gomu.anko.KeybindList(table) {
+		name := gomu.command.nameOf(kb.Fn)
+		if name == "" {
+			name = "user function"
+		}
+
+		keys := kb.Keys
+		if keys == " " {
+			keys = "space"
+		}
+
+		help = append(help, fmt.Sprintf("%-6s %s", keys, name))
+	}
+
+	return help
+}
+
 // Input popup. Takes video url from youtube to be downloaded
 func downloadMusicPopup(selPlaylist *tview.TreeNode) {
 
-	re := regexp.MustCompile(`^((?:https?:)?\/\/)?((?:www|m)\.)?((?:youtube\.com|youtu.be))(\/(?:[\w\-]+\?v=|embed\/|v\/)?)([\w\-]+)(\S+)?$`)
+	re := regexp.MustCompile(`^((?:https?:)?\/\/)?((?:www|m)\.)?((?:youtube\.com|youtu.be))(\/(?:[\w\-]+\?v=|embed\/|v\/)?)(@?[\w\-]+)(\S+)?$`)
 
 	popupID := "download-input-popup"
 	input := newInputPopup(popupID, " Download ", "Url: ", "")
@@ -350,11 +376,7 @@ func downloadMusicPopup(selPlaylist *tview.TreeNode) {
 
 			// check if valid youtube url was given
 			if re.MatchString(url) {
-				go func() {
-					if err := ytdl(url, selPlaylist); err != nil {
-						errorPopup(err)
-					}
-				}()
+				downloadURL(url, selPlaylist)
 			} else {
 				defaultTimedPopup("Invalid url", "Invalid youtube url was given")
 			}
@@ -522,10 +544,6 @@ func searchPopup(title string, stringsToMatch []string, handler func(selected st
 	// this is to fix the left border of search popup
 	popupFrame := tview.NewFrame(popup)
 
-	if gomu.playingBar.albumPhoto != nil {
-		gomu.playingBar.albumPhoto.Clear()
-	}
-
 	gomu.pages.AddPage("search-input-popup", center(popupFrame, 70, 40), true, true)
 	gomu.popups.push(popup)
 }
@@ -592,6 +610,81 @@ func renamePopup(node *player.AudioFile) {
 	})
 }
 
+// Input popup that runs commands with arguments e.g. "seek +30". Tab completes
+// command names and paths.
+func commandLinePopup(text string) {
+
+	popupID := "command-line-input-popup"
+	input := newInputPopup(popupID, " Command ", ":", "")
+	input.SetAcceptanceFunc(nil)
+
+	root := gomu.playlist.GetRoot().GetReference().(*player.AudioFile).Path()
+
+	// the autocomplete list is only shown after tab is pressed
+	var showList bool
+	input.SetAutocompleteFunc(func(text string) []string {
+		if !showList {
+			return nil
+		}
+		return gomu.command.complete(text, root)
+	})
+	input.SetText(text)
+
+	input.SetInputCapture(func(e *tcell.EventKey) *tcell.EventKey {
+
+		if e.Key() != tcell.KeyTab {
+			return e
+		}
+
+		text := input.GetText()
+		completions := gomu.command.complete(text, root)
+
+		// let the autocomplete list select the entry
+		if showList && len(completions) > 0 {
+			return e
+		}
+
+		switch {
+		case len(completions) == 1:
+			input.SetText(completions[0])
+
+		case len(completions) > 1:
+			prefix := commonPrefix(completions)
+			if len(prefix) > len(text) {
+				input.SetText(prefix)
+			} else {
+				showList = true
+				input.Autocomplete()
+			}
+		}
+
+		return nil
+	})
+
+	input.SetDoneFunc(func(key tcell.Key) {
+
+		switch key {
+		case tcell.KeyEnter:
+			line := input.GetText()
+			gomu.pages.RemovePage(popupID)
+			gomu.popups.pop()
+
+			if strings.TrimSpace(line) == "" {
+				return
+			}
+
+			err := gomu.command.execute(line)
+			if err != nil {
+				errorPopup(err)
+			}
+
+		case tcell.KeyEsc:
+			gomu.pages.RemovePage(popupID)
+			gomu.popups.pop()
+		}
+	})
+}
+
 // Show error popup with error is logged. Prefer this when its related with user
 // interaction. Otherwise, use logError.
 func errorPopup(message error) {
@@ -734,10 +827,6 @@ func replPopup() {
 
 	flex.Box = flexBox
 
-	if gomu.playingBar.albumPhoto != nil {
-		gomu.playingBar.albumPhoto.Clear()
-	}
-
 	gomu.pages.AddPage(popupID, center(flex, 90, 30), true, true)
 	gomu.popups.push(flex)
 }
@@ -837,13 +926,7 @@ func ytSearchPopup() {
 						dir = audioFile.Node()
 					}
 
-					go func() {
-						url := urls[title]
-						if err := ytdl(url, dir); err != nil {
-							errorPopup(err)
-						}
-						gomu.playlist.refresh()
-					}()
+					confirmDownload(urls[title], title, dir)
 					gomu.app.SetFocus(gomu.prevPanel.(tview.Primitive))
 				})
 
@@ -860,13 +943,14 @@ func ytSearchPopup() {
 	})
 }
 
-func lyricPopup(lang string, audioFile *player.AudioFile, wg *sync.WaitGroup) error {
+// lyricPopup lets the user choose the lyric of lang to embed among the ones of
+// lyricFetcher, the fetcher is resolved by the caller as it reads the config
+func lyricPopup(
+	lang string, lyricFetcher lyric.LyricFetcher, audioFile *player.AudioFile, wg *sync.WaitGroup,
+) error {
 
 	var titles []string
 
-	// below we chose LyricFetcher interfaces by language
-	lyricFetcher := lyricLang(lang)
-
 	results, err := lyricFetcher.LyricOptions(audioFile.Name())
 	if err != nil {
 		return tracerr.Wrap(err)
@@ -881,56 +965,56 @@ func lyricPopup(lang string, audioFile *player.AudioFile, wg *sync.WaitGroup) er
 			return
 		}
 
-		go func() {
+		var selectedIndex int
+		for i, v := range results {
+			if v.TitleForPopup == selected {
+				selectedIndex = i
+				break
+			}
+		}
+
+		name := lang + " lyric of " + audioFile.Name()
+		gomu.jobs.submit("lyric", name, func(ctx context.Context, j *Job) error {
 			defer wg.Done()
-			var selectedIndex int
-			for i, v := range results {
-				if v.TitleForPopup == selected {
-					selectedIndex = i
-					break
-				}
+			// the translation is embedded as a second lyric
+			var lyricContent, translation string
+			var err error
+			if fetcher, ok := lyricFetcher.(lyric.TranslationFetcher); ok {
+				lyricContent, translation, err = fetcher.LyricFetchTranslation(results[selectedIndex])
+			} else {
+				lyricContent, err = lyricFetcher.LyricFetch(results[selectedIndex])
 			}
-			lyricContent, err := lyricFetcher.LyricFetch(results[selectedIndex])
 			if err != nil {
-				errorPopup(err)
-				gomu.app.Draw()
-				return
+				return tracerr.Wrap(err)
 			}
 
 			var lyric lyric.Lyric
 			err = lyric.NewFromLRC(lyricContent)
 			if err != nil {
-				errorPopup(err)
-				gomu.app.Draw()
-				return
+				return tracerr.Wrap(err)
 			}
 			lyric.LangExt = lang
 			err = embedLyric(audioFile.Path(), &lyric, false)
 			if err != nil {
-				errorPopup(err)
-				gomu.app.Draw()
-				return
+				return tracerr.Wrap(err)
 			}
-			infoPopup(lang + " lyric added successfully")
-			gomu.app.Draw()
+			msg := lang + " lyric added successfully"
+			if translation != "" {
+				err = embedTranslation(audioFile.Path(), lang, translation)
+				if err != nil {
+					return tracerr.Wrap(err)
+				}
+				msg = lang + " lyric and its translation added successfully"
+			}
+			gomu.app.QueueUpdateDraw(func() {
+				infoPopup(msg)
+			})
 
-		}()
+			return nil
+		})
 	})
 
 	gomu.app.Draw()
 
 	return nil
 }
-
-func lyricLang(lang string) lyric.LyricFetcher {
-
-	switch lang {
-	case "en":
-		return lyric.LyricFetcherEn{}
-	case "zh-CN":
-		return lyric.LyricFetcherCn{}
-	default:
-		return lyric.LyricFetcherEn{}
-	}
-
-}
@@ -30,6 +30,12 @@ type Queue struct {
 	isLoop         bool
 }
 
+// Draw draws the queue and the album photo of the current song
+func (q *Queue) Draw(screen tcell.Screen) {
+	q.List.Draw(screen)
+	gomu.playingBar.drawCover(screen)
+}
+
 // Highlight the next item in the queue
 func (q *Queue) next() {
 	currIndex := q.GetCurrentItem()
@@ -46,6 +52,16 @@ func (q *Queue) prev() {
 	q.SetCurrentItem(currIndex - 1)
 }
 
+// Highlight the first item in the queue
+func (q *Queue) top() {
+	q.SetCurrentItem(0)
+}
+
+// Highlight the last item in the queue
+func (q *Queue) bottom() {
+	q.SetCurrentItem(q.GetItemCount() - 1)
+}
+
 // Usually used with GetCurrentItem which can return -1 if
 // no item highlighted
 func (q *Queue) deleteItem(index int) (*player.AudioFile, error) {
@@ -245,6 +261,20 @@ func (q *Queue) clearQueue() {
 
 }
 
+// Puts the items back in front of the queue, used to undo clearing the queue
+func (q *Queue) restoreItems(items []*player.AudioFile) {
+
+	current := q.items
+	q.clearQueue()
+
+	for _, v := range items {
+		q.enqueue(v)
+	}
+	for _, v := range current {
+		q.enqueue(v)
+	}
+}
+
 // Loads previously saved list
 func (q *Queue) loadQueue() error {
 
@@ -311,20 +341,7 @@ func (q *Queue) getSavedQueue() ([]string, error) {
 }
 
 func (q *Queue) help() []string {
-
-	return []string{
-		"j      down",
-		"k      up",
-		"l      play selected song",
-		"d      remove from queue",
-		"D      clear queue",
-		"z      toggle loop",
-		"s      shuffle",
-		"/      find in queue",
-		"t      lyric delay increase 0.5 second",
-		"r      lyric delay decrease 0.5 second",
-	}
-
+	return keybindHelp("queue")
 }
 
 // Shuffles the queue
@@ -365,35 +382,30 @@ func newQueue() *Queue {
 		savedQueuePath: cacheQueuePath,
 	}
 
-	cmds := map[rune]string{
-		'j': "move_down",
-		'k': "move_up",
-		'd': "delete_item",
-		'D': "clear_queue",
-		'l': "play_selected",
-		'z': "toggle_loop",
-		's': "shuffle_queue",
-		'/': "queue_search",
-		't': "lyric_delay_increase",
-		'r': "lyric_delay_decrease",
+	cmds := map[string]string{
+		"gg": "move_top",
+		"G":  "move_bottom",
+		"j":  "move_down",
+		"k":  "move_up",
+		"d":  "delete_item",
+		"D":  "clear_queue",
+		"l":  "play_selected",
+		"z":  "toggle_loop",
+		"s":  "shuffle_queue",
+		"/":  "queue_search",
+		"t":  "lyric_delay_increase",
+		"r":  "lyric_delay_decrease",
+		"e":  "sync_lyric",
 	}
 
 	for key, cmdName := range cmds {
-		src := fmt.Sprintf(`Keybinds.def_q("%c", %s)`, key, cmdName)
+		src := fmt.Sprintf(`Keybinds.def_q("%s", %s)`, key, cmdName)
 		gomu.anko.Execute(src)
 	}
 
+	// keybindings are resolved in the application input capture, other keys
+	// are ignored
 	queue.SetInputCapture(func(e *tcell.EventKey) *tcell.EventKey {
-
-		if gomu.anko.KeybindExists("queue", e) {
-
-			err := gomu.anko.ExecKeybind("queue", e)
-			if err != nil {
-				errorPopup(err)
-			}
-
-		}
-
 		return nil
 	})
 
@@ -441,6 +453,37 @@ func (q *Queue) renameItem(oldAudio *player.AudioFile, newAudio *player.AudioFil
 	return nil
 }
 
+// replacePath replaces the songs at path with newAudio after it has been
+// moved, the song being played included
+func (q *Queue) replacePath(path string, newAudio *player.AudioFile) error {
+
+	for i, v := range q.items {
+		if v.Path() != path {
+			continue
+		}
+		err := q.insertItem(i, newAudio)
+		if err != nil {
+			return tracerr.Wrap(err)
+		}
+		_, err = q.deleteItem(i + 1)
+		if err != nil {
+			return tracerr.Wrap(err)
+		}
+	}
+
+	currentSong := gomu.player.GetCurrentSong()
+	if currentSong == nil || currentSong.Path() != path {
+		return nil
+	}
+
+	oldAudio, ok := currentSong.(*player.AudioFile)
+	if !ok {
+		return nil
+	}
+
+	return q.updateCurrentSongName(oldAudio, newAudio)
+}
+
 // playQueue play the first item in the queue
 func (q *Queue) playQueue() error {
 
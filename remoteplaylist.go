@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/rivo/tview"
+	"github.com/ztrue/tracerr"
+
+	"github.com/issadarkthing/gomu/player"
+)
+
+// remoteItem is an entry of a playlist listed by the downloader, entries of a
+// channel can be playlists themselves such as its videos or shorts
+type remoteItem struct {
+	Type  string `json:"_type"`
+	ID    string `json:"id"`
+	URL   string `json:"url"`
+	Title string `json:"title"`
+	IEKey string `json:"ie_key"`
+}
+
+// remotePlaylist is a playlist or a channel listed by the downloader
+type remotePlaylist struct {
+	ID      string       `json:"id"`
+	Title   string       `json:"title"`
+	Entries []remoteItem `json:"entries"`
+}
+
+// isPlaylistURL reports whether the url is a youtube playlist or channel
+// rather than a video
+func isPlaylistURL(rawURL string) bool {
+
+	u, err := url.Parse(rawURL)
+	if err != nil || !strings.Contains(u.Host, "youtube.com") {
+		return false
+	}
+
+	if u.Query().Get("v") != "" {
+		return false
+	}
+	if u.Query().Get("list") != "" {
+		return true
+	}
+
+	for _, prefix := range []string{"/playlist", "/channel/", "/c/", "/user/", "/@"} {
+		if strings.HasPrefix(u.Path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// videoID returns the id of the youtube video of the url, empty if it is not
+// the url of a video
+func videoID(rawURL string) string {
+
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return ""
+	}
+
+	switch {
+	case strings.Contains(u.Host, "youtu.be"):
+		return strings.Trim(u.Path, "/")
+	case !strings.Contains(u.Host, "youtube.com"):
+		return ""
+	case u.Query().Get("v") != "":
+		return u.Query().Get("v")
+	}
+
+	for _, prefix := range []string{"/shorts/", "/embed/", "/v/"} {
+		if strings.HasPrefix(u.Path, prefix) {
+			return strings.TrimPrefix(u.Path, prefix)
+		}
+	}
+
+	return ""
+}
+
+// itemURL returns the url of the entry, youtube-dl lists the id of the
+// videos only
+func (item remoteItem) itemURL() string {
+	if strings.Contains(item.URL, "://") {
+		return item.URL
+	}
+	id := item.ID
+	if id == "" {
+		id = item.URL
+	}
+	return "https://www.youtube.com/watch?v=" + id
+}
+
+// nested reports whether the entry is a playlist of a channel
+func (item remoteItem) nested() bool {
+	return item.Type == "playlist" || item.IEKey == "YoutubeTab" ||
+		isPlaylistURL(item.URL)
+}
+
+// expand lists the videos of the playlist or the channel without downloading
+// them, the playlists of a channel are expanded as well
+func (d *Downloader) expand(ctx context.Context, playlistURL string) (*remotePlaylist, error) {
+	return d.expandDepth(ctx, playlistURL, 1)
+}
+
+func (d *Downloader) expandDepth(
+	ctx context.Context, playlistURL string, depth int,
+) (*remotePlaylist, error) {
+
+	cmd := exec.CommandContext(ctx, d.exe, "--flat-playlist", "--dump-single-json", playlistURL)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return nil, tracerr.Errorf("%s: %v: %s", filepath.Base(d.exe), err,
+			lastLine(stderr.String()))
+	}
+
+	var playlist remotePlaylist
+	err = json.Unmarshal(stdout.Bytes(), &playlist)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+
+	var entries []remoteItem
+	for _, item := range playlist.Entries {
+		if !item.nested() {
+			entries = append(entries, item)
+			continue
+		}
+		if depth == 0 {
+			continue
+		}
+		nested, err := d.expandDepth(ctx, item.itemURL(), depth-1)
+		if err != nil {
+			return nil, tracerr.Wrap(err)
+		}
+		entries = append(entries, nested.Entries...)
+	}
+	playlist.Entries = entries
+
+	return &playlist, nil
+}
+
+// dirName returns the name of the directory of the playlist
+func (p *remotePlaylist) dirName() string {
+
+	name := strings.TrimSpace(p.Title)
+	if name == "" {
+		name = strings.TrimSpace(p.ID)
+	}
+
+	name = strings.NewReplacer("/", "-", "\\", "-", "\x00", "").Replace(name)
+	name = strings.TrimLeft(name, ".")
+	if name == "" {
+		return "playlist"
+	}
+
+	return name
+}
+
+// downloadedURLs returns the videos downloaded according to the history,
+// keyed by video id when they have one
+func downloadedURLs(path string) (map[string]bool, error) {
+
+	entries, err := readHistory(path)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+
+	downloaded := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.Status == historyDone {
+			downloaded[entry.key()] = true
+		}
+	}
+
+	return downloaded, nil
+}
+
+// missing returns the entries which have not been downloaded yet
+func (p *remotePlaylist) missing(downloaded map[string]bool) []remoteItem {
+
+	var items []remoteItem
+	for _, item := range p.Entries {
+		itemURL := item.itemURL()
+		if id := videoID(itemURL); id != "" && downloaded[id] {
+			continue
+		}
+		if downloaded[itemURL] {
+			continue
+		}
+		items = append(items, item)
+	}
+
+	return items
+}
+
+// downloadURL downloads a video or every video of a playlist or a channel
+func downloadURL(rawURL string, selPlaylist *tview.TreeNode) {
+	if isPlaylistURL(rawURL) {
+		downloadPlaylist(rawURL, selPlaylist)
+		return
+	}
+	confirmDownload(rawURL, "", selPlaylist)
+}
+
+// confirmDownload downloads the video, the user confirms it first if the video
+// has already been downloaded and is still in the library
+func confirmDownload(url, title string, selPlaylist *tview.TreeNode) {
+
+	entries, err := readHistory(historyPath())
+	if err != nil {
+		logError(err)
+	}
+
+	entry, ok := lastDownload(entries, url)
+	if !ok || entry.Path == "" || entry.missing() {
+		downloadAudio(url, title, selPlaylist)
+		return
+	}
+
+	confirmationPopup(
+		fmt.Sprintf("Already downloaded to %s on %s, download it again?",
+			libraryPath(entry.Path), entry.Date.Format("2006-01-02")),
+		func(_ int, label string) {
+			if label == "yes" {
+				downloadAudio(url, title, selPlaylist)
+			}
+		})
+}
+
+// downloadPlaylist downloads the videos of a playlist or a channel to a new
+// playlist named after it in the background. Each video is downloaded in its
+// own job so that General.job_limits bounds the downloads running at the same
+// time, the job of the playlist runs until they end and canceling it cancels
+// them. The videos in the history of downloads are skipped so that the
+// playlist can be mirrored again later.
+func downloadPlaylist(playlistURL string, selPlaylist *tview.TreeNode) {
+
+	parent := selPlaylist.GetReference().(*player.AudioFile).Path()
+
+	config, err := newDownloadConfig()
+	if err != nil {
+		errorPopup(err)
+		return
+	}
+
+	gomu.jobs.submit("playlist", "Playlist "+playlistURL, func(ctx context.Context, j *Job) error {
+
+		j.setStatus("listing the videos")
+		playlist, err := config.downloader.expand(ctx, playlistURL)
+		if err != nil {
+			return tracerr.Wrap(err)
+		}
+
+		downloaded, err := downloadedURLs(config.history)
+		if err != nil {
+			return tracerr.Wrap(err)
+		}
+
+		items := playlist.missing(downloaded)
+		j.setStatus("%d new of %d videos", len(items), len(playlist.Entries))
+		if len(items) == 0 || ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		dir := filepath.Join(parent, playlist.dirName())
+		err = os.MkdirAll(dir, 0755)
+		if err != nil {
+			return tracerr.Wrap(err)
+		}
+
+		// the node of the new playlist is created by the playlist panel
+		nodes := make(chan *tview.TreeNode)
+		gomu.app.QueueUpdateDraw(func() {
+			gomu.playlist.refresh()
+			nodes <- gomu.playlist.findNode(dir)
+		})
+		node := <-nodes
+		if node == nil {
+			return tracerr.Errorf("playlist %s is not in the music directory", dir)
+		}
+
+		// the downloads are submitted from the job as submitting them queues
+		// an update of the UI
+		var downloads []*Job
+		for _, item := range items {
+			downloads = append(downloads, config.downloadAudio(item.itemURL(), item.Title, node))
+		}
+
+		var failed int
+		err = gomu.jobs.wait(ctx, downloads, func(done, errs int) {
+			failed = errs
+			j.setProgress(done+errs, len(downloads))
+		})
+		if err != nil {
+			return err
+		}
+
+		j.setStatus("%d downloaded, %d failed", len(downloads)-failed, failed)
+		if failed > 0 {
+			return tracerr.Errorf("%d of %d videos failed to download", failed, len(downloads))
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeLister lists a channel with its videos tab like yt-dlp and a playlist
+// with the ids of its videos only like youtube-dl
+const fakeLister = `#!/bin/sh
+for url; do :; done
+case "$url" in
+*@chan/videos)
+	echo '{"id": "UCchan", "title": "Chan - Videos", "entries": [
+		{"_type": "url", "ie_key": "Youtube", "id": "v1", "url": "https://www.youtube.com/watch?v=v1", "title": "One"},
+		{"_type": "url", "ie_key": "Youtube", "id": "v2", "url": "https://www.youtube.com/watch?v=v2", "title": "Two"}]}' ;;
+*@chan)
+	echo '{"id": "UCchan", "title": "Chan", "entries": [
+		{"_type": "url", "ie_key": "YoutubeTab", "url": "https://www.youtube.com/@chan/videos", "title": "Chan - Videos"}]}' ;;
+*list=PL1)
+	echo '{"id": "PL1", "title": "Mix/2021", "entries": [
+		{"_type": "url", "ie_key": "Youtube", "id": "v1", "url": "v1", "title": "One"},
+		{"_type": "url", "ie_key": "Youtube", "id": "v3", "url": "v3", "title": "Three"}]}' ;;
+*)
+	echo "ERROR: Unsupported URL: $url" >&2
+	exit 1 ;;
+esac
+`
+
+func TestIsPlaylistURL(t *testing.T) {
+
+	tests := map[string]bool{
+		"https://www.youtube.com/playlist?list=PL1":         true,
+		"https://www.youtube.com/@chan":                     true,
+		"https://www.youtube.com/@chan/videos":              true,
+		"https://www.youtube.com/channel/UCchan":            true,
+		"https://www.youtube.com/watch?v=v1&list=PL1":       false,
+		"https://www.youtube.com/watch?v=v1":                false,
+		"https://youtu.be/v1":                               false,
+		"https://soundcloud.com/artist/sets/playlist?list=": false,
+	}
+
+	for url, expected := range tests {
+		assert.Equal(t, expected, isPlaylistURL(url), url)
+	}
+}
+
+func TestVideoID(t *testing.T) {
+
+	tests := map[string]string{
+		"https://www.youtube.com/watch?v=v1&list=PL1": "v1",
+		"https://youtu.be/v2":                         "v2",
+		"https://m.youtube.com/shorts/v3":             "v3",
+		"https://www.youtube.com/playlist?list=PL1":   "",
+		"https://soundcloud.com/artist/song":          "",
+	}
+
+	for url, expected := range tests {
+		assert.Equal(t, expected, videoID(url), url)
+	}
+}
+
+func TestExpandPlaylist(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+
+	dir, remove := fakeDownloaderDir(t, "fake-dl", fakeLister)
+	defer remove()
+
+	d, err := newDownloader()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the videos of the tabs of the channel are listed
+	channel, err := d.expand(context.Background(), "https://www.youtube.com/@chan")
+	assert.NoError(t, err)
+	assert.Equal(t, "Chan", channel.dirName())
+	if assert.Len(t, channel.Entries, 2) {
+		assert.Equal(t, "https://www.youtube.com/watch?v=v2", channel.Entries[1].itemURL())
+		assert.Equal(t, "Two", channel.Entries[1].Title)
+	}
+
+	playlist, err := d.expand(context.Background(), "https://www.youtube.com/playlist?list=PL1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Mix-2021", playlist.dirName())
+
+	// the videos in the history are skipped
+	historyPath := filepath.Join(dir, "urls")
+	err = ioutil.WriteFile(historyPath, []byte("https://youtu.be/v1\nhttps://soundcloud.com/a/b\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	downloaded, err := downloadedURLs(historyPath)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"v1": true, "https://soundcloud.com/a/b": true}, downloaded)
+
+	missing := playlist.missing(downloaded)
+	if assert.Len(t, missing, 1) {
+		assert.Equal(t, "https://www.youtube.com/watch?v=v3", missing[0].itemURL())
+	}
+
+	// there is no history before the first download
+	downloaded, err = downloadedURLs(filepath.Join(dir, "missing"))
+	assert.NoError(t, err)
+	assert.Empty(t, downloaded)
+
+	_, err = d.expand(context.Background(), "https://www.youtube.com/@other/x")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Unsupported URL")
+}
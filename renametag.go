@@ -0,0 +1,415 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/ztrue/tracerr"
+
+	"github.com/issadarkthing/gomu/player"
+)
+
+// conflict strategies used when the new path of a file already exists
+const (
+	conflictSkip      = "skip"
+	conflictSuffix    = "suffix"
+	conflictOverwrite = "overwrite"
+)
+
+var conflictStrategies = []string{conflictSkip, conflictSuffix, conflictOverwrite}
+
+// renameMove is the move of an audio file to the path built from its tags
+type renameMove struct {
+	audioFile *player.AudioFile
+	from      string
+	to        string
+	// skip is the reason the file is not renamed
+	skip string
+	// overwrite is true if the existing file at to is moved to the trash
+	overwrite bool
+	// trash is the path in the trash of the file overwritten
+	trash string
+}
+
+// templatePath builds the path of the file from the template. Templates with
+// a slash are relative to root, others to the directory of the file.
+func templatePath(template string, fields map[string]string, from, root string) (string, bool) {
+
+	values := make(map[string]string, len(fields))
+	for key, value := range fields {
+		value = strings.TrimSpace(value)
+		switch {
+		// the total of track and disc numbers is dropped by formatTags
+		case key == "track" || key == "disc":
+		case value == "":
+			value = "Unknown"
+		default:
+			// values must not create directories
+			value = strings.ReplaceAll(value, "/", "_")
+		}
+		values[key] = value
+	}
+
+	name, hasValue := formatTags(template, fields)
+	if !hasValue {
+		return "", false
+	}
+	name, _ = formatTags(template, values)
+
+	dir := filepath.Dir(from)
+	if strings.Contains(template, "/") {
+		dir = root
+	}
+
+	return filepath.Join(dir, name+filepath.Ext(from)), true
+}
+
+// planRename computes the moves of the files, fields contains the tags of each
+// file. exists reports whether a path is already used on the filesystem.
+func planRename(
+	audioFiles []*player.AudioFile, fields []map[string]string,
+	template, root, conflict string, exists func(string) bool,
+) []renameMove {
+
+	moves := make([]renameMove, len(audioFiles))
+	// paths that will be used once the moves are done
+	taken := make(map[string]bool)
+
+	for i, audioFile := range audioFiles {
+		from := audioFile.Path()
+		moves[i] = renameMove{audioFile: audioFile, from: from, to: from}
+
+		to, ok := templatePath(template, fields[i], from, root)
+		switch {
+		case !ok:
+			moves[i].skip = "no tags"
+			taken[from] = true
+			continue
+		case to == from:
+			taken[from] = true
+			continue
+		}
+
+		used := func(path string) bool {
+			return taken[path] || exists(path)
+		}
+
+		if used(to) {
+			switch conflict {
+			case conflictSuffix:
+				ext := filepath.Ext(to)
+				base := strings.TrimSuffix(to, ext)
+				for n := 2; used(to); n++ {
+					to = fmt.Sprintf("%s (%d)%s", base, n, ext)
+				}
+			case conflictOverwrite:
+				if taken[to] {
+					moves[i].skip = "conflicts with another file"
+					taken[from] = true
+					continue
+				}
+				moves[i].overwrite = true
+			default:
+				moves[i].skip = "already exists"
+				taken[from] = true
+				continue
+			}
+		}
+
+		moves[i].to = to
+		taken[to] = true
+	}
+
+	return moves
+}
+
+// planRenameByTags reads the tags of the files and computes their moves using
+// General.rename_template.
+func planRenameByTags(audioFiles []*player.AudioFile, conflict string) ([]renameMove, error) {
+
+	fields := make([]map[string]string, len(audioFiles))
+	for i, audioFile := range audioFiles {
+		f, err := readTagFields(audioFile.Path())
+		if err != nil {
+			return nil, tracerr.Wrap(err)
+		}
+		fields[i] = f
+	}
+
+	template := gomu.anko.GetString("General.rename_template")
+	root := gomu.playlist.GetRoot().GetReference().(*player.AudioFile).Path()
+
+	exists := func(path string) bool {
+		_, err := os.Lstat(path)
+		return err == nil
+	}
+
+	return planRename(audioFiles, fields, template, root, conflict, exists), nil
+}
+
+// applyRename moves the files, removes directories left empty and keeps the
+// queue updated. It returns the number of files renamed.
+func applyRename(moves []renameMove) (int, error) {
+
+	var done []renameMove
+	var err error
+
+	for _, move := range moves {
+		if move.skip != "" || move.from == move.to {
+			continue
+		}
+
+		err = os.MkdirAll(filepath.Dir(move.to), 0755)
+		if err != nil {
+			err = tracerr.Wrap(err)
+			break
+		}
+
+		if move.overwrite {
+			move.trash, err = moveToTrash(move.to)
+			if err != nil {
+				break
+			}
+		}
+
+		err = movePath(move.from, move.to)
+		if err != nil {
+			if move.trash != "" {
+				logError(movePath(move.trash, move.to))
+			}
+			break
+		}
+
+		removeEmptyDirs(filepath.Dir(move.from))
+		done = append(done, move)
+	}
+
+	if len(done) == 0 {
+		return 0, err
+	}
+
+	gomu.playlist.refresh()
+
+	// the nodes are found by path as several files can have the same name
+	for _, move := range done {
+		node := gomu.playlist.findNode(move.to)
+		if node == nil {
+			logError(tracerr.Errorf("%s not found in playlist", move.to))
+			continue
+		}
+		refreshErr := gomu.queue.replacePath(move.from, node.GetReference().(*player.AudioFile))
+		if refreshErr != nil {
+			logError(refreshErr)
+		}
+	}
+
+	gomu.journal.record(fmt.Sprintf("rename %d files by tags", len(done)),
+		func() error {
+			for i := len(done) - 1; i >= 0; i-- {
+				err := os.MkdirAll(filepath.Dir(done[i].from), 0755)
+				if err != nil {
+					return tracerr.Wrap(err)
+				}
+				err = movePath(done[i].to, done[i].from)
+				if err != nil {
+					return tracerr.Wrap(err)
+				}
+				// restore the file that was overwritten
+				if done[i].trash != "" {
+					err = movePath(done[i].trash, done[i].to)
+					if err != nil {
+						return tracerr.Wrap(err)
+					}
+				} else {
+					removeEmptyDirs(filepath.Dir(done[i].to))
+				}
+			}
+			gomu.playlist.refresh()
+			gomu.queue.updateQueuePath()
+			return nil
+		},
+		func() error {
+			for _, move := range done {
+				err := os.MkdirAll(filepath.Dir(move.to), 0755)
+				if err != nil {
+					return tracerr.Wrap(err)
+				}
+				if move.trash != "" {
+					err = movePath(move.to, move.trash)
+					if err != nil {
+						return tracerr.Wrap(err)
+					}
+				}
+				err = movePath(move.from, move.to)
+				if err != nil {
+					return tracerr.Wrap(err)
+				}
+				removeEmptyDirs(filepath.Dir(move.from))
+			}
+			gomu.playlist.refresh()
+			gomu.queue.updateQueuePath()
+			return nil
+		})
+
+	return len(done), err
+}
+
+// removeEmptyDirs removes dir and its parents while they are empty, the music
+// directory is kept.
+func removeEmptyDirs(dir string) {
+
+	root := gomu.playlist.GetRoot().GetReference().(*player.AudioFile).Path()
+
+	for dir != root && strings.HasPrefix(dir, root) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// renameFileByTags renames a single file with the rename template and returns
+// the renamed audio file.
+func renameFileByTags(audioFile *player.AudioFile) (*player.AudioFile, error) {
+
+	conflict := gomu.anko.GetString("General.rename_conflict")
+	moves, err := planRenameByTags([]*player.AudioFile{audioFile}, conflict)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+
+	if moves[0].skip != "" {
+		return nil, tracerr.Errorf("unable to rename %s: %s", audioFile.Name(), moves[0].skip)
+	}
+
+	_, err = applyRename(moves)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+
+	node := gomu.playlist.findNode(moves[0].to)
+	if node == nil {
+		return nil, tracerr.Errorf("%s not found in playlist", moves[0].to)
+	}
+
+	return node.GetReference().(*player.AudioFile), nil
+}
+
+// renameByTagsPopup shows what the files will be renamed to before renaming
+// them. The conflict strategy can be changed from the popup.
+func renameByTagsPopup(audioFiles []*player.AudioFile) error {
+
+	popupID := "rename-tags-input-popup"
+
+	conflict := gomu.anko.GetString("General.rename_conflict")
+	moves, err := planRenameByTags(audioFiles, conflict)
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+
+	root := gomu.playlist.GetRoot().GetReference().(*player.AudioFile).Path()
+
+	textView := tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(true)
+	textView.SetBackgroundColor(gomu.colors.popup)
+
+	flex := tview.NewFlex().SetDirection(tview.FlexRow)
+
+	setPreview := func() {
+		var preview strings.Builder
+		var count int
+		for _, move := range moves {
+			from, _ := filepath.Rel(root, move.from)
+			to, _ := filepath.Rel(root, move.to)
+
+			switch {
+			case move.skip != "":
+				fmt.Fprintf(&preview, "[red]%s (%s)[-]\n", tview.Escape(from), move.skip)
+			case move.from != move.to:
+				count++
+				fmt.Fprintf(&preview, "%s\n  -> [green]%s[-]", tview.Escape(from), tview.Escape(to))
+				if move.overwrite {
+					fmt.Fprint(&preview, " [red](overwrite)[-]")
+				}
+				fmt.Fprintln(&preview)
+			}
+		}
+		textView.SetText(preview.String())
+		flex.SetTitle(fmt.Sprintf(" Rename By Tags (%d of %d files) ", count, len(moves)))
+	}
+
+	closePopup := func() {
+		gomu.pages.RemovePage(popupID)
+		gomu.popups.pop()
+	}
+
+	initial := 0
+	for i, strategy := range conflictStrategies {
+		if strategy == conflict {
+			initial = i
+		}
+	}
+
+	form := tview.NewForm().
+		AddDropDown("On conflict: ", conflictStrategies, initial,
+			func(option string, _ int) {
+				if option == conflict {
+					return
+				}
+				conflict = option
+				newMoves, err := planRenameByTags(audioFiles, conflict)
+				if err != nil {
+					errorPopup(err)
+					return
+				}
+				moves = newMoves
+				setPreview()
+			}).
+		AddButton("Rename", func() {
+			closePopup()
+			renamed, err := applyRename(moves)
+			if err != nil {
+				errorPopup(err)
+				return
+			}
+			defaultTimedPopup(" Success ", fmt.Sprintf("%d files renamed", renamed))
+		}).
+		AddButton("Cancel", closePopup).
+		SetFieldBackgroundColor(gomu.colors.popup).
+		SetFieldTextColor(gomu.colors.accent).
+		SetLabelColor(gomu.colors.accent).
+		SetButtonBackgroundColor(gomu.colors.popup).
+		SetButtonTextColor(gomu.colors.accent).
+		SetHorizontal(true)
+	form.SetBackgroundColor(gomu.colors.popup)
+	form.SetCancelFunc(closePopup)
+
+	flex.AddItem(textView, 0, 1, false).
+		AddItem(form, 3, 0, true)
+
+	flex.SetBackgroundColor(gomu.colors.popup).
+		SetBorder(true).
+		SetBorderPadding(1, 0, 2, 2)
+
+	setPreview()
+
+	// scroll the preview while the form keeps focus
+	flex.SetInputCapture(func(e *tcell.EventKey) *tcell.EventKey {
+		switch e.Key() {
+		case tcell.KeyPgUp, tcell.KeyPgDn:
+			textView.InputHandler()(e, nil)
+			return nil
+		}
+		return e
+	})
+
+	gomu.pages.AddPage(popupID, center(flex, 90, 30), true, true)
+	gomu.popups.push(flex)
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rivo/tview"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/issadarkthing/gomu/player"
+)
+
+func TestTemplatePath(t *testing.T) {
+
+	fields := map[string]string{
+		"artist":      "AC/DC",
+		"albumartist": "",
+		"album":       "Back in Black",
+		"title":       "Hells Bells",
+		"track":       "1/10",
+	}
+
+	path, ok := templatePath("{albumartist}/{album}/{track:02} - {title}",
+		fields, "/music/old/song.mp3", "/music")
+	assert.True(t, ok)
+	assert.Equal(t, "/music/Unknown/Back in Black/01 - Hells Bells.mp3", path)
+
+	path, ok = templatePath("{artist}-{title}", fields, "/music/old/song.mp3", "/music")
+	assert.True(t, ok)
+	assert.Equal(t, "/music/old/AC_DC-Hells Bells.mp3", path)
+
+	_, ok = templatePath("{title}", map[string]string{"title": ""}, "/music/a.mp3", "/music")
+	assert.False(t, ok)
+}
+
+func TestPlanRename(t *testing.T) {
+
+	var audioFiles []*player.AudioFile
+	for _, path := range []string{"/music/a.mp3", "/music/b.mp3", "/music/c.mp3", "/music/d.mp3"} {
+		audioFile := new(player.AudioFile)
+		audioFile.SetPath(path)
+		audioFiles = append(audioFiles, audioFile)
+	}
+
+	fields := []map[string]string{
+		{"title": "Same"},
+		{"title": "Same"},
+		{"title": "Existing"},
+		{"title": ""},
+	}
+
+	exists := func(path string) bool {
+		return path == "/music/Existing.mp3"
+	}
+
+	moves := planRename(audioFiles, fields, "{title}", "/music", conflictSkip, exists)
+	assert.Equal(t, "/music/Same.mp3", moves[0].to)
+	assert.Equal(t, "already exists", moves[1].skip)
+	assert.Equal(t, "already exists", moves[2].skip)
+	assert.Equal(t, "no tags", moves[3].skip)
+
+	moves = planRename(audioFiles, fields, "{title}", "/music", conflictSuffix, exists)
+	assert.Equal(t, "/music/Same.mp3", moves[0].to)
+	assert.Equal(t, "/music/Same (2).mp3", moves[1].to)
+	assert.Equal(t, "/music/Existing (2).mp3", moves[2].to)
+
+	moves = planRename(audioFiles, fields, "{title}", "/music", conflictOverwrite, exists)
+	assert.Equal(t, "conflicts with another file", moves[1].skip)
+	assert.True(t, moves[2].overwrite)
+	assert.Equal(t, "/music/Existing.mp3", moves[2].to)
+}
+
+func TestApplyRename(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+	gomu.player = player.New(0)
+
+	dir, err := ioutil.TempDir("", "gomu-renametag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	song, err := ioutil.ReadFile("./test/rap/audio_test.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// two files have the same name in different directories
+	for _, path := range []string{"one/song.mp3", "two/song.mp3", "two/Existing.mp3"} {
+		path = filepath.Join(dir, "music", path)
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(path, song, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = gomu.anko.Execute(fmt.Sprintf("General.trash_dir = %q", filepath.Join(dir, "trash")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := tview.NewTreeNode("music")
+	rootAudioFile := new(player.AudioFile)
+	rootAudioFile.SetPath(filepath.Join(dir, "music"))
+	root.SetReference(rootAudioFile)
+	populate(root, rootAudioFile.Path(), false)
+	gomu.playlist.SetRoot(root).SetCurrentNode(root)
+
+	one := gomu.playlist.findNode("one/song.mp3").GetReference().(*player.AudioFile)
+	two := gomu.playlist.findNode("two/song.mp3").GetReference().(*player.AudioFile)
+	_, err = gomu.queue.enqueue(one)
+	assert.NoError(t, err)
+	_, err = gomu.queue.enqueue(two)
+	assert.NoError(t, err)
+
+	existing := filepath.Join(dir, "music", "two", "Existing.mp3")
+	moves := []renameMove{{audioFile: two, from: two.Path(), to: existing, overwrite: true}}
+
+	renamed, err := applyRename(moves)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, renamed)
+
+	// the queue item of the file renamed is updated, not the one of the same name
+	assert.Equal(t, one.Path(), gomu.queue.items[0].Path())
+	assert.Equal(t, existing, gomu.queue.items[1].Path())
+	assert.NoFileExists(t, two.Path())
+
+	// the file overwritten is restored by undo
+	_, err = gomu.journal.undo()
+	assert.NoError(t, err)
+	assert.FileExists(t, two.Path())
+	assert.FileExists(t, existing)
+
+	_, err = gomu.journal.redo()
+	assert.NoError(t, err)
+	assert.NoFileExists(t, two.Path())
+	assert.FileExists(t, existing)
+}
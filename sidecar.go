@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tramhao/id3v2"
+	"github.com/ztrue/tracerr"
+
+	"github.com/issadarkthing/gomu/lyric"
+	"github.com/issadarkthing/gomu/player"
+)
+
+// Sidecar lyrics are .lrc files next to the song. song.lrc contains the lyric
+// of the preferred language, the first one of General.lang_lyric, and
+// song.<lang>.lrc the lyric of the other languages e.g. song.zh-CN.lrc. The
+// preferred language is read before the jobs start and passed to the functions
+// below as anko cannot be used from the jobs.
+
+// defaultLyricLang returns the preferred language of the lyrics
+func defaultLyricLang() string {
+	sources := lyricSources()
+	if len(sources) > 0 {
+		return sources[0].lang
+	}
+	return "en"
+}
+
+// sidecarPath returns the path of the .lrc file of the lyric of the song,
+// preferred is the preferred language of the lyrics
+func sidecarPath(songPath, langExt, preferred string) string {
+	base := strings.TrimSuffix(songPath, filepath.Ext(songPath))
+	if langExt == "" || langExt == preferred {
+		return base + ".lrc"
+	}
+	return base + "." + langExt + ".lrc"
+}
+
+// sidecarFiles returns the path of each .lrc file of the song by language
+func sidecarFiles(songPath, preferred string) (map[string]string, error) {
+
+	dir := filepath.Dir(songPath)
+	name := filepath.Base(songPath)
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+
+	// names of the other files without extension
+	stems := map[string]bool{}
+	for _, file := range files {
+		fileName := file.Name()
+		if filepath.Ext(fileName) != ".lrc" {
+			stems[strings.TrimSuffix(fileName, filepath.Ext(fileName))] = true
+		}
+	}
+
+	sidecars := map[string]string{}
+	for _, file := range files {
+		fileName := file.Name()
+		if file.IsDir() || filepath.Ext(fileName) != ".lrc" {
+			continue
+		}
+
+		lang := strings.TrimSuffix(fileName, ".lrc")
+		if lang == base {
+			lang = preferred
+		} else if strings.HasPrefix(lang, base+".") {
+			lang = strings.TrimPrefix(lang, base+".")
+		} else {
+			continue
+		}
+
+		// song.remix.lrc belongs to song.remix.mp3, not to song.mp3
+		if lang == "" || strings.Contains(lang, ".") || stems[base+"."+lang] {
+			continue
+		}
+
+		sidecars[lang] = filepath.Join(dir, fileName)
+	}
+
+	return sidecars, nil
+}
+
+// readSidecar reads the .lrc file, subtitle is nil if the file has no
+// timestamps and text contains the content of the file
+func readSidecar(path, langExt string) (subtitle *lyric.Lyric, text string, err error) {
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, "", tracerr.Wrap(err)
+	}
+	text = string(content)
+
+	var l lyric.Lyric
+	err = l.NewFromLRC(text)
+	if err != nil {
+		return nil, "", tracerr.Wrap(err)
+	}
+
+	if len(l.SyncedCaptions) == 0 {
+		return nil, text, nil
+	}
+
+	l.LangExt = langExt
+	return &l, text, nil
+}
+
+// loadSidecars adds the lyrics of the .lrc files of the song, the embedded
+// lyrics take precedence. Broken files are logged so that the song is still
+// played.
+func (p *PlayingBar) loadSidecars(songPath string) {
+
+	sidecars, err := sidecarFiles(songPath, defaultLyricLang())
+	if err != nil {
+		logError(err)
+		return
+	}
+
+	langs := make([]string, 0, len(sidecars))
+	for lang := range sidecars {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+
+outer:
+	for _, lang := range langs {
+		for _, subtitle := range p.subtitles {
+			if subtitle.LangExt == lang {
+				continue outer
+			}
+		}
+
+		subtitle, text, err := readSidecar(sidecars[lang], lang)
+		if err != nil {
+			logError(err)
+			continue
+		}
+
+		if subtitle != nil {
+			p.subtitles = append(p.subtitles, subtitle)
+		}
+
+		if p.unsynced == "" {
+			p.unsynced = text
+		}
+	}
+}
+
+// exportLyrics writes the embedded lyrics of the song to its .lrc files, it
+// returns the number of files written. Existing files which differ from the
+// lyric are skipped unless overwrite is set, their number is returned as well.
+func exportLyrics(songPath, preferred string, overwrite bool) (written, skipped int, err error) {
+
+	tag, err := id3v2.Open(songPath, id3v2.Options{Parse: true})
+	if err != nil {
+		return 0, 0, tracerr.Wrap(err)
+	}
+	defer tag.Close()
+
+	usltFrames := tag.GetFrames(tag.CommonID("Unsynchronised lyrics/text transcription"))
+	for _, f := range usltFrames {
+		uslf, ok := f.(id3v2.UnsynchronisedLyricsFrame)
+		if !ok {
+			return written, skipped, tracerr.New("USLT error")
+		}
+		if strings.TrimSpace(uslf.Lyrics) == "" {
+			continue
+		}
+
+		// the embedded lyrics are already in the lrc format
+		path := sidecarPath(songPath, uslf.ContentDescriptor, preferred)
+		if content, err := ioutil.ReadFile(path); err == nil && !overwrite {
+			if string(content) != uslf.Lyrics {
+				skipped++
+			}
+			continue
+		}
+
+		err = ioutil.WriteFile(path, []byte(uslf.Lyrics), 0644)
+		if err != nil {
+			return written, skipped, tracerr.Wrap(err)
+		}
+		written++
+	}
+
+	return written, skipped, nil
+}
+
+// exportSidecars exports the embedded lyrics of the songs in a background job,
+// the user is asked whether the existing .lrc files which differ from the
+// lyrics are overwritten
+func exportSidecars(audioFiles []*player.AudioFile, overwrite bool) {
+	transferLyrics(" Export lyrics ", audioFiles,
+		func(songPath, preferred string) (int, int, error) {
+			return exportLyrics(songPath, preferred, overwrite)
+		},
+		func(skipped []*player.AudioFile) {
+			exportSidecars(skipped, true)
+		})
+}
+
+// importSidecars embeds the .lrc files of the songs in a background job
+func importSidecars(audioFiles []*player.AudioFile) {
+	transferLyrics(" Import lyrics ", audioFiles,
+		func(songPath, preferred string) (int, int, error) {
+			count, err := importLyrics(songPath, preferred)
+			return count, 0, err
+		}, nil)
+}
+
+// importLyrics embeds the synced lyrics of the .lrc files of the song, files
+// without timestamps are skipped. It returns the number of lyrics embedded.
+func importLyrics(songPath, preferred string) (int, error) {
+
+	sidecars, err := sidecarFiles(songPath, preferred)
+	if err != nil {
+		return 0, tracerr.Wrap(err)
+	}
+
+	embedded := 0
+	for lang, path := range sidecars {
+		subtitle, _, err := readSidecar(path, lang)
+		if err != nil {
+			return embedded, tracerr.Wrap(err)
+		}
+		if subtitle == nil {
+			continue
+		}
+
+		err = embedLyric(songPath, subtitle, false)
+		if err != nil {
+			return embedded, tracerr.Wrap(err)
+		}
+		embedded++
+	}
+
+	return embedded, nil
+}
+
+// transferLyrics runs transfer on every song in a background job and shows the
+// number of lyrics transferred, failures are logged. transfer is passed the
+// path of the song and the preferred language of the lyrics, it returns the
+// number of lyrics transferred and skipped. The user is asked whether the
+// songs whose lyrics were skipped are passed to overwrite.
+func transferLyrics(
+	title string, audioFiles []*player.AudioFile,
+	transfer func(string, string) (int, int, error),
+	overwrite func([]*player.AudioFile),
+) {
+
+	preferred := defaultLyricLang()
+
+	name := fmt.Sprintf("%s of %d songs", strings.TrimSpace(title), len(audioFiles))
+	gomu.jobs.submit("lyric", name, func(ctx context.Context, j *Job) error {
+		var lyrics, songs, failed, skipped int
+		var skippedSongs []*player.AudioFile
+		for i, audioFile := range audioFiles {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			j.setProgress(i, len(audioFiles))
+			count, skips, err := transfer(audioFile.Path(), preferred)
+			if err != nil {
+				logError(err)
+				failed++
+			}
+			if skips > 0 {
+				skipped += skips
+				skippedSongs = append(skippedSongs, audioFile)
+			}
+			if count > 0 {
+				songs++
+			}
+			lyrics += count
+		}
+
+		msg := fmt.Sprintf("%d lyrics of %d songs", lyrics, songs)
+		if failed > 0 {
+			msg += fmt.Sprintf("\n%d songs failed, see the log", failed)
+		}
+
+		gomu.app.QueueUpdateDraw(func() {
+			if skipped == 0 || overwrite == nil {
+				defaultTimedPopup(title, msg)
+				return
+			}
+			msg += fmt.Sprintf("\n%d lyric files already exist, overwrite them?", skipped)
+			confirmationPopup(msg, func(_ int, label string) {
+				if label == "yes" {
+					overwrite(skippedSongs)
+				}
+			})
+		})
+
+		return nil
+	})
+}
+
+// removeSidecars deletes the .lrc files of the song
+func removeSidecars(songPath, preferred string) error {
+
+	sidecars, err := sidecarFiles(songPath, preferred)
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+
+	for _, path := range sidecars {
+		err = os.Remove(path)
+		if err != nil {
+			return tracerr.Wrap(err)
+		}
+	}
+
+	return nil
+}
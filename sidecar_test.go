@@ -0,0 +1,154 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tramhao/id3v2"
+)
+
+// sidecarDir creates a directory containing the files, it is removed by the
+// returned function
+func sidecarDir(t *testing.T, files map[string]string) (string, func()) {
+
+	dir, err := ioutil.TempDir("", "gomu-sidecar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestSidecarPath(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+
+	assert.Equal(t, "en", defaultLyricLang())
+	assert.Equal(t, "/music/song.lrc", sidecarPath("/music/song.mp3", "en", "en"))
+	assert.Equal(t, "/music/song.lrc", sidecarPath("/music/song.mp3", "", "en"))
+	assert.Equal(t, "/music/song.zh-CN.lrc", sidecarPath("/music/song.mp3", "zh-CN", "en"))
+	assert.Equal(t, "/music/song.lrc", sidecarPath("/music/song.mp3", "zh-CN", "zh-CN"))
+	assert.Equal(t, "/music/song.en.lrc", sidecarPath("/music/song.mp3", "en", "zh-CN"))
+}
+
+func TestSidecarFiles(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+
+	dir, remove := sidecarDir(t, map[string]string{
+		"song.mp3":       "",
+		"song.lrc":       "",
+		"song.ko.lrc":    "",
+		"song.remix.mp3": "",
+		"song.remix.lrc": "",
+		"other.lrc":      "",
+	})
+	defer remove()
+
+	sidecars, err := sidecarFiles(filepath.Join(dir, "song.mp3"), "en")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"en": filepath.Join(dir, "song.lrc"),
+		"ko": filepath.Join(dir, "song.ko.lrc"),
+	}, sidecars)
+}
+
+func TestLoadSidecars(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+
+	dir, remove := sidecarDir(t, map[string]string{
+		"song.mp3":    "",
+		"song.lrc":    "[00:01.00]hello\n[00:05.00]world\n",
+		"song.ko.lrc": "plain text",
+	})
+	defer remove()
+
+	p := gomu.playingBar
+	err := p.loadLyrics(filepath.Join(dir, "song.mp3"))
+	assert.NoError(t, err)
+
+	assert.Len(t, p.subtitles, 1)
+	assert.Equal(t, "en", p.subtitles[0].LangExt)
+	assert.Equal(t, uint32(5000), p.subtitles[0].SyncedCaptions[1].Timestamp)
+
+	// the first sidecar is used as unsynced lyric
+	assert.Equal(t, "[00:01.00]hello\n[00:05.00]world\n", p.unsynced)
+}
+
+func TestExportImportLyrics(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+
+	dir, remove := sidecarDir(t, map[string]string{
+		"song.mp3":    "",
+		"song.ko.lrc": "[00:02.00]annyeong\n",
+		"song.lrc":    "no timestamps",
+	})
+	defer remove()
+
+	songPath := filepath.Join(dir, "song.mp3")
+
+	// plain text sidecars are not embedded
+	count, err := importLyrics(songPath, "en")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	tag, err := id3v2.Open(songPath, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := tag.GetFrames(tag.CommonID("Synchronised lyrics/text"))
+	tag.Close()
+	assert.Len(t, frames, 1)
+	assert.Equal(t, "ko", frames[0].(id3v2.SynchronisedLyricsFrame).ContentDescriptor)
+
+	assert.NoError(t, removeSidecars(songPath, "en"))
+
+	count, skipped, err := exportLyrics(songPath, "en", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, 0, skipped)
+
+	lrcPath := filepath.Join(dir, "song.ko.lrc")
+	lrc, err := ioutil.ReadFile(lrcPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "[00:02.000]annyeong\n", string(lrc))
+
+	// the same lyric is not written again and edited files are kept
+	count, skipped, err = exportLyrics(songPath, "en", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+	assert.Equal(t, 0, skipped)
+
+	err = ioutil.WriteFile(lrcPath, []byte("[00:03.00]edited\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, skipped, err = exportLyrics(songPath, "en", false)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+	assert.Equal(t, 1, skipped)
+	lrc, _ = ioutil.ReadFile(lrcPath)
+	assert.Equal(t, "[00:03.00]edited\n", string(lrc))
+
+	count, skipped, err = exportLyrics(songPath, "en", true)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, 0, skipped)
+	lrc, _ = ioutil.ReadFile(lrcPath)
+	assert.Equal(t, "[00:02.000]annyeong\n", string(lrc))
+
+	_, err = os.Stat(filepath.Join(dir, "song.lrc"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -12,6 +12,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 
 	"github.com/gdamore/tcell/v2"
@@ -73,6 +74,10 @@ func defineBuiltins() {
 	gomu.anko.DefineGlobal("show_popup", defaultTimedPopup)
 	gomu.anko.DefineGlobal("search_popup", searchPopup)
 	gomu.anko.DefineGlobal("shell", shell)
+	gomu.anko.DefineGlobal("run_command", func(line string) error {
+		return gomu.command.execute(line)
+	})
+	gomu.anko.DefineGlobal("submit_job", submitScriptJob)
 }
 
 func defineInternals() {
@@ -198,6 +203,11 @@ module Keybinds {
 	global = {}
 	playlist = {}
 	queue = {}
+	lyrics = {}
+	# user-defined modes, each mode is a table of keybindings
+	modes = {}
+	# current mode, empty string means no mode is active
+	mode = ""
 
 	func def_g(kb, f) {
 		global[kb] = f
@@ -210,6 +220,21 @@ module Keybinds {
 	func def_q(kb, f) {
 		queue[kb] = f
 	}
+
+	func def_l(kb, f) {
+		lyrics[kb] = f
+	}
+
+	func def_m(name, kb, f) {
+		if modes[name] == nil {
+			modes[name] = {}
+		}
+		modes[name][kb] = f
+	}
+
+	func set_mode(name) {
+		mode = name
+	}
 }
 `
 	_, err := env.Execute(eventModule + listModule + keybindModule)
@@ -233,11 +258,30 @@ module General {
 	queue_loop          = false
 	load_prev_queue     = true
 	popup_timeout       = "5s"
+	# time to wait for the next key of a multi-key binding such as "gg"
+	keybind_timeout     = "1s"
 	sort_by_mtime       = false
 	# change this to directory that contains mp3 files
 	music_dir           = "~/Music"
-	# url history of downloaded audio will be saved here
+	# history of the downloads, one json object per download. The videos in
+	# it are skipped when downloading a playlist
 	history_path        = "~/.local/share/gomu/urls"
+	# program downloading the audio: youtube-dl, yt-dlp or the path of a
+	# program accepting the same arguments, auto uses yt-dlp if installed
+	downloader          = "auto"
+	# arguments added to the ones of gomu, e.g. ["--cookies", "cookies.txt"]
+	downloader_args     = []
+	# format and quality of the downloaded audio, the quality goes from 0
+	# (best) to 9 (worst) or is a bitrate such as "128K"
+	audio_format        = "mp3"
+	audio_quality       = "5"
+	# name of the downloaded files in the playlist, see the output template
+	# of youtube-dl
+	output_template     = "%(title)s.%(ext)s"
+	# deleted files are moved here so that they can be restored with undo
+	trash_dir           = "~/.local/share/gomu/trash"
+	# days the deleted files are kept in the trash, 0 keeps them forever
+	trash_days          = 30
 	# some of the terminal supports unicode character
 	# you can set this to true to enable emojis
 	use_emoji           = true
@@ -251,9 +295,97 @@ module General {
 	# will be displayed.
 	# Available tags: en,el,ko,es,th,vi,zh-Hans,zh-Hant,zh-CN and can be separated with comma.
 	# find more tags: youtube-dl --skip-download --list-subs "url"
+	# The provider fetching the lyrics of a language can be chosen after a
+	# colon, e.g. "en:lrclib,zh-CN:sunyj". Providers: rentanadviser (en, the
+	# default), lrclib (en) and sunyj (zh-CN)
 	lang_lyric          = "en"
-	# When save tag, could rename the file by tag info: artist-songname-album
+	# base urls of the lyric providers replacing the default ones, e.g.
+	# {"sunyj": "http://localhost:8080"}
+	lyric_urls          = {}
+	# When save tag, rename the file with rename_template
 	rename_bytag        = false
+	# template used to rename files from their tags, templates containing a
+	# slash move files relative to the music directory,
+	# e.g. "{albumartist}/{album}/{track:02} - {title}"
+	rename_template     = "{artist}-{title}"
+	# what to do when the renamed file already exists: skip, suffix or
+	# overwrite (the existing file is moved to the trash)
+	rename_conflict     = "skip"
+	# format of audio files in the playlist, the file name is used for files
+	# without tags. Fields: {name} {artist} {title} {album} {albumartist}
+	# {track} {disc} {year} {genre}, numbers can be padded e.g. {track:02}
+	display_format      = "{name}"
+	# how album covers are drawn: auto, kitty, sixel, ueberzug, halfblock or
+	# none. auto picks the graphics supported by the terminal, halfblock works
+	# in any terminal including over ssh
+	cover_renderer      = "auto"
+	# draw the waveform of the song as progress bar, the waveform is computed
+	# in the background the first time a song is played
+	waveform            = true
+	# click to select and double click to play in the playlist and the queue,
+	# scroll on the playing bar to change the volume and click on the
+	# progress bar to seek
+	mouse               = true
+	# show the visualizer below the playing bar, it can be toggled with
+	# toggle_visualizer
+	visualizer          = false
+	# bars for the spectrum or wave for the waveform
+	visualizer_style    = "bars"
+	# number of times the visualizer is drawn per second
+	visualizer_fps      = 20
+	# show the lyrics panel next to the queue, it can be toggled with
+	# toggle_lyrics
+	lyrics              = false
+	# show the translation of the lyric under it when it is embedded, another
+	# lyric can be chosen with dual_lyric
+	dual_lyric          = false
+	# keep the .lrc files downloaded with the audio next to the song, they
+	# are read as sidecar lyrics when the lyric is not embedded
+	keep_lrc            = true
+	# number of background jobs of a kind run at the same time, the other
+	# ones wait in the jobs popup. Kinds: download, playlist, lyric, tag and
+	# script
+	job_limit           = 2
+	job_limits          = {"download": 2}
+	# theme applied over the Color module, bundled themes: default, nord,
+	# gruvbox, dracula and solarized. More themes can be added to
+	# ~/.config/gomu/themes, they can be previewed with theme_select
+	theme               = ""
+}
+
+module Layout {
+	# layout used when gomu starts, layouts are cycled with cycle_layout.
+	# presets: default, stacked and compact
+	startup      = "default"
+	# layout used while the terminal is narrower than narrow_width columns
+	narrow       = "stacked"
+	narrow_width = 80
+
+	# layouts declared with def, groups of panels are horizontal or
+	# vertical, items have a ratio or a fixed size. Panels: playlist, queue,
+	# playing_bar, visualizer and lyrics. Example:
+	#
+	# Layout.def("wide", {
+	#     "orientation": "horizontal",
+	#     "items": [
+	#         {"panel": "playlist", "ratio": 1},
+	#         {"panel": "queue", "ratio": 1},
+	#         {"orientation": "vertical", "ratio": 1, "items": [
+	#             {"panel": "visualizer", "size": 20},
+	#             {"panel": "playing_bar", "size": 9}
+	#         ]}
+	#     ],
+	#     "hidden": ["visualizer"]
+	# })
+	layouts = {}
+	order   = []
+
+	func def(name, layout) {
+		if layouts[name] == nil {
+			order += name
+		}
+		layouts[name] = layout
+	}
 }
 
 module Emoji {
@@ -266,7 +398,8 @@ module Emoji {
 }
 
 module Color {
-	# you may choose colors by pressing 'c'
+	# you may choose colors by pressing 'c', hex colors e.g. "#88c0d0" can
+	# be used as well
 	accent            = "darkcyan"
 	background        = "none"
 	foreground        = "white"
@@ -279,6 +412,7 @@ module Color {
 
 	now_playing_title = "darkgreen"
 	subtitle          = "darkgoldenrod"
+	visualizer        = "darkcyan"
 }
 
 # you can get the syntax highlighting for this language here:
@@ -316,15 +450,28 @@ module Color {
 	return nil
 }
 
-// Sets the layout of the application
-func layout(gomu *Gomu) *tview.Flex {
-	flex := tview.NewFlex().
-		AddItem(gomu.playlist, 0, 1, false).
-		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
-			AddItem(gomu.queue, 0, 5, false).
-			AddItem(gomu.playingBar, 9, 0, false), 0, 2, false)
+// keybindTables returns the Keybinds tables used to resolve keys in order of
+// precedence: the current user-defined mode, global and the focused panel.
+func keybindTables() []string {
+
+	var tables []string
+
+	if mode := gomu.anko.GetString("Keybinds.mode"); mode != "" {
+		tables = append(tables, mode)
+	}
+
+	tables = append(tables, "global")
+
+	switch {
+	case gomu.playlist.HasFocus():
+		tables = append(tables, "playlist")
+	case gomu.queue.HasFocus():
+		tables = append(tables, "queue")
+	case gomu.lyrics.HasFocus():
+		tables = append(tables, "lyrics")
+	}
 
-	return flex
+	return tables
 }
 
 // Initialize
@@ -355,7 +502,11 @@ func start(application *tview.Application, args Args) {
 
 	gomu.hook.RunHooks("enter")
 	gomu.args = args
-	gomu.colors = newColor()
+
+	err = loadColors()
+	if err != nil {
+		logError(err)
+	}
 
 	// override default border
 	// change double line border to one line border when focused
@@ -370,6 +521,37 @@ func start(application *tview.Application, args Args) {
 	gomu.initPanels(application, args)
 	defineInternals()
 
+	// the files deleted long ago are removed from the trash
+	err = purgeTrash(trashDir(), trashMaxAge())
+	if err != nil {
+		logError(err)
+	}
+
+	gomu.jobs.limit = jobLimits()
+	// the progress of the jobs is shown in the title of the playlist, the
+	// changes made before the title is updated are shown at once. The update
+	// is queued from its own goroutine as jobs can be submitted from the UI
+	// goroutine which would block on a full queue.
+	var titlePending int32
+	gomu.jobs.changed = func() {
+		if !atomic.CompareAndSwapInt32(&titlePending, 0, 1) {
+			return
+		}
+		go gomu.app.QueueUpdateDraw(func() {
+			atomic.StoreInt32(&titlePending, 0)
+			gomu.playlist.updateTitle()
+		})
+	}
+	gomu.jobs.finished = func(j jobInfo) {
+		if j.state == jobFailed {
+			gomu.app.QueueUpdateDraw(func() {
+				errorPopup(j.err)
+			})
+		}
+	}
+
+	application.EnableMouse(gomu.anko.GetBool("General.mouse"))
+
 	gomu.player.SetSongStart(func(audio player.Audio) {
 
 		duration, err := getTagLength(audio.Path())
@@ -383,28 +565,31 @@ func start(application *tview.Application, args Args) {
 
 		audioFile := audio.(*player.AudioFile)
 
-		gomu.playingBar.newProgress(audioFile, int(duration.Seconds()))
-
-		name := audio.Name()
-		var description string
-
-		if len(gomu.playingBar.subtitles) == 0 {
-			description = name
-		} else {
-			lang := gomu.playingBar.subtitle.LangExt
+		// the song is started from the player goroutine, the playing bar is
+		// reset on the UI goroutine
+		gomu.app.QueueUpdateDraw(func() {
+			gomu.playingBar.newProgress(audioFile, int(duration.Seconds()))
 
-			description = fmt.Sprintf("%s \n\n %s lyric loaded", name, lang)
-		}
+			name := audio.Name()
+			var description string
 
-		defaultTimedPopup(" Now Playing ", description)
+			if len(gomu.playingBar.subtitles) == 0 {
+				description = name
+			} else {
+				lang := gomu.playingBar.subtitle.LangExt
 
-		go func() {
-			err := gomu.playingBar.run()
-			if err != nil {
-				logError(err)
+				description = fmt.Sprintf("%s \n\n %s lyric loaded", name, lang)
 			}
-		}()
 
+			defaultTimedPopup(" Now Playing ", description)
+
+			go func() {
+				err := gomu.playingBar.run()
+				if err != nil {
+					logError(err)
+				}
+			}()
+		})
 	})
 
 	gomu.player.SetSongFinish(func(currAudio player.Audio) {
@@ -413,6 +598,7 @@ func start(application *tview.Application, args Args) {
 		var mu sync.Mutex
 		mu.Lock()
 		gomu.playingBar.subtitle = nil
+		gomu.playingBar.secondary = nil
 		mu.Unlock()
 		if gomu.queue.isLoop {
 			_, err = gomu.queue.enqueue(currAudio.(*player.AudioFile))
@@ -431,8 +617,11 @@ func start(application *tview.Application, args Args) {
 		}
 	})
 
-	flex := layout(gomu)
-	gomu.pages.AddPage("main", flex, true, true)
+	err = gomu.layout.load()
+	if err != nil {
+		logError(err)
+	}
+	gomu.pages.AddPage("main", gomu.layout, true, true)
 
 	// sets the first focused panel
 	gomu.setFocusPanel(gomu.playlist)
@@ -440,6 +629,8 @@ func start(application *tview.Application, args Args) {
 
 	gomu.playingBar.setDefault()
 
+	go gomu.visualizer.run()
+
 	gomu.queue.isLoop = gomu.anko.GetBool("General.queue_loop")
 
 	loadQueue := gomu.anko.GetBool("General.load_prev_queue")
@@ -469,30 +660,46 @@ func start(application *tview.Application, args Args) {
 		}
 	}()
 
-	cmds := map[rune]string{
-		'q': "quit",
-		' ': "toggle_pause",
-		'+': "volume_up",
-		'=': "volume_up",
-		'-': "volume_down",
-		'_': "volume_down",
-		'n': "skip",
-		':': "command_search",
-		'?': "toggle_help",
-		'f': "forward",
-		'F': "forward_fast",
-		'b': "rewind",
-		'B': "rewind_fast",
-		'm': "repl",
-		'T': "switch_lyric",
-		'c': "show_colors",
+	cmds := map[string]string{
+		"q":      "quit",
+		" ":      "toggle_pause",
+		"+":      "volume_up",
+		"=":      "volume_up",
+		"-":      "volume_down",
+		"_":      "volume_down",
+		"n":      "skip",
+		":":      "command_line",
+		"?":      "toggle_help",
+		"f":      "forward",
+		"F":      "forward_fast",
+		"b":      "rewind",
+		"B":      "rewind_fast",
+		"m":      "repl",
+		"T":      "switch_lyric",
+		"c":      "show_colors",
+		"C":      "theme_select",
+		"u":      "undo",
+		"ctrl_r": "redo",
+		"ctrl_v": "toggle_visualizer",
+		"ctrl_w": "cycle_layout",
+		"ctrl_l": "toggle_lyrics",
+		"ctrl_t": "dual_lyric",
+		"J":      "jobs",
 	}
 
 	for key, cmdName := range cmds {
-		src := fmt.Sprintf(`Keybinds.def_g("%c", %s)`, key, cmdName)
+		src := fmt.Sprintf(`Keybinds.def_g("%s", %s)`, key, cmdName)
 		gomu.anko.Execute(src)
 	}
 
+	gomu.keys = gomu.anko.NewSequence(getKeybindTimeout(), func(f func() error) {
+		gomu.app.QueueUpdateDraw(func() {
+			if err := f(); err != nil {
+				errorPopup(err)
+			}
+		})
+	})
+
 	// global keybindings are handled here
 	application.SetInputCapture(func(e *tcell.EventKey) *tcell.EventKey {
 
@@ -517,16 +724,23 @@ func start(application *tview.Application, args Args) {
 			if strings.Contains(popupName, "confirmation-") {
 				return e
 			}
+			gomu.keys.Reset()
 			gomu.cyclePanels2()
 		}
 
-		if gomu.anko.KeybindExists("global", e) {
+		consumed, err := gomu.keys.Feed(e, keybindTables()...)
+		if err != nil {
+			errorPopup(err)
+		}
 
-			err := gomu.anko.ExecKeybind("global", e)
-			if err != nil {
-				errorPopup(err)
-			}
+		if consumed {
+			return nil
+		}
 
+		// leaves user-defined mode
+		mode := gomu.anko.GetString("Keybinds.mode")
+		if e.Key() == tcell.KeyEsc && mode != "" && gomu.popups.peekTop() == nil {
+			gomu.anko.Execute(`Keybinds.set_mode("")`)
 			return nil
 		}
 
@@ -3,10 +3,14 @@
 package main
 
 import (
+	"context"
 	"errors"
-	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
@@ -23,6 +27,7 @@ type lyricFlex struct {
 	FocusedItem tview.Primitive
 	inputs      []tview.Primitive
 	box         *tview.Box
+	cover       *coverView
 }
 
 // tagPopup is used to edit tag, delete and fetch lyrics
@@ -34,36 +39,55 @@ func tagPopup(node *player.AudioFile) (err error) {
 		return tracerr.Wrap(err)
 	}
 
+	fields, err := readTagFields(node.Path())
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+
 	var (
-		artistInputField  *tview.InputField = tview.NewInputField()
-		titleInputField   *tview.InputField = tview.NewInputField()
-		albumInputField   *tview.InputField = tview.NewInputField()
-		getTagButton      *tview.Button     = tview.NewButton("Get Tag")
-		saveTagButton     *tview.Button     = tview.NewButton("Save Tag")
-		lyricDropDown     *tview.DropDown   = tview.NewDropDown()
-		deleteLyricButton *tview.Button     = tview.NewButton("Delete Lyric")
-		getLyricDropDown  *tview.DropDown   = tview.NewDropDown()
-		getLyricButton    *tview.Button     = tview.NewButton("Fetch Lyric")
-		lyricTextView     *tview.TextView   = tview.NewTextView()
-		leftGrid          *tview.Grid       = tview.NewGrid()
-		rightFlex         *tview.Flex       = tview.NewFlex()
+		artistInputField   *tview.InputField = tview.NewInputField()
+		titleInputField    *tview.InputField = tview.NewInputField()
+		albumInputField    *tview.InputField = tview.NewInputField()
+		getTagButton       *tview.Button     = tview.NewButton("Get Tag")
+		saveTagButton      *tview.Button     = tview.NewButton("Save Tag")
+		lyricDropDown      *tview.DropDown   = tview.NewDropDown()
+		deleteLyricButton  *tview.Button     = tview.NewButton("Delete Lyric")
+		getLyricDropDown   *tview.DropDown   = tview.NewDropDown()
+		getLyricButton     *tview.Button     = tview.NewButton("Fetch Lyric")
+		lyricTextView      *tview.TextView   = tview.NewTextView()
+		leftGrid           *tview.Grid       = tview.NewGrid()
+		rightFlex          *tview.Flex       = tview.NewFlex()
+		cover              *coverView        = newCoverView(popupID)
+		replaceCoverButton *tview.Button     = tview.NewButton("Replace Cover")
+		extractCoverButton *tview.Button     = tview.NewButton("Extract Cover")
 	)
 
-	artistInputField.SetLabel("Artist: ").
+	artistInputField.SetLabelWidth(14).SetLabel("Artist: ").
 		SetFieldWidth(20).
 		SetText(tag.Artist()).
 		SetFieldBackgroundColor(gomu.colors.popup)
 
-	titleInputField.SetLabel("Title:  ").
+	titleInputField.SetLabelWidth(14).SetLabel("Title:  ").
 		SetFieldWidth(20).
 		SetText(tag.Title()).
 		SetFieldBackgroundColor(gomu.colors.popup)
 
-	albumInputField.SetLabel("Album:  ").
+	albumInputField.SetLabelWidth(14).SetLabel("Album:  ").
 		SetFieldWidth(20).
 		SetText(tag.Album()).
 		SetFieldBackgroundColor(gomu.colors.popup)
 
+	// inputs of the extended fields keyed as in format strings
+	extraInputFields := make(map[string]*tview.InputField)
+	for _, field := range tagEditorFields {
+		extraInputFields[field.key] = tview.NewInputField().
+			SetLabel(field.label).
+			SetLabelWidth(14).
+			SetFieldWidth(20).
+			SetText(fields[field.key]).
+			SetFieldBackgroundColor(gomu.colors.popup)
+	}
+
 	leftBox := tview.NewBox().
 		SetBorder(true).
 		SetTitle(node.Name()).
@@ -75,18 +99,23 @@ func tagPopup(node *player.AudioFile) (err error) {
 	getTagButton.SetSelectedFunc(func() {
 		var titles []string
 		audioFile := node
-		go func() {
-			var lyricFetcher lyric.LyricFetcherCn
-			results, err := lyricFetcher.LyricOptions(audioFile.Name())
+		name := "Tags of " + audioFile.Name()
+		// the config is read before the job starts
+		fetcher, err := lyricFetcher("zh-CN")
+		if err != nil {
+			errorPopup(err)
+			return
+		}
+		gomu.jobs.submit("tag", name, func(ctx context.Context, j *Job) error {
+			results, err := fetcher.LyricOptions(audioFile.Name())
 			if err != nil {
-				errorPopup(err)
-				return
+				return tracerr.Wrap(err)
 			}
 			for _, v := range results {
 				titles = append(titles, v.TitleForPopup)
 			}
 
-			go func() {
+			gomu.app.QueueUpdateDraw(func() {
 				searchPopup(" Song Tags ", titles, func(selected string) {
 					if selected == "" {
 						return
@@ -120,28 +149,19 @@ func tagPopup(node *player.AudioFile) (err error) {
 						return
 					}
 					if gomu.anko.GetBool("General.rename_bytag") {
-						newName := fmt.Sprintf("%s-%s", newTag.Artist, newTag.Title)
-						err = gomu.playlist.rename(newName)
-						if err != nil {
-							errorPopup(err)
-							return
-						}
-						gomu.playlist.refresh()
-						leftBox.SetTitle(newName)
-
-						// update queue
-						err = gomu.playlist.refreshAfterRename(node, newName)
+						node, err = renameFileByTags(node)
 						if err != nil {
 							errorPopup(err)
 							return
 						}
-						node = gomu.playlist.getCurrentFile()
+						leftBox.SetTitle(node.Name())
 					}
 					defaultTimedPopup(" Success ", "Tag update successfully")
 				})
-				gomu.app.Draw()
-			}()
-		}()
+			})
+
+			return nil
+		})
 	}).
 		SetBackgroundColorActivated(gomu.colors.popup).
 		SetLabelColorActivated(gomu.colors.accent).
@@ -150,6 +170,18 @@ func tagPopup(node *player.AudioFile) (err error) {
 		SetTitleColor(gomu.colors.accent)
 
 	saveTagButton.SetSelectedFunc(func() {
+		// the fields are checked before the tag is changed
+		values := make(map[string]string, len(tagEditorFields))
+		for _, field := range tagEditorFields {
+			value := strings.TrimSpace(extraInputFields[field.key].GetText())
+			err = validateTagField(field.key, value)
+			if err != nil {
+				errorPopup(err)
+				return
+			}
+			values[field.key] = value
+		}
+
 		tag, err = id3v2.Open(node.Path(), id3v2.Options{
 			Parse:       true,
 			ParseFrames: []string{},
@@ -165,28 +197,31 @@ func tagPopup(node *player.AudioFile) (err error) {
 		tag.SetArtist(newArtist)
 		tag.SetTitle(newTitle)
 		tag.SetAlbum(newAlbum)
+
+		// the fields left unchanged are not rewritten
+		for _, field := range tagEditorFields {
+			if values[field.key] != fields[field.key] {
+				setTagField(tag, field.key, values[field.key])
+			}
+		}
+
 		err = tag.Save()
 		if err != nil {
 			errorPopup(err)
 			return
 		}
+		for key, value := range values {
+			fields[key] = value
+		}
 		if gomu.anko.GetBool("General.rename_bytag") {
-			newName := fmt.Sprintf("%s-%s", newArtist, newTitle)
-			err = gomu.playlist.rename(newName)
-			if err != nil {
-				errorPopup(err)
-				return
-			}
-			gomu.playlist.refresh()
-			leftBox.SetTitle(newName)
-
-			// update queue
-			err = gomu.playlist.refreshAfterRename(node, newName)
+			// the tags must be written before the file is renamed
+			tag.Close()
+			node, err = renameFileByTags(node)
 			if err != nil {
 				errorPopup(err)
 				return
 			}
-			node = gomu.playlist.getCurrentFile()
+			leftBox.SetTitle(node.Name())
 		}
 
 		defaultTimedPopup(" Success ", "Tag update successfully")
@@ -262,7 +297,8 @@ func tagPopup(node *player.AudioFile) (err error) {
 		SetBackgroundColor(gomu.colors.popup).
 		SetTitleColor(gomu.colors.accent)
 
-	getLyricDropDownOptions := []string{"en", "zh-CN"}
+	// the preferred language is the first option
+	getLyricDropDownOptions := lyricLangs()
 	getLyricDropDown.SetOptions(getLyricDropDownOptions, nil).
 		SetCurrentOption(0).
 		SetFieldBackgroundColor(gomu.colors.popup).
@@ -271,11 +307,6 @@ func tagPopup(node *player.AudioFile) (err error) {
 		SetLabel("Fetch Lyrics: ").
 		SetBackgroundColor(gomu.colors.popup)
 
-	langLyricFromConfig := gomu.anko.GetString("General.lang_lyric")
-	if strings.Contains(langLyricFromConfig, "zh-CN") {
-		getLyricDropDown.SetCurrentOption(1)
-	}
-
 	getLyricButton.SetSelectedFunc(func() {
 
 		audioFile := gomu.playlist.getCurrentFile()
@@ -286,12 +317,18 @@ func tagPopup(node *player.AudioFile) (err error) {
 			return
 		}
 
+		fetcher, err := lyricFetcher(lang)
+		if err != nil {
+			errorPopup(err)
+			return
+		}
+
 		var wg sync.WaitGroup
 
 		wg.Add(1)
 
 		go func() {
-			err := lyricPopup(lang, audioFile, &wg)
+			err := lyricPopup(lang, fetcher, audioFile, &wg)
 			if err != nil {
 				errorPopup(err)
 				return
@@ -362,20 +399,100 @@ func tagPopup(node *player.AudioFile) (err error) {
 		})
 	})
 
-	leftGrid.SetRows(3, 1, 2, 2, 2, 3, 0, 3, 3, 1, 3, 3).
+	leftGrid.SetRows(3, 1, 2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 0, 3, 3, 1, 3, 3).
 		SetColumns(30).
 		AddItem(getTagButton, 0, 0, 1, 3, 1, 10, true).
 		AddItem(artistInputField, 2, 0, 1, 3, 1, 10, true).
 		AddItem(titleInputField, 3, 0, 1, 3, 1, 10, true).
-		AddItem(albumInputField, 4, 0, 1, 3, 1, 10, true).
-		AddItem(saveTagButton, 5, 0, 1, 3, 1, 10, true).
-		AddItem(getLyricDropDown, 7, 0, 1, 3, 1, 20, true).
-		AddItem(getLyricButton, 8, 0, 1, 3, 1, 10, true).
-		AddItem(lyricDropDown, 10, 0, 1, 3, 1, 10, true).
-		AddItem(deleteLyricButton, 11, 0, 1, 3, 1, 10, true)
+		AddItem(albumInputField, 4, 0, 1, 3, 1, 10, true)
+
+	for i, field := range tagEditorFields {
+		leftGrid.AddItem(extraInputFields[field.key], 5+i, 0, 1, 3, 1, 10, true)
+	}
+
+	leftGrid.
+		AddItem(saveTagButton, 11, 0, 1, 3, 1, 10, true).
+		AddItem(getLyricDropDown, 13, 0, 1, 3, 1, 20, true).
+		AddItem(getLyricButton, 14, 0, 1, 3, 1, 10, true).
+		AddItem(lyricDropDown, 16, 0, 1, 3, 1, 10, true).
+		AddItem(deleteLyricButton, 17, 0, 1, 3, 1, 10, true)
+
+	err = cover.load(node.Path())
+	if err != nil {
+		logError(err)
+	}
+	cover.SetBackgroundColor(gomu.colors.popup)
+
+	replaceCoverButton.SetSelectedFunc(func() {
+		coverPopupID := "cover-input-popup"
+		input := newInputPopup(coverPopupID, " Replace Cover ", "Image: ",
+			filepath.Dir(node.Path())+"/")
+		input.SetAcceptanceFunc(nil)
+		input.SetDoneFunc(func(key tcell.Key) {
+			gomu.pages.RemovePage(coverPopupID)
+			gomu.popups.pop()
 
-	rightFlex.SetDirection(tview.FlexColumn).
-		AddItem(lyricTextView, 0, 1, true)
+			if key != tcell.KeyEnter {
+				return
+			}
+
+			err := embedCover(node.Path(), expandTilde(input.GetText()))
+			if err != nil {
+				errorPopup(err)
+				return
+			}
+
+			err = cover.load(node.Path())
+			if err != nil {
+				errorPopup(err)
+				return
+			}
+			defaultTimedPopup(" Success ", "Cover replaced successfully")
+		})
+	}).
+		SetBackgroundColorActivated(gomu.colors.popup).
+		SetLabelColorActivated(gomu.colors.accent).
+		SetBorder(true).
+		SetBackgroundColor(gomu.colors.popup).
+		SetTitleColor(gomu.colors.accent)
+
+	extractCoverButton.SetSelectedFunc(func() {
+		extract := func() {
+			path, err := extractCover(node.Path())
+			if err != nil {
+				errorPopup(err)
+				return
+			}
+			defaultTimedPopup(" Success ", "Cover saved to\n"+path)
+		}
+
+		dest := filepath.Join(filepath.Dir(node.Path()), "cover.jpg")
+		if _, err := os.Stat(dest); err != nil || cover.source == "cover.jpg" {
+			extract()
+			return
+		}
+
+		confirmationPopup("cover.jpg already exists, overwrite it?",
+			func(_ int, label string) {
+				if label == "yes" {
+					extract()
+				}
+			})
+	}).
+		SetBackgroundColorActivated(gomu.colors.popup).
+		SetLabelColorActivated(gomu.colors.accent).
+		SetBorder(true).
+		SetBackgroundColor(gomu.colors.popup).
+		SetTitleColor(gomu.colors.accent)
+
+	coverButtons := tview.NewFlex().SetDirection(tview.FlexColumn).
+		AddItem(replaceCoverButton, 0, 1, false).
+		AddItem(extractCoverButton, 0, 1, false)
+
+	rightFlex.SetDirection(tview.FlexRow).
+		AddItem(cover, 0, 2, false).
+		AddItem(coverButtons, 3, 0, false).
+		AddItem(lyricTextView, 0, 3, true)
 
 	lyricFlex := &lyricFlex{
 		tview.NewFlex().SetDirection(tview.FlexColumn).
@@ -384,28 +501,36 @@ func tagPopup(node *player.AudioFile) (err error) {
 		nil,
 		nil,
 		leftBox,
+		cover,
 	}
 
 	leftGrid.Box = lyricFlex.box
 
-	lyricFlex.inputs = []tview.Primitive{
-		getTagButton,
+	textInputs := []*tview.InputField{
 		artistInputField,
 		titleInputField,
 		albumInputField,
+	}
+	for _, field := range tagEditorFields {
+		textInputs = append(textInputs, extraInputFields[field.key])
+	}
+
+	lyricFlex.inputs = []tview.Primitive{getTagButton}
+	for _, input := range textInputs {
+		lyricFlex.inputs = append(lyricFlex.inputs, input)
+	}
+	lyricFlex.inputs = append(lyricFlex.inputs,
 		saveTagButton,
 		getLyricDropDown,
 		getLyricButton,
 		lyricDropDown,
 		deleteLyricButton,
+		replaceCoverButton,
+		extractCoverButton,
 		lyricTextView,
-	}
-
-	if gomu.playingBar.albumPhoto != nil {
-		gomu.playingBar.albumPhoto.Clear()
-	}
+	)
 
-	gomu.pages.AddPage(popupID, center(lyricFlex, 90, 30), true, true)
+	gomu.pages.AddPage(popupID, center(lyricFlex, 90, 42), true, true)
 	gomu.popups.push(lyricFlex)
 
 	lyricFlex.SetInputCapture(func(e *tcell.EventKey) *tcell.EventKey {
@@ -413,6 +538,7 @@ func tagPopup(node *player.AudioFile) (err error) {
 		case tcell.KeyEnter:
 
 		case tcell.KeyEsc:
+			cover.clear()
 			gomu.pages.RemovePage(popupID)
 			gomu.popups.pop()
 		case tcell.KeyTab, tcell.KeyCtrlN, tcell.KeyCtrlJ:
@@ -427,9 +553,12 @@ func tagPopup(node *player.AudioFile) (err error) {
 
 		switch e.Rune() {
 		case 'q':
-			if artistInputField.HasFocus() || titleInputField.HasFocus() || albumInputField.HasFocus() {
-				return e
+			for _, input := range textInputs {
+				if input.HasFocus() {
+					return e
+				}
 			}
+			cover.clear()
 			gomu.pages.RemovePage(popupID)
 			gomu.popups.pop()
 		}
@@ -439,6 +568,103 @@ func tagPopup(node *player.AudioFile) (err error) {
 	return err
 }
 
+// tagEditorFields are the fields editable in the tag editor besides artist,
+// title and album, keyed as in format strings.
+var tagEditorFields = []struct {
+	key   string
+	label string
+}{
+	{"albumartist", "Album artist: "},
+	{"track", "Track: "},
+	{"disc", "Disc: "},
+	{"year", "Year: "},
+	{"genre", "Genre: "},
+	{"comment", "Comment: "},
+}
+
+var (
+	numberRegex = regexp.MustCompile(`^\d+(/\d+)?$`)
+	dateLayouts = []string{
+		"2006",
+		"2006-01",
+		"2006-01-02",
+		"2006-01-02T15",
+		"2006-01-02T15:04",
+		"2006-01-02T15:04:05",
+	}
+)
+
+// validateTagField checks the value of a field before saving, empty values
+// remove the field.
+func validateTagField(key, value string) error {
+
+	if value == "" {
+		return nil
+	}
+
+	switch key {
+	case "track", "disc":
+		if !numberRegex.MatchString(value) {
+			return tracerr.Errorf("invalid %s number: %s, use 3 or 3/12", key, value)
+		}
+
+	case "year":
+		for _, layout := range dateLayouts {
+			if len(layout) != len(value) {
+				continue
+			}
+			if _, err := time.Parse(layout, value); err == nil {
+				return nil
+			}
+		}
+		return tracerr.Errorf("invalid date: %s, use YYYY, YYYY-MM or YYYY-MM-DD", value)
+	}
+
+	return nil
+}
+
+// setTagField sets the frame of the field, the frame is removed if value is
+// empty.
+func setTagField(tag *id3v2.Tag, key, value string) {
+
+	if key == "comment" {
+		// only the comment without description is edited, the ones of other
+		// programs such as iTunNORM are kept
+		id := tag.CommonID("Comments")
+		frames := tag.GetFrames(id)
+		tag.DeleteFrames(id)
+
+		language := "eng"
+		for _, f := range frames {
+			if comment, ok := f.(id3v2.CommentFrame); ok && comment.Description == "" {
+				language = comment.Language
+				continue
+			}
+			tag.AddFrame(id, f)
+		}
+
+		if value != "" {
+			tag.AddCommentFrame(id3v2.CommentFrame{
+				Encoding: tag.DefaultEncoding(),
+				Language: language,
+				Text:     value,
+			})
+		}
+		return
+	}
+
+	// TYER of id3v2.3 only holds the year
+	if key == "year" && tag.Version() == 3 && len(value) > 4 {
+		value = value[:4]
+	}
+
+	id := tag.CommonID(tagKeys[key])
+	tag.DeleteFrames(id)
+	if value != "" {
+		tag.AddTextFrame(id, tag.DefaultEncoding(), value)
+	}
+}
+
 // This is a hack to cycle Focus in a flex
 func (f *lyricFlex) cycleFocus(app *tview.Application, reverse bool) {
 	for i, el := range f.inputs {
@@ -458,22 +684,56 @@ func (f *lyricFlex) cycleFocus(app *tview.Application, reverse bool) {
 
 		app.SetFocus(f.inputs[i])
 		f.FocusedItem = f.inputs[i]
-		// below code is setting the border highlight of left and right flex
-		if f.inputs[9].HasFocus() {
-			f.inputs[9].(*tview.TextView).SetBorderColor(gomu.colors.accent).
-				SetTitleColor(gomu.colors.accent)
-			f.box.SetBorderColor(gomu.colors.background).
-				SetTitleColor(gomu.colors.background)
-		} else {
-			f.inputs[9].(*tview.TextView).SetBorderColor(gomu.colors.background).
-				SetTitleColor(gomu.colors.background)
-			f.box.SetBorderColor(gomu.colors.accent).
-				SetTitleColor(gomu.colors.accent)
-		}
+		f.highlight()
 		return
 	}
 }
 
+// highlight sets the border highlight of left and right flex
+func (f *lyricFlex) highlight() {
+	// the lyric preview is the last input
+	lyricTextView := f.inputs[len(f.inputs)-1].(*tview.TextView)
+	if lyricTextView.HasFocus() {
+		lyricTextView.SetBorderColor(gomu.colors.accent).
+			SetTitleColor(gomu.colors.accent)
+		f.box.SetBorderColor(gomu.colors.background).
+			SetTitleColor(gomu.colors.background)
+	} else {
+		lyricTextView.SetBorderColor(gomu.colors.background).
+			SetTitleColor(gomu.colors.background)
+		f.box.SetBorderColor(gomu.colors.accent).
+			SetTitleColor(gomu.colors.accent)
+	}
+}
+
+// recolor sets the colors of the theme on the inputs of the tag editor
+func (f *lyricFlex) recolor() {
+
+	f.box.SetBackgroundColor(gomu.colors.popup)
+	f.cover.SetBackgroundColor(gomu.colors.popup)
+
+	for _, input := range f.inputs {
+		switch input := input.(type) {
+		case *tview.InputField:
+			input.SetFieldBackgroundColor(gomu.colors.popup).
+				SetBackgroundColor(gomu.colors.popup)
+		case *tview.TextView:
+			input.SetBackgroundColor(gomu.colors.popup)
+		case *tview.Button:
+			input.SetBackgroundColorActivated(gomu.colors.popup).
+				SetLabelColorActivated(gomu.colors.accent).
+				SetBackgroundColor(gomu.colors.popup)
+		case *tview.DropDown:
+			input.SetFieldBackgroundColor(gomu.colors.popup).
+				SetFieldTextColor(gomu.colors.accent).
+				SetPrefixTextColor(gomu.colors.accent).
+				SetBackgroundColor(gomu.colors.popup)
+		}
+	}
+
+	f.highlight()
+}
+
 // Focus is an override of Focus function in tview.flex.
 // This is to ensure that the focus of flex remain unchanged
 // when returning from popups or search lists
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tramhao/id3v2"
+	"github.com/ztrue/tracerr"
+)
+
+// tagKeys maps the names used in format strings to id3v2 frame descriptions
+var tagKeys = map[string]string{
+	"artist":      "Artist",
+	"title":       "Title",
+	"album":       "Album/Movie/Show title",
+	"albumartist": "Band/Orchestra/Accompaniment",
+	"track":       "Track number/Position in set",
+	"disc":        "Part of a set",
+	"year":        "Year",
+	"genre":       "Content type",
+}
+
+// placeholder matches {key} and {key:02} in format strings
+var placeholder = regexp.MustCompile(`{(\w+)(?::(0?\d+))?}`)
+
+// readTagFields reads the tags of the audio file keyed by the names used in
+// format strings. Only the frames of keys are parsed when keys are given.
+func readTagFields(path string, keys ...string) (map[string]string, error) {
+
+	opts := id3v2.Options{Parse: true}
+	wanted := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		switch {
+		case key == "comment":
+			opts.ParseFrames = append(opts.ParseFrames, "Comments")
+		case tagKeys[key] != "":
+			opts.ParseFrames = append(opts.ParseFrames, tagKeys[key])
+		default:
+			continue
+		}
+		wanted[key] = true
+	}
+
+	// none of the keys are tags, nothing has to be read
+	if len(keys) > 0 && len(wanted) == 0 {
+		return map[string]string{}, nil
+	}
+
+	tag, err := id3v2.Open(path, opts)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+	defer tag.Close()
+
+	fields := make(map[string]string, len(tagKeys)+1)
+	for key, desc := range tagKeys {
+		if len(wanted) == 0 || wanted[key] {
+			fields[key] = tag.GetTextFrame(tag.CommonID(desc)).Text
+		}
+	}
+
+	// the comment is the one without description, the other ones are
+	// written by other programs
+	for _, f := range tag.GetFrames(tag.CommonID("Comments")) {
+		if comment, ok := f.(id3v2.CommentFrame); ok && comment.Description == "" {
+			fields["comment"] = comment.Text
+			break
+		}
+	}
+
+	return fields, nil
+}
+
+// formatKeys returns the keys of the placeholders of format
+func formatKeys(format string) []string {
+
+	var keys []string
+	for _, groups := range placeholder.FindAllStringSubmatch(format, -1) {
+		keys = append(keys, groups[1])
+	}
+
+	return keys
+}
+
+// cachedName is a name formatted from the tags of a file
+type cachedName struct {
+	format  string
+	modTime time.Time
+	size    int64
+	name    string
+}
+
+// nameCache keeps the names formatted from the tags of the files keyed by
+// path so that the tags are not read each time the playlist is refreshed
+type nameCache struct {
+	mu    sync.Mutex
+	names map[string]cachedName
+}
+
+func newNameCache() *nameCache {
+	return &nameCache{names: make(map[string]cachedName)}
+}
+
+// get returns the name of the file formatted with format, formatName is
+// called when the file or the format has changed since it was cached
+func (c *nameCache) get(path, format string, formatName func() string) string {
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return formatName()
+	}
+
+	c.mu.Lock()
+	cached, ok := c.names[path]
+	c.mu.Unlock()
+
+	if ok && cached.format == format && cached.size == info.Size() &&
+		cached.modTime.Equal(info.ModTime()) {
+		return cached.name
+	}
+
+	cached = cachedName{
+		format:  format,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		name:    formatName(),
+	}
+
+	c.mu.Lock()
+	c.names[path] = cached
+	c.mu.Unlock()
+
+	return cached.name
+}
+
+// formatTags replaces the placeholders in format with the fields. Numbers can
+// be padded with zeros e.g. {track:02}, the total in "3/12" is dropped. It
+// also reports whether any placeholder other than {name} has a value.
+func formatTags(format string, fields map[string]string) (string, bool) {
+
+	var hasValue bool
+
+	result := placeholder.ReplaceAllStringFunc(format, func(match string) string {
+
+		groups := placeholder.FindStringSubmatch(match)
+		key, width := groups[1], groups[2]
+
+		value, ok := fields[key]
+		if !ok {
+			return match
+		}
+
+		if value != "" && key != "name" {
+			hasValue = true
+		}
+
+		if key == "track" || key == "disc" {
+			value = strings.SplitN(value, "/", 2)[0]
+		}
+
+		if width == "" {
+			return value
+		}
+
+		num, err := strconv.Atoi(value)
+		if err != nil {
+			return value
+		}
+
+		return fmt.Sprintf("%"+width+"d", num)
+	})
+
+	return result, hasValue
+}
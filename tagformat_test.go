@@ -0,0 +1,163 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tramhao/id3v2"
+)
+
+func TestFormatTags(t *testing.T) {
+
+	fields := map[string]string{
+		"name":   "01 one more time",
+		"artist": "Daft Punk",
+		"title":  "One More Time",
+		"track":  "1/14",
+		"album":  "",
+	}
+
+	text, ok := formatTags("{track:02}. {artist} - {title}", fields)
+	assert.True(t, ok)
+	assert.Equal(t, "01. Daft Punk - One More Time", text)
+
+	text, ok = formatTags("{album}{name}", fields)
+	assert.False(t, ok)
+	assert.Equal(t, "01 one more time", text)
+
+	// unknown placeholders are kept
+	text, _ = formatTags("{unknown} {track}", fields)
+	assert.Equal(t, "{unknown} 1", text)
+}
+
+func TestTagFields(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "gomu-tagformat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "song.mp3")
+	err = ioutil.WriteFile(path, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	normalization := id3v2.CommentFrame{
+		Encoding:    id3v2.EncodingUTF8,
+		Language:    "eng",
+		Description: "iTunNORM",
+		Text:        "000001F4",
+	}
+	tag.AddCommentFrame(normalization)
+
+	setTagField(tag, "track", "3/12")
+	setTagField(tag, "year", "2001-03-12")
+	setTagField(tag, "comment", "original")
+	setTagField(tag, "comment", "remastered")
+	setTagField(tag, "genre", "House")
+	setTagField(tag, "genre", "")
+	assert.NoError(t, tag.Save())
+	tag.Close()
+
+	fields, err := readTagFields(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "3/12", fields["track"])
+	assert.Equal(t, "2001-03-12", fields["year"])
+	assert.Equal(t, "remastered", fields["comment"])
+	assert.Equal(t, "", fields["genre"])
+
+	// the comments of other programs are kept
+	tag, err = id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, tag.GetFrames(tag.CommonID("Comments")), 2)
+	setTagField(tag, "comment", "")
+	frames := tag.GetFrames(tag.CommonID("Comments"))
+	if assert.Len(t, frames, 1) {
+		assert.Equal(t, normalization.Text, frames[0].(id3v2.CommentFrame).Text)
+	}
+	tag.Close()
+
+	// only the frames of the keys are read
+	fields, err = readTagFields(path, formatKeys("{track:02} {name}")...)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"track": "3/12"}, fields)
+}
+
+func TestNameCache(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "gomu-tagformat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "song.mp3")
+	err = ioutil.WriteFile(path, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls int
+	formatName := func(name string) func() string {
+		return func() string {
+			calls++
+			return name
+		}
+	}
+
+	cache := newNameCache()
+	assert.Equal(t, "one", cache.get(path, "{title}", formatName("one")))
+	assert.Equal(t, "one", cache.get(path, "{title}", formatName("two")))
+	assert.Equal(t, 1, calls)
+
+	// formatted again when the format changes
+	assert.Equal(t, "two", cache.get(path, "{artist}", formatName("two")))
+
+	// and when the file is modified
+	err = ioutil.WriteFile(path, []byte("ID3"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "three", cache.get(path, "{artist}", formatName("three")))
+	assert.Equal(t, 3, calls)
+}
+
+func TestValidateTagField(t *testing.T) {
+
+	valid := map[string][]string{
+		"track": {"", "3", "3/12"},
+		"disc":  {"1/2"},
+		"year":  {"2001", "2001-03", "2001-03-12", "2001-03-12T10:30"},
+		"genre": {"anything"},
+	}
+
+	invalid := map[string][]string{
+		"track": {"three", "3/", "-1"},
+		"disc":  {"1 of 2"},
+		"year":  {"01", "2001-13", "2001-02-30", "12/03/2001"},
+	}
+
+	for key, values := range valid {
+		for _, value := range values {
+			assert.NoError(t, validateTagField(key, value), value)
+		}
+	}
+
+	for key, values := range invalid {
+		for _, value := range values {
+			assert.Error(t, validateTagField(key, value), value)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rivo/tview"
+	"github.com/ztrue/tracerr"
+
+	"github.com/issadarkthing/gomu/player"
+)
+
+// themesDir contains the theme files. A theme file declares the Color module
+// and is named after the theme, the extension is ignored e.g. nord.anko.
+const themesDir = "~/.config/gomu/themes"
+
+// bundledThemes are available without theme files, a theme file with the same
+// name takes precedence
+var bundledThemes = map[string]string{
+	"default": `
+module Color {
+	accent             = "darkcyan"
+	background         = "none"
+	foreground         = "white"
+	popup              = "black"
+	playlist_directory = "darkcyan"
+	playlist_highlight = "darkcyan"
+	queue_highlight    = "darkcyan"
+	now_playing_title  = "darkgreen"
+	subtitle           = "darkgoldenrod"
+	visualizer         = "darkcyan"
+}`,
+	"nord": `
+module Color {
+	accent             = "#88c0d0"
+	background         = "#2e3440"
+	foreground         = "#d8dee9"
+	popup              = "#3b4252"
+	playlist_directory = "#81a1c1"
+	playlist_highlight = "#5e81ac"
+	queue_highlight    = "#5e81ac"
+	now_playing_title  = "#a3be8c"
+	subtitle           = "#ebcb8b"
+	visualizer         = "#88c0d0"
+}`,
+	"gruvbox": `
+module Color {
+	accent             = "#fe8019"
+	background         = "#282828"
+	foreground         = "#ebdbb2"
+	popup              = "#3c3836"
+	playlist_directory = "#83a598"
+	playlist_highlight = "#d79921"
+	queue_highlight    = "#d79921"
+	now_playing_title  = "#b8bb26"
+	subtitle           = "#fabd2f"
+	visualizer         = "#8ec07c"
+}`,
+	"dracula": `
+module Color {
+	accent             = "#bd93f9"
+	background         = "#282a36"
+	foreground         = "#f8f8f2"
+	popup              = "#44475a"
+	playlist_directory = "#8be9fd"
+	playlist_highlight = "#6272a4"
+	queue_highlight    = "#6272a4"
+	now_playing_title  = "#50fa7b"
+	subtitle           = "#f1fa8c"
+	visualizer         = "#ff79c6"
+}`,
+	"solarized": `
+module Color {
+	accent             = "#268bd2"
+	background         = "#002b36"
+	foreground         = "#93a1a1"
+	popup              = "#073642"
+	playlist_directory = "#2aa198"
+	playlist_highlight = "#586e75"
+	queue_highlight    = "#586e75"
+	now_playing_title  = "#859900"
+	subtitle           = "#b58900"
+	visualizer         = "#6c71c4"
+}`,
+}
+
+// themeFiles returns the path of each theme file in dir by theme name, a
+// missing directory has no themes
+func themeFiles(dir string) (map[string]string, error) {
+
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+
+	themes := make(map[string]string, len(files))
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		name := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))
+		themes[name] = filepath.Join(dir, file.Name())
+	}
+
+	return themes, nil
+}
+
+// themeNames returns the sorted names of the bundled themes and of the theme
+// files in dir
+func themeNames(dir string) ([]string, error) {
+
+	files, err := themeFiles(dir)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+
+	var names []string
+	for name := range bundledThemes {
+		names = append(names, name)
+	}
+	for name := range files {
+		if _, ok := bundledThemes[name]; !ok {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// readTheme returns the source of the theme, looking for a theme file in dir
+// before the bundled themes
+func readTheme(dir, name string) (string, error) {
+
+	files, err := themeFiles(dir)
+	if err != nil {
+		return "", tracerr.Wrap(err)
+	}
+
+	if path, ok := files[name]; ok {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", tracerr.Wrap(err)
+		}
+		return string(content), nil
+	}
+
+	if src, ok := bundledThemes[name]; ok {
+		return src, nil
+	}
+
+	return "", tracerr.Errorf("unknown theme: %s", name)
+}
+
+// executeTheme replaces the Color module with the one of the theme
+func executeTheme(name string) error {
+
+	src, err := readTheme(expandTilde(themesDir), name)
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+
+	_, err = gomu.anko.Execute(src)
+	if err != nil {
+		return tracerr.Errorf("theme %s: %v", name, err)
+	}
+
+	return nil
+}
+
+// loadColors builds the colors from the Color module, the theme in
+// General.theme replaces the module first
+func loadColors() error {
+
+	var err error
+	if theme := gomu.anko.GetString("General.theme"); theme != "" {
+		err = executeTheme(theme)
+	}
+
+	gomu.colors = newColor()
+	return err
+}
+
+// setTheme switches to the theme and recolors the panels
+func setTheme(name string) error {
+
+	err := executeTheme(name)
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+
+	gomu.colors = newColor()
+	applyColors()
+
+	return nil
+}
+
+// recolorer is implemented by the popups which are recolored while they are
+// open
+type recolorer interface {
+	recolor()
+}
+
+// applyColors recolors the panels and the open popups with gomu.colors, popups
+// opened afterwards use the new colors as well
+func applyColors() {
+
+	tview.Styles.PrimitiveBackgroundColor = gomu.colors.popup
+
+	gomu.playlist.recolor()
+	gomu.queue.recolor()
+	gomu.playingBar.recolor()
+	gomu.visualizer.SetBackgroundColor(gomu.colors.background)
+	gomu.lyrics.SetBackgroundColor(gomu.colors.background)
+
+	for _, panel := range gomu.panels {
+		color := gomu.colors.foreground
+		if panel == gomu.prevPanel {
+			color = gomu.colors.accent
+		}
+		panel.SetBorderColor(color)
+		panel.SetTitleColor(color)
+	}
+
+	for _, popup := range gomu.popups.popups {
+		if popup, ok := popup.(recolorer); ok {
+			popup.recolor()
+		}
+	}
+
+	// the groups of the layout are created again with the new background
+	if gomu.layout != nil {
+		gomu.layout.shown = ""
+	}
+}
+
+// recolor sets the colors of every node, including the ones of closed
+// directories
+func (p *Playlist) recolor() {
+
+	p.SetBackgroundColor(gomu.colors.background)
+
+	p.GetRoot().Walk(func(node, _ *tview.TreeNode) bool {
+		switch {
+		case node == p.prevNode:
+			node.SetColor(gomu.colors.playlistHi)
+		case node.GetReference().(*player.AudioFile).IsAudioFile():
+			node.SetColor(gomu.colors.foreground)
+		default:
+			node.SetColor(gomu.colors.playlistDir)
+		}
+		return true
+	})
+}
+
+func (q *Queue) recolor() {
+	q.SetSelectedBackgroundColor(gomu.colors.queueHi).
+		SetSelectedTextColor(gomu.colors.foreground).
+		SetBackgroundColor(gomu.colors.background)
+}
+
+func (p *PlayingBar) recolor() {
+	p.text.SetBackgroundColor(gomu.colors.background)
+	p.SetBackgroundColor(gomu.colors.background)
+	p.setSongTitle(p.songTitle)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/issadarkthing/gomu/player"
+)
+
+func TestParseColor(t *testing.T) {
+
+	color, ok := parseColor("#88c0d0")
+	assert.True(t, ok)
+	assert.Equal(t, tcell.NewHexColor(0x88c0d0), color)
+
+	color, ok = parseColor("darkcyan")
+	assert.True(t, ok)
+	assert.Equal(t, tcell.ColorDarkCyan, color)
+
+	for _, invalid := range []string{"#88c0d", "notacolor", ""} {
+		_, ok = parseColor(invalid)
+		assert.False(t, ok, invalid)
+	}
+}
+
+func TestNewColorHex(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+
+	_, err := gomu.anko.Execute(`
+Color.accent = "#bd93f9"
+Color.subtitle = "#f1fa8c"
+Color.popup = "notacolor"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	colors := newColor()
+	assert.Equal(t, tcell.NewHexColor(0xbd93f9), colors.accent)
+	assert.Equal(t, "#f1fa8c", colors.subtitle)
+	// invalid colors use the default
+	assert.Equal(t, tcell.ColorBlack, colors.popup)
+}
+
+func TestThemeNames(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "gomu-themes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	custom := `module Color { accent = "#ff0000" }`
+	for _, name := range []string{"custom.anko", "nord"} {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(custom), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names, err := themeNames(dir)
+	assert.NoError(t, err)
+	assert.Equal(t,
+		[]string{"custom", "default", "dracula", "gruvbox", "nord", "solarized"},
+		names)
+
+	// theme files take precedence over bundled themes
+	src, err := readTheme(dir, "nord")
+	assert.NoError(t, err)
+	assert.Equal(t, custom, src)
+
+	src, err = readTheme(dir, "dracula")
+	assert.NoError(t, err)
+	assert.Equal(t, bundledThemes["dracula"], src)
+
+	_, err = readTheme(dir, "unknown")
+	assert.Error(t, err)
+
+	// a missing directory only has the bundled themes
+	names, err = themeNames(filepath.Join(dir, "missing"))
+	assert.NoError(t, err)
+	assert.Len(t, names, len(bundledThemes))
+}
+
+func TestSetTheme(t *testing.T) {
+
+	gomu = prepareLayoutTest()
+
+	root := tview.NewTreeNode("music")
+	root.SetReference(&player.AudioFile{})
+	song := tview.NewTreeNode("song")
+	audioFile := &player.AudioFile{}
+	audioFile.SetIsAudioFile(true)
+	song.SetReference(audioFile)
+	root.AddChild(song)
+	gomu.playlist.SetRoot(root)
+	gomu.playlist.prevNode = root
+
+	gomu.panels = []Panel{gomu.playlist, gomu.queue, gomu.playingBar}
+	gomu.prevPanel = gomu.queue
+
+	// an open popup takes the colors of the theme
+	jobs := newJobsTable(newJobs(func(string) int { return 1 }))
+	gomu.popups.popups = []tview.Primitive{jobs}
+
+	for _, name := range []string{"nord", "gruvbox", "dracula", "solarized", "default"} {
+		_, err := gomu.anko.Execute(bundledThemes[name])
+		assert.NoError(t, err, name)
+		for key := range defaultColors {
+			_, ok := parseColor(gomu.anko.GetString(key))
+			assert.True(t, ok, name+" "+key)
+		}
+	}
+
+	err := setTheme("nord")
+	assert.NoError(t, err)
+
+	nord := tcell.NewHexColor(0x88c0d0)
+	assert.Equal(t, nord, gomu.colors.accent)
+	assert.Equal(t, tcell.NewHexColor(0x5e81ac), root.GetColor())
+	assert.Equal(t, tcell.NewHexColor(0xd8dee9), song.GetColor())
+	assert.Equal(t, tcell.NewHexColor(0x3b4252), tview.Styles.PrimitiveBackgroundColor)
+	assert.Equal(t, nord, gomu.queue.GetBorderColor())
+	assert.Equal(t, tcell.NewHexColor(0xd8dee9), gomu.playingBar.GetBorderColor())
+	assert.Equal(t, tcell.NewHexColor(0x3b4252), jobs.GetBackgroundColor())
+	assert.Equal(t, tcell.NewHexColor(0x3b4252), jobs.help.GetBackgroundColor())
+
+	assert.Error(t, setTheme("unknown"))
+}
@@ -141,15 +141,18 @@ func getName(fn string) string {
 // example ~/path/to/song/song.mp3
 func extractFilePath(output []byte, dir string) string {
 
-	regexSearch := fmt.Sprintf(`\[ffmpeg\] Destination: %s\/.*.mp3`,
-		escapeBackSlash(dir))
-
-	parseAudioPathOnly := regexp.MustCompile(`\/.*mp3$`)
-
-	re := regexp.MustCompile(regexSearch)
-
-	return string(parseAudioPathOnly.Find(re.Find(output)))
+	// youtube-dl prints [ffmpeg] and yt-dlp [ExtractAudio], the file is not
+	// converted when it already has the audio format
+	re := regexp.MustCompile(fmt.Sprintf(
+		`(?m)^\[(?:ffmpeg|ExtractAudio)\] (?:Destination: (%[1]s/.*)|Not converting audio (%[1]s/.*?); file is already in target format.*)$`,
+		regexp.QuoteMeta(dir)))
+
+	var audioPath string
+	for _, m := range re.FindAllSubmatch(output, -1) {
+		audioPath = string(m[1]) + string(m[2])
+	}
 
+	return strings.TrimRight(audioPath, "\r")
 }
 
 func escapeBackSlash(input string) string {
@@ -274,7 +277,8 @@ func embedLyric(songPath string, lyricTobeWritten *lyric.Lyric, isDelete bool) (
 		if !ok {
 			die(errors.New("sylt error"))
 		}
-		if strings.Contains(sylf.ContentDescriptor, lyricTobeWritten.LangExt) {
+		// the translation has a distinct descriptor containing the language
+		if sylf.ContentDescriptor == lyricTobeWritten.LangExt {
 			continue
 		}
 		tag.AddSynchronisedLyricsFrame(sylf)
@@ -312,6 +316,20 @@ func embedLyric(songPath string, lyricTobeWritten *lyric.Lyric, isDelete bool) (
 
 }
 
+// embedTranslation embeds the lrc translation of the lyric in langExt with
+// the descriptor of lyric.TranslationLang
+func embedTranslation(songPath, langExt, translation string) error {
+
+	var l lyric.Lyric
+	err := l.NewFromLRC(translation)
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+	l.LangExt = lyric.TranslationLang(langExt)
+
+	return embedLyric(songPath, &l, false)
+}
+
 func embedLength(songPath string) (time.Duration, error) {
 	tag, err := id3v2.Open(songPath, id3v2.Options{Parse: true})
 	if err != nil {
@@ -156,3 +156,59 @@ func TestEmbedLyric(t *testing.T) {
 	assert.Equal(t, lyricString, frame.Lyrics)
 	assert.Equal(t, descriptor, frame.ContentDescriptor)
 }
+
+func TestEmbedTranslation(t *testing.T) {
+
+	testFile := "./test/sample-translation"
+
+	f, err := os.Create(testFile)
+	if err != nil {
+		t.Error(err)
+	}
+	f.Close()
+	defer os.Remove(testFile)
+
+	var original lyric.Lyric
+	err = original.NewFromLRC("[00:01.00]first\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	original.LangExt = "zh-CN"
+
+	err = embedTranslation(testFile, "zh-CN", "[00:01.00]translated\n")
+	assert.NoError(t, err)
+
+	// embedding the lyric again keeps its translation
+	assert.NoError(t, embedLyric(testFile, &original, false))
+	assert.NoError(t, embedLyric(testFile, &original, false))
+
+	tag, err := id3v2.Open(testFile, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tag.Close()
+
+	descriptors := map[string]string{}
+	for _, f := range tag.GetFrames(tag.CommonID("Synchronised lyrics/text")) {
+		sylf := f.(id3v2.SynchronisedLyricsFrame)
+		descriptors[sylf.ContentDescriptor] = sylf.SynchronizedTexts[0].Text
+	}
+	assert.Equal(t, map[string]string{"zh-CN": "first", "zh-CN-tr": "translated"}, descriptors)
+}
+
+func TestDownloadedFilePathYtDlp(t *testing.T) {
+
+	sample := `[youtube] jJPMnTXl63E: Downloading webpage
+[download] Destination: /tmp/pop/death bed (1).webm
+[download] 100% of 2.54MiB in 00:02
+[ExtractAudio] Destination: /tmp/pop/death bed (1).opus
+Deleting original file /tmp/pop/death bed (1).webm (pass -k to keep)`
+
+	assert.Equal(t, "/tmp/pop/death bed (1).opus", extractFilePath([]byte(sample), "/tmp/pop"))
+
+	sample = `[ExtractAudio] Not converting audio /tmp/pop/song.mp3; file is already in target format mp3`
+	assert.Equal(t, "/tmp/pop/song.mp3", extractFilePath([]byte(sample), "/tmp/pop"))
+
+	// files of another directory are not matched
+	assert.Equal(t, "", extractFilePath([]byte(sample), "/tmp/rap"))
+}
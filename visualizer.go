@@ -0,0 +1,307 @@
+package main
+
+import (
+	"math"
+	"math/cmplx"
+	"sync/atomic"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	"github.com/issadarkthing/gomu/player"
+)
+
+// fftSize is the number of samples analysed for each frame
+const fftSize = 2048
+
+// visualizerHeight is the height of the visualizer panel when it is shown
+const visualizerHeight = 8
+
+// frequencies shown by the spectrum, the bands are spaced logarithmically
+const (
+	minFrequency = 40
+	maxFrequency = 16000
+)
+
+// levels are the blocks used to draw a fraction of a cell
+var levels = []rune(" ▁▂▃▄▅▆▇█")
+
+// Visualizer shows the spectrum or the waveform of the song being played
+type Visualizer struct {
+	*tview.Box
+	// flex contains the visualizer, it is resized to hide the visualizer
+	flex    *tview.Flex
+	visible bool
+	// size is the size of the visualizer in the layout
+	size int
+	// style is either "bars" or "wave"
+	style   string
+	fps     int
+	samples []float64
+	bands   []float64
+	// pending is 1 while a frame is queued and has not been drawn yet
+	pending int32
+}
+
+func newVisualizer() *Visualizer {
+
+	box := tview.NewBox()
+	box.SetBorder(true).SetTitle(" Visualizer ")
+	box.SetBackgroundColor(gomu.colors.background)
+
+	fps := gomu.anko.GetInt("General.visualizer_fps")
+	if fps <= 0 {
+		fps = 20
+	}
+
+	return &Visualizer{
+		Box:     box,
+		visible: gomu.anko.GetBool("General.visualizer"),
+		style:   gomu.anko.GetString("General.visualizer_style"),
+		fps:     fps,
+		samples: make([]float64, fftSize),
+	}
+}
+
+// height returns the height of the panel in the layout
+func (v *Visualizer) height() int {
+	switch {
+	case !v.visible:
+		return 0
+	case v.size > 0:
+		return v.size
+	}
+	return visualizerHeight
+}
+
+// place records the group containing the visualizer and its size in the
+// layout
+func (v *Visualizer) place(flex *tview.Flex, size, _ int) {
+	v.flex = flex
+	v.size = size
+}
+
+// itemSize returns the size of the visualizer in its group
+func (v *Visualizer) itemSize() (size, ratio int) {
+	return v.height(), 0
+}
+
+// toggle shows or hides the visualizer
+func (v *Visualizer) toggle() {
+	v.visible = !v.visible
+	if v.flex != nil {
+		v.flex.ResizeItem(v, v.height(), 0)
+	}
+}
+
+// run updates the visualizer at General.visualizer_fps frames per second
+func (v *Visualizer) run() {
+
+	ticker := time.NewTicker(time.Second / time.Duration(v.fps))
+	defer ticker.Stop()
+
+	for range ticker.C {
+
+		if !v.visible {
+			continue
+		}
+
+		// frames are dropped while the previous one is waiting to be drawn
+		if !atomic.CompareAndSwapInt32(&v.pending, 0, 1) {
+			continue
+		}
+
+		// each frame has its own samples as the queued update reads them
+		// after the next tick. Silence is analysed while paused so that the
+		// bars fall down.
+		samples := make([]float64, fftSize)
+		if !gomu.player.IsRunning() || !gomu.player.Samples(samples) {
+			for i := range samples {
+				samples[i] = 0
+			}
+		}
+
+		gomu.app.QueueUpdateDraw(func() {
+			v.update(samples)
+			atomic.StoreInt32(&v.pending, 0)
+		})
+	}
+}
+
+// update keeps a copy of the samples and computes the bands of the spectrum
+// for the current width
+func (v *Visualizer) update(samples []float64) {
+	copy(v.samples, samples)
+
+	if v.style == "wave" {
+		return
+	}
+
+	_, _, width, _ := v.GetInnerRect()
+	// one column of space between the bars
+	bands := spectrum(v.samples, float64(player.SampleRate), (width+1)/2)
+	v.bands = smoothBands(v.bands, bands)
+}
+
+// Draw draws the spectrum or the waveform inside the border
+func (v *Visualizer) Draw(screen tcell.Screen) {
+	v.Box.DrawForSubclass(screen, v)
+
+	x, y, width, height := v.GetInnerRect()
+	if width <= 0 || height <= 0 {
+		return
+	}
+
+	style := tcell.StyleDefault.
+		Foreground(gomu.colors.visualizer).
+		Background(gomu.colors.background)
+
+	if v.style == "wave" {
+		drawWave(screen, v.samples, x, y, width, height, style)
+		return
+	}
+
+	for i, value := range v.bands {
+		if i*2 >= width {
+			break
+		}
+		drawBar(screen, x+i*2, y, height, value, style)
+	}
+}
+
+// drawBar draws a vertical bar filling value of the height
+func drawBar(screen tcell.Screen, x, y, height int, value float64, style tcell.Style) {
+
+	eighths := int(value * float64(height*8))
+
+	for row := 0; row < height; row++ {
+		// rows are filled from the bottom
+		fill := eighths - (height-1-row)*8
+		fill = clamp(fill, 0, 8)
+		screen.SetContent(x, y+row, levels[fill], nil, style)
+	}
+}
+
+// drawWave draws the range of the samples covered by each column
+func drawWave(screen tcell.Screen, samples []float64, x, y, width, height int, style tcell.Style) {
+
+	toRow := func(sample float64) int {
+		sample = math.Max(-1, math.Min(1, sample))
+		return clamp(int((1-sample)/2*float64(height)), 0, height-1)
+	}
+
+	for col := 0; col < width; col++ {
+		chunk := samples[col*len(samples)/width : (col+1)*len(samples)/width]
+		if len(chunk) == 0 {
+			continue
+		}
+
+		low, high := chunk[0], chunk[0]
+		for _, sample := range chunk {
+			low = math.Min(low, sample)
+			high = math.Max(high, sample)
+		}
+
+		for row := toRow(high); row <= toRow(low); row++ {
+			screen.SetContent(x+col, y+row, '│', nil, style)
+		}
+	}
+}
+
+// smoothBands lets the bars fall slowly instead of jumping between frames
+func smoothBands(prev, bands []float64) []float64 {
+
+	if len(prev) != len(bands) {
+		return bands
+	}
+
+	for i, value := range bands {
+		bands[i] = math.Max(value, prev[i]*0.8)
+	}
+
+	return bands
+}
+
+// spectrum returns the level of each band between 0 and 1. The bands are
+// spaced logarithmically between minFrequency and maxFrequency, levels are
+// scaled from -60dB to 0dB.
+func spectrum(samples []float64, sampleRate float64, bands int) []float64 {
+
+	n := len(samples)
+	if bands <= 0 || n == 0 {
+		return nil
+	}
+
+	// hann window reduces the leakage between frequencies
+	data := make([]complex128, n)
+	for i, sample := range samples {
+		window := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n-1))
+		data[i] = complex(sample*window, 0)
+	}
+	fft(data)
+
+	result := make([]float64, bands)
+	binWidth := sampleRate / float64(n)
+	ratio := math.Pow(maxFrequency/minFrequency, 1/float64(bands))
+
+	for band := range result {
+		low := minFrequency * math.Pow(ratio, float64(band))
+		high := low * ratio
+
+		first := int(low / binWidth)
+		last := int(high / binWidth)
+		if last <= first {
+			last = first + 1
+		}
+
+		var magnitude float64
+		for bin := first; bin < last && bin < n/2; bin++ {
+			magnitude = math.Max(magnitude, cmplx.Abs(data[bin]))
+		}
+
+		// a full scale sine has a magnitude of n/4 with the hann window
+		magnitude = magnitude * 4 / float64(n)
+		if magnitude <= 0 {
+			continue
+		}
+
+		db := 20 * math.Log10(magnitude)
+		result[band] = math.Max(0, math.Min(1, (db+60)/60))
+	}
+
+	return result
+}
+
+// fft computes the discrete fourier transform in place, the length of x must
+// be a power of two
+func fft(x []complex128) {
+
+	n := len(x)
+
+	// bit reversal permutation
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				even := x[start+k]
+				odd := x[start+k+size/2] * w
+				x[start+k] = even + odd
+				x[start+k+size/2] = even - odd
+				w *= step
+			}
+		}
+	}
+}
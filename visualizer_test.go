@@ -0,0 +1,73 @@
+package main
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFFT(t *testing.T) {
+
+	input := []complex128{1, 2, 3, 4, 0, -1, 2, 0.5}
+
+	// naive discrete fourier transform
+	expected := make([]complex128, len(input))
+	for k := range expected {
+		for n, x := range input {
+			angle := -2 * math.Pi * float64(k*n) / float64(len(input))
+			expected[k] += x * cmplx.Exp(complex(0, angle))
+		}
+	}
+
+	fft(input)
+
+	for k := range expected {
+		assert.InDelta(t, real(expected[k]), real(input[k]), 1e-9)
+		assert.InDelta(t, imag(expected[k]), imag(input[k]), 1e-9)
+	}
+}
+
+func TestSpectrum(t *testing.T) {
+
+	const sampleRate = 48000
+
+	samples := make([]float64, fftSize)
+	for i := range samples {
+		samples[i] = math.Sin(2 * math.Pi * 1000 * float64(i) / sampleRate)
+	}
+
+	bands := spectrum(samples, sampleRate, 20)
+	assert.Len(t, bands, 20)
+
+	loudest := 0
+	for i, level := range bands {
+		if level > bands[loudest] {
+			loudest = i
+		}
+	}
+
+	// the band containing 1kHz is the loudest and close to 0dB
+	ratio := math.Pow(maxFrequency/minFrequency, 1.0/20)
+	low := minFrequency * math.Pow(ratio, float64(loudest))
+	assert.True(t, low <= 1000 && 1000 < low*ratio*1.1, low)
+	assert.InDelta(t, 1, bands[loudest], 0.05)
+
+	// silence has no level
+	for _, level := range spectrum(make([]float64, fftSize), sampleRate, 20) {
+		assert.Equal(t, 0.0, level)
+	}
+
+	assert.Nil(t, spectrum(samples, sampleRate, 0))
+}
+
+func TestSmoothBands(t *testing.T) {
+
+	bands := smoothBands([]float64{1, 0.5}, []float64{0, 0.8})
+	assert.InDeltaSlice(t, []float64{0.8, 0.8}, bands, 1e-9)
+
+	// the previous bands are dropped when the width changes
+	bands = smoothBands([]float64{1}, []float64{0, 0.2})
+	assert.Equal(t, []float64{0, 0.2}, bands)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ztrue/tracerr"
+
+	"github.com/issadarkthing/gomu/player"
+)
+
+// peakResolution is the number of peaks computed for each song, they are
+// resampled to the width of the progress bar
+const peakResolution = 1024
+
+// libraryDataDir is the directory in the music dir where gomu keeps the data
+// it computes about the library
+const libraryDataDir = ".gomu"
+
+// peaksCacheDir returns the directory the peaks are cached in, next to the
+// library in the music dir
+func peaksCacheDir() string {
+	musicDir := expandTilde(gomu.anko.GetString("General.music_dir"))
+	return filepath.Join(musicDir, libraryDataDir, "peaks")
+}
+
+// peaksCachePath returns the path of the cached peaks of the song, the size and
+// modification time are part of the key so that edited songs are computed
+// again.
+func peaksCachePath(cacheDir, songPath string) (string, error) {
+
+	stat, err := os.Stat(songPath)
+	if err != nil {
+		return "", tracerr.Wrap(err)
+	}
+
+	key := fmt.Sprintf("%s:%d:%d", songPath, stat.Size(), stat.ModTime().UnixNano())
+
+	return filepath.Join(cacheDir, sha1Hex(key)), nil
+}
+
+// loadPeaks returns the cached peaks of the song, the peaks are computed and
+// saved in the cache if they are not found.
+func loadPeaks(cacheDir, songPath string) ([]float64, error) {
+
+	cachePath, err := peaksCachePath(cacheDir, songPath)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+
+	peaks, err := readPeaks(cachePath)
+	if err == nil {
+		return peaks, nil
+	}
+
+	peaks, err = player.Peaks(songPath, peakResolution)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+
+	err = writePeaks(cachePath, peaks)
+	if err != nil {
+		// the peaks can still be shown
+		logError(err)
+	}
+
+	return peaks, nil
+}
+
+// readPeaks reads peaks stored as one byte each
+func readPeaks(cachePath string) ([]float64, error) {
+
+	data, err := ioutil.ReadFile(cachePath)
+	if err != nil {
+		return nil, tracerr.Wrap(err)
+	}
+
+	peaks := make([]float64, len(data))
+	for i, b := range data {
+		peaks[i] = float64(b) / 255
+	}
+
+	return peaks, nil
+}
+
+// writePeaks stores peaks as one byte each
+func writePeaks(cachePath string, peaks []float64) error {
+
+	err := os.MkdirAll(filepath.Dir(cachePath), 0755)
+	if err != nil {
+		return tracerr.Wrap(err)
+	}
+
+	data := make([]byte, len(peaks))
+	for i, peak := range peaks {
+		data[i] = byte(peak*255 + 0.5)
+	}
+
+	return tracerr.Wrap(ioutil.WriteFile(cachePath, data, 0644))
+}
+
+// waveformStr draws the peaks in width columns with block characters. The
+// columns before progress are returned in played, the others in rest.
+func waveformStr(peaks []float64, progress, maxProgress, width int) (played, rest string) {
+
+	if width <= 0 || len(peaks) == 0 {
+		return "", ""
+	}
+
+	playedWidth := 0
+	if maxProgress > 0 {
+		playedWidth = clamp(width*progress/maxProgress, 0, width)
+	}
+
+	var playedStr, restStr strings.Builder
+
+	for col := 0; col < width; col++ {
+		// highest peak of the part of the song covered by the column
+		first := col * len(peaks) / width
+		last := (col + 1) * len(peaks) / width
+		if last <= first {
+			last = first + 1
+		}
+
+		var peak float64
+		for _, value := range peaks[first:last] {
+			if value > peak {
+				peak = value
+			}
+		}
+
+		// silence is drawn with the lowest block so that the bar stays visible
+		char := levels[1+int(peak*float64(len(levels)-2)+0.5)]
+
+		if col < playedWidth {
+			playedStr.WriteRune(char)
+		} else {
+			restStr.WriteRune(char)
+		}
+	}
+
+	return playedStr.String(), restStr.String()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeaksCache(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "gomu-peaks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cachePath := filepath.Join(dir, "peaks", "song")
+
+	_, err = readPeaks(cachePath)
+	assert.Error(t, err)
+
+	err = writePeaks(cachePath, []float64{0, 0.5, 1})
+	assert.NoError(t, err)
+
+	peaks, err := readPeaks(cachePath)
+	assert.NoError(t, err)
+	assert.InDeltaSlice(t, []float64{0, 0.5, 1}, peaks, 0.01)
+}
+
+func TestWaveformStr(t *testing.T) {
+
+	peaks := []float64{0, 0, 1, 1, 0.5, 0.5, 0, 1}
+
+	played, rest := waveformStr(peaks, 1, 4, 4)
+	assert.Equal(t, "▁", played)
+	assert.Equal(t, "█▅█", rest)
+
+	played, rest = waveformStr(peaks, 4, 4, 4)
+	assert.Equal(t, "▁█▅█", played)
+	assert.Equal(t, "", rest)
+
+	// more columns than peaks
+	played, rest = waveformStr(peaks[:2], 0, 4, 4)
+	assert.Equal(t, "", played)
+	assert.Equal(t, "▁▁▁▁", rest)
+
+	played, rest = waveformStr(nil, 0, 4, 4)
+	assert.Equal(t, "", played+rest)
+}
+
+func TestPeaksCachePath(t *testing.T) {
+
+	song, err := filepath.Abs("./test/rap/audio_test.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cachePath, err := peaksCachePath("/music/.gomu/peaks", song)
+	assert.NoError(t, err)
+	assert.Equal(t, "/music/.gomu/peaks", filepath.Dir(cachePath))
+
+	_, err = peaksCachePath("/music/.gomu/peaks", song+".missing")
+	assert.Error(t, err)
+}